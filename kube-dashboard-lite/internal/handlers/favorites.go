@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// favorites is the set of pinned namespaces. It is persisted to path as a
+// JSON array when one is set, and kept in memory only otherwise.
+type favorites struct {
+	mu    sync.RWMutex
+	path  string
+	names map[string]bool
+}
+
+func newFavorites() *favorites {
+	return &favorites{names: make(map[string]bool)}
+}
+
+// load reads the favorites file at path and saves to it from then on. A
+// missing file is an empty list.
+func (f *favorites) load(path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return fmt.Errorf("invalid favorites file %s: %w", path, err)
+	}
+	for _, name := range names {
+		f.names[name] = true
+	}
+	return nil
+}
+
+func (f *favorites) list() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.sorted()
+}
+
+func (f *favorites) has(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.names[name]
+}
+
+// set adds or removes a favorite and saves the list
+func (f *favorites) set(name string, favorite bool) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.names[name] == favorite {
+		return f.sorted(), nil
+	}
+
+	if favorite {
+		f.names[name] = true
+	} else {
+		delete(f.names, name)
+	}
+	if err := f.save(); err != nil {
+		// Keep memory in step with the file
+		if favorite {
+			delete(f.names, name)
+		} else {
+			f.names[name] = true
+		}
+		return nil, err
+	}
+	return f.sorted(), nil
+}
+
+// save writes the list through a temp file so a crash never leaves it
+// half-written. Callers hold f.mu.
+func (f *favorites) save() error {
+	if f.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(f.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), ".favorites-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// sorted returns the favorites by name. Callers hold f.mu.
+func (f *favorites) sorted() []string {
+	names := make([]string, 0, len(f.names))
+	for name := range f.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadFavorites persists favorite namespaces to path, reading any saved
+// there before. Without it favorites last until the dashboard restarts.
+func (h *Handler) LoadFavorites(path string) error {
+	return h.favorites.load(path)
+}
+
+// GetFavoriteNamespaces lists the favorite namespaces
+func (h *Handler) GetFavoriteNamespaces(w http.ResponseWriter, r *http.Request) {
+	h.json(w, h.favorites.list())
+}
+
+// AddFavoriteNamespace pins a namespace. It doesn't need to exist, so
+// favorites survive a namespace being recreated or another context.
+func (h *Handler) AddFavoriteNamespace(w http.ResponseWriter, r *http.Request) {
+	h.setFavorite(w, r, true)
+}
+
+// RemoveFavoriteNamespace unpins a namespace
+func (h *Handler) RemoveFavoriteNamespace(w http.ResponseWriter, r *http.Request) {
+	h.setFavorite(w, r, false)
+}
+
+func (h *Handler) setFavorite(w http.ResponseWriter, r *http.Request, favorite bool) {
+	namespace := chi.URLParam(r, "namespace")
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		h.error(w, http.StatusBadRequest, fmt.Sprintf("invalid namespace %q: %s", namespace, errs[0]))
+		return
+	}
+
+	names, err := h.favorites.set(namespace, favorite)
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.json(w, names)
+}
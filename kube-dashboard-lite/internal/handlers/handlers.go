@@ -2,35 +2,90 @@ package handlers
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 
 	"github.com/yourorg/kube-dashboard-lite/internal/k8s"
 )
 
+// logBatchMaxBytes flushes a log batch early once it grows this large
+const logBatchMaxBytes = 32 * 1024
+
+// Log output formats for GetPodLogs' ?format=
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// maxManifestBytes bounds the YAML accepted by DiffManifest
+const maxManifestBytes = 1 << 20
+
+// maxKubeconfigBytes bounds the kubeconfig accepted by UploadKubeconfig
+const maxKubeconfigBytes = 1 << 20
+
+// Pod re-resolution interval and pod cap for StreamDeploymentLogs
+const (
+	deploymentLogResync  = 5 * time.Second
+	maxDeploymentLogPods = 20
+)
+
+// maxMetadataPatchBytes bounds the labels or annotations accepted in one
+// patch
+const maxMetadataPatchBytes = 256 << 10
+
 // Handler handles API requests
 type Handler struct {
-	k8s       *k8s.Client
-	writeMode bool
-	logger    zerolog.Logger
+	k8s            *k8s.Client
+	clusters       *k8s.Pool
+	writeMode      bool
+	logBatchWindow time.Duration
+	favorites      *favorites
+	metrics        *k8s.MetricsHistory
+	logger         zerolog.Logger
 }
 
-// New creates a new handler
-func New(client *k8s.Client, writeMode bool, logger zerolog.Logger) *Handler {
+// New creates a new handler. Followed log lines are coalesced and flushed
+// every logBatchWindow; zero or less flushes each line as it arrives.
+func New(client *k8s.Client, writeMode bool, logBatchWindow time.Duration, logger zerolog.Logger) *Handler {
 	return &Handler{
-		k8s:       client,
-		writeMode: writeMode,
-		logger:    logger,
+		k8s:            client,
+		clusters:       k8s.NewPool(client),
+		writeMode:      writeMode,
+		logBatchWindow: logBatchWindow,
+		favorites:      newFavorites(),
+		logger:         logger,
 	}
 }
 
+// SetMetricsHistory serves pod usage history from m, which the caller runs.
+// Without one the metrics endpoints report the history as unavailable.
+func (h *Handler) SetMetricsHistory(m *k8s.MetricsHistory) {
+	h.metrics = m
+}
+
 // GetClusterInfo returns cluster information
 func (h *Handler) GetClusterInfo(w http.ResponseWriter, r *http.Request) {
-	info, err := h.k8s.GetClusterInfo(r.Context())
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	info, err := client.GetClusterInfo(r.Context())
 	if err != nil {
 		h.error(w, http.StatusInternalServerError, err.Error())
 		return
@@ -62,22 +117,281 @@ func (h *Handler) SwitchContext(w http.ResponseWriter, r *http.Request) {
 	h.json(w, map[string]string{"context": name})
 }
 
+// UploadKubeconfig replaces the active cluster connection with a kubeconfig
+// posted as the request body, optionally switching to ?context=. The
+// kubeconfig is held in memory only; a dry run just validates it.
+func (h *Handler) UploadKubeconfig(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := h.checkWrite(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxKubeconfigBytes+1))
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(data) > maxKubeconfigBytes {
+		h.error(w, http.StatusRequestEntityTooLarge, "kubeconfig too large")
+		return
+	}
+
+	contextName := r.URL.Query().Get("context")
+	if dryRun {
+		err = k8s.ValidateKubeconfig(data, contextName)
+	} else {
+		err = h.k8s.LoadKubeconfig(data, contextName)
+	}
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !dryRun {
+		h.clusters.Reset()
+		contextName = h.k8s.CurrentContext()
+	}
+
+	h.json(w, map[string]interface{}{
+		"status":  "loaded",
+		"dryRun":  dryRun,
+		"context": contextName,
+	})
+}
+
 // GetNamespaces returns all namespaces
 func (h *Handler) GetNamespaces(w http.ResponseWriter, r *http.Request) {
-	namespaces, err := h.k8s.GetNamespaces(r.Context())
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespaces, err := client.GetNamespaces(r.Context())
 	if err != nil {
 		h.error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	// Favorites come first so they're easy to find among many namespaces
+	for i := range namespaces {
+		namespaces[i].Favorite = h.favorites.has(namespaces[i].Name)
+	}
+	sort.SliceStable(namespaces, func(i, j int) bool {
+		return namespaces[i].Favorite && !namespaces[j].Favorite
+	})
+
 	h.json(w, namespaces)
 }
 
+// GetNamespaceSummary returns resource counts for a namespace
+func (h *Handler) GetNamespaceSummary(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+
+	summary, err := client.GetNamespaceSummary(r.Context(), namespace)
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.json(w, summary)
+}
+
+// ExportNamespace streams a tar.gz bundle of a namespace's pods,
+// deployments, services, events and recent logs as a download
+func (h *Handler) ExportNamespace(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+	filename := fmt.Sprintf("%s-%s.tar.gz", namespace, time.Now().UTC().Format("20060102-150405"))
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// The response is already under way, so a failure can only be logged
+	if err := client.WriteBundle(r.Context(), namespace, w); err != nil {
+		h.logger.Error().Err(err).Str("namespace", namespace).Msg("Failed to write namespace bundle")
+	}
+}
+
+// StreamNamespaceSummary pushes the namespace summary over SSE whenever its
+// counts change, at most once a second
+func (h *Handler) StreamNamespaceSummary(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.error(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	updates, err := client.WatchNamespaceSummary(r.Context(), namespace)
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher.Flush()
+
+	for summary := range updates {
+		data, err := json.Marshal(summary)
+		if err != nil {
+			continue
+		}
+		w.Write([]byte("data: " + string(data) + "\n\n"))
+		flusher.Flush()
+	}
+}
+
+// defaultRolloutTimeout bounds a rollout stream when ?timeout= isn't given
+const defaultRolloutTimeout = 5 * time.Minute
+
+// StreamRollout pushes deployment rollout progress over SSE until the rollout
+// completes or the timeout passes, then closes the stream
+func (h *Handler) StreamRollout(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+	name := chi.URLParam(r, "name")
+
+	timeout := defaultRolloutTimeout
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		parsed, err := time.ParseDuration(t)
+		if err != nil || parsed <= 0 {
+			h.error(w, http.StatusBadRequest, "invalid timeout: "+t)
+			return
+		}
+		timeout = parsed
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.error(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	statuses, err := client.WatchRollout(ctx, namespace, name)
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	for {
+		select {
+		case status, ok := <-statuses:
+			if !ok {
+				// Watch ended before completion, let the client reconnect
+				return
+			}
+			data, err := json.Marshal(status)
+			if err != nil {
+				return
+			}
+			w.Write([]byte("data: " + string(data) + "\n\n"))
+			flusher.Flush()
+
+			if status.Complete {
+				return
+			}
+		case <-ctx.Done():
+			if r.Context().Err() == nil {
+				w.Write([]byte("event: timeout\ndata: {}\n\n"))
+				flusher.Flush()
+			}
+			return
+		}
+	}
+}
+
 // GetPods returns pods in a namespace
 func (h *Handler) GetPods(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
 	namespace := chi.URLParam(r, "namespace")
 
-	pods, err := h.k8s.GetPods(r.Context(), namespace)
+	pods, err := client.GetPods(r.Context(), namespace, k8s.PodOptions{
+		Node: r.URL.Query().Get("node"),
+	})
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.json(w, pods)
+}
+
+// GetNodes returns every node with its pod and resource allocation
+func (h *Handler) GetNodes(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	nodes, err := client.GetNodes(r.Context())
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.json(w, nodes)
+}
+
+// GetNode returns one node with its pod and resource allocation
+func (h *Handler) GetNode(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+
+	node, err := client.GetNode(r.Context(), name)
+	if err != nil {
+		h.error(w, writeErrorStatus(err), err.Error())
+		return
+	}
+
+	h.json(w, node)
+}
+
+// GetNodePods returns the pods scheduled on a node, across all namespaces
+func (h *Handler) GetNodePods(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+
+	pods, err := client.GetPods(r.Context(), metav1.NamespaceAll, k8s.PodOptions{Node: name})
 	if err != nil {
 		h.error(w, http.StatusInternalServerError, err.Error())
 		return
@@ -88,10 +402,15 @@ func (h *Handler) GetPods(w http.ResponseWriter, r *http.Request) {
 
 // GetPod returns a single pod
 func (h *Handler) GetPod(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
 	namespace := chi.URLParam(r, "namespace")
 	name := chi.URLParam(r, "name")
 
-	pod, err := h.k8s.GetPod(r.Context(), namespace, name)
+	pod, err := client.GetPod(r.Context(), namespace, name)
 	if err != nil {
 		h.error(w, http.StatusNotFound, err.Error())
 		return
@@ -100,8 +419,47 @@ func (h *Handler) GetPod(w http.ResponseWriter, r *http.Request) {
 	h.json(w, pod)
 }
 
+// DescribePod returns a pod's detail, its recent events and the last ?tail=
+// log lines of each container in one response
+func (h *Handler) DescribePod(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+	name := chi.URLParam(r, "name")
+
+	tailLines := k8s.DefaultDescribeLogTail
+	if t := r.URL.Query().Get("tail"); t != "" {
+		parsed, err := strconv.Atoi(t)
+		if err != nil || parsed < 0 {
+			h.error(w, http.StatusBadRequest, "tail must be a non-negative number of lines")
+			return
+		}
+		tailLines = parsed
+	}
+
+	desc, err := client.DescribePod(r.Context(), namespace, name, tailLines)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if apierrors.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		h.error(w, status, err.Error())
+		return
+	}
+
+	h.json(w, desc)
+}
+
 // GetPodLogs returns logs for a pod
 func (h *Handler) GetPodLogs(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
 	namespace := chi.URLParam(r, "namespace")
 	name := chi.URLParam(r, "name")
 	container := r.URL.Query().Get("container")
@@ -114,12 +472,24 @@ func (h *Handler) GetPodLogs(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = logFormatText
+	case logFormatText, logFormatJSON:
+	default:
+		h.error(w, http.StatusBadRequest, "format must be text or json")
+		return
+	}
+
+	// JSON frames always carry the timestamp, so request it from the kubelet
 	opts := k8s.LogOptions{
-		Follow:    follow,
-		TailLines: tailLines,
+		Follow:     follow,
+		TailLines:  tailLines,
+		Timestamps: r.URL.Query().Get("timestamps") == "true" || format == logFormatJSON,
 	}
 
-	stream, err := h.k8s.GetPodLogs(r.Context(), namespace, name, container, opts)
+	stream, err := client.GetPodLogs(r.Context(), namespace, name, container, opts)
 	if err != nil {
 		h.error(w, http.StatusInternalServerError, err.Error())
 		return
@@ -138,98 +508,844 @@ func (h *Handler) GetPodLogs(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		scanner := bufio.NewScanner(stream)
-		for scanner.Scan() {
-			w.Write([]byte("data: " + scanner.Text() + "\n\n"))
-			flusher.Flush()
-		}
+		h.streamLogs(w, r, flusher, stream, format)
 	} else {
-		// Non-streaming mode
-		w.Header().Set("Content-Type", "text/plain")
+		// Non-streaming mode; JSON is one frame per line
+		if format == logFormatJSON {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		} else {
+			w.Header().Set("Content-Type", "text/plain")
+		}
 		scanner := bufio.NewScanner(stream)
 		for scanner.Scan() {
-			w.Write(scanner.Bytes())
+			w.Write([]byte(formatLogLine(scanner.Text(), format)))
 			w.Write([]byte("\n"))
 		}
 	}
 }
 
-// DeletePod deletes a pod
-func (h *Handler) DeletePod(w http.ResponseWriter, r *http.Request) {
-	if !h.writeMode {
-		h.error(w, http.StatusForbidden, "write mode is disabled")
+// logFrame is a log line in the JSON format
+type logFrame struct {
+	Pod  string `json:"pod,omitempty"`
+	TS   string `json:"ts,omitempty"`
+	Line string `json:"line"`
+}
+
+// formatLogLine renders a log line for the requested format. In JSON the
+// kubelet's timestamp prefix is split off into ts.
+func formatLogLine(line, format string) string {
+	return formatPodLogLine("", line, format)
+}
+
+// formatPodLogLine renders a log line from a multi-pod stream, prefixed
+// with "[pod] " in text and carrying the pod in JSON
+func formatPodLogLine(pod, line, format string) string {
+	if format != logFormatJSON {
+		if pod == "" {
+			return line
+		}
+		return "[" + pod + "] " + line
+	}
+
+	frame := logFrame{Pod: pod, Line: line}
+	if ts, rest, ok := strings.Cut(line, " "); ok {
+		if _, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			frame.TS, frame.Line = ts, rest
+		}
+	}
+
+	data, _ := json.Marshal(frame)
+	return string(data)
+}
+
+// streamLogs writes log lines as SSE events, batching them so chatty pods
+// don't cost a flush per line. A batch is flushed when the window elapses or
+// it reaches logBatchMaxBytes, whichever comes first.
+func (h *Handler) streamLogs(w http.ResponseWriter, r *http.Request, flusher http.Flusher, stream io.Reader, format string) {
+	if h.logBatchWindow <= 0 {
+		scanner := bufio.NewScanner(stream)
+		for scanner.Scan() {
+			w.Write([]byte("data: " + formatLogLine(scanner.Text(), format) + "\n\n"))
+			flusher.Flush()
+		}
 		return
 	}
 
-	namespace := chi.URLParam(r, "namespace")
-	name := chi.URLParam(r, "name")
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(stream)
+		for scanner.Scan() {
+			select {
+			case lines <- formatLogLine(scanner.Text(), format):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
 
-	// Not implemented yet - would call clientset.CoreV1().Pods().Delete()
-	h.json(w, map[string]string{
-		"status":    "deleted",
-		"namespace": namespace,
-		"name":      name,
-	})
+	h.streamLogBatches(w, r, flusher, lines)
 }
 
-// GetDeployments returns deployments in a namespace
-func (h *Handler) GetDeployments(w http.ResponseWriter, r *http.Request) {
-	namespace := chi.URLParam(r, "namespace")
+// streamLogBatches writes already formatted lines as SSE events in batches
+// until lines is closed or the client goes away
+func (h *Handler) streamLogBatches(w http.ResponseWriter, r *http.Request, flusher http.Flusher, lines <-chan string) {
+	ticker := time.NewTicker(h.logBatchWindow)
+	defer ticker.Stop()
 
-	deployments, err := h.k8s.GetDeployments(r.Context(), namespace)
-	if err != nil {
-		h.error(w, http.StatusInternalServerError, err.Error())
-		return
+	var batch bytes.Buffer
+	flush := func() {
+		if batch.Len() == 0 {
+			return
+		}
+		w.Write(batch.Bytes())
+		batch.Reset()
+		flusher.Flush()
 	}
 
-	h.json(w, deployments)
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				flush()
+				return
+			}
+			batch.WriteString("data: " + line + "\n\n")
+			if batch.Len() >= logBatchMaxBytes {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
 }
 
-// RestartDeployment restarts a deployment
-func (h *Handler) RestartDeployment(w http.ResponseWriter, r *http.Request) {
-	if !h.writeMode {
-		h.error(w, http.StatusForbidden, "write mode is disabled")
+// StreamDeploymentLogs follows the logs of all of a deployment's running
+// pods as one SSE stream, each line prefixed with its pod. Pods are
+// re-resolved every few seconds so a rollout's new pods join the stream and
+// deleted ones leave it; at most maxDeploymentLogPods are followed at once.
+func (h *Handler) StreamDeploymentLogs(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
 		return
 	}
 
 	namespace := chi.URLParam(r, "namespace")
 	name := chi.URLParam(r, "name")
 
-	if err := h.k8s.RestartDeployment(r.Context(), namespace, name); err != nil {
-		h.error(w, http.StatusInternalServerError, err.Error())
+	tailLines := 10
+	if t := r.URL.Query().Get("tail"); t != "" {
+		if parsed, err := strconv.Atoi(t); err == nil {
+			tailLines = parsed
+		}
+	}
+
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = logFormatText
+	case logFormatText, logFormatJSON:
+	default:
+		h.error(w, http.StatusBadRequest, "format must be text or json")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.error(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	// Cancelling the request context stops every pod's stream
+	logs, err := client.FollowDeploymentLogs(r.Context(), namespace, name, k8s.DeploymentLogOptions{
+		Container:  r.URL.Query().Get("container"),
+		TailLines:  tailLines,
+		Timestamps: r.URL.Query().Get("timestamps") == "true" || format == logFormatJSON,
+		Resync:     deploymentLogResync,
+		MaxPods:    maxDeploymentLogPods,
+	})
+	if err != nil {
+		h.error(w, writeErrorStatus(err), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	if h.logBatchWindow <= 0 {
+		for l := range logs {
+			w.Write([]byte("data: " + formatPodLogLine(l.Pod, l.Line, format) + "\n\n"))
+			flusher.Flush()
+		}
 		return
 	}
 
-	h.json(w, map[string]string{"status": "restarted"})
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		for l := range logs {
+			select {
+			case lines <- formatPodLogLine(l.Pod, l.Line, format):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+
+	h.streamLogBatches(w, r, flusher, lines)
 }
 
-// GetServices returns services in a namespace
-func (h *Handler) GetServices(w http.ResponseWriter, r *http.Request) {
+// GetPodMetrics returns a pod's recent CPU and memory usage for the active
+// context
+func (h *Handler) GetPodMetrics(w http.ResponseWriter, r *http.Request) {
 	namespace := chi.URLParam(r, "namespace")
+	name := chi.URLParam(r, "name")
 
-	services, err := h.k8s.GetServices(r.Context(), namespace)
-	if err != nil {
-		h.error(w, http.StatusInternalServerError, err.Error())
+	if h.metrics == nil {
+		h.json(w, metricsDisabled())
 		return
 	}
-
-	h.json(w, services)
+	h.json(w, h.metrics.Pod(namespace, name))
 }
 
-// GetEvents returns events in a namespace
-func (h *Handler) GetEvents(w http.ResponseWriter, r *http.Request) {
+// GetNamespaceMetrics returns the recent CPU and memory usage of every pod
+// in a namespace for the active context
+func (h *Handler) GetNamespaceMetrics(w http.ResponseWriter, r *http.Request) {
 	namespace := chi.URLParam(r, "namespace")
 
-	events, err := h.k8s.GetEvents(r.Context(), namespace)
-	if err != nil {
-		h.error(w, http.StatusInternalServerError, err.Error())
+	if h.metrics == nil {
+		h.json(w, metricsDisabled())
 		return
 	}
+	h.json(w, h.metrics.Namespace(namespace))
+}
 
-	h.json(w, events)
+// metricsDisabled is the usage history reported when sampling is off
+func metricsDisabled() *k8s.MetricsHistoryInfo {
+	return &k8s.MetricsHistoryInfo{
+		Error: "metrics history is disabled",
+		Pods:  []k8s.PodMetricsSeries{},
+	}
 }
 
-// Helper methods
+// DeletePod deletes a pod
+func (h *Handler) DeletePod(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := h.checkWrite(w, r)
+	if !ok {
+		return
+	}
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+	name := chi.URLParam(r, "name")
+
+	result, err := client.DeletePod(r.Context(), namespace, name, k8s.DeletePodOptions{
+		DryRun:          dryRun,
+		Force:           r.URL.Query().Get("force") == "true",
+		ResourceVersion: r.URL.Query().Get("resourceVersion"),
+	})
+	if err != nil {
+		h.error(w, writeErrorStatus(err), err.Error())
+		return
+	}
+
+	h.json(w, map[string]interface{}{
+		"status":          "deleted",
+		"dryRun":          dryRun,
+		"force":           result.Force,
+		"pod":             result.Pod,
+		"owner":           result.Owner,
+		"willBeRecreated": result.WillBeRecreated,
+	})
+}
+
+// DeletePodsByLabel deletes every pod in a namespace matching ?selector=.
+// Unless it's a dry run, ?confirm=true is required so a stray request can't
+// wipe out a namespace.
+func (h *Handler) DeletePodsByLabel(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := h.checkWrite(w, r)
+	if !ok {
+		return
+	}
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+	query := r.URL.Query()
+
+	selector := strings.TrimSpace(query.Get("selector"))
+	if selector == "" {
+		h.error(w, http.StatusBadRequest, "selector is required; an empty selector would match every pod")
+		return
+	}
+	if _, err := labels.Parse(selector); err != nil {
+		h.error(w, http.StatusBadRequest, fmt.Sprintf("invalid selector: %v", err))
+		return
+	}
+	if !dryRun && query.Get("confirm") != "true" {
+		h.error(w, http.StatusBadRequest, "add confirm=true to delete every pod matching the selector")
+		return
+	}
+
+	result, err := client.DeletePodsByLabel(r.Context(), namespace, selector, k8s.DeletePodOptions{
+		DryRun: dryRun,
+		Force:  query.Get("force") == "true",
+	})
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.logger.Info().
+		Str("namespace", namespace).
+		Str("selector", selector).
+		Int("deleted", result.DeletedCount).
+		Int("failed", result.FailedCount).
+		Bool("dryRun", dryRun).
+		Msg("Deleted pods by label")
+
+	h.json(w, result)
+}
+
+// DeleteConfigMap deletes a ConfigMap
+func (h *Handler) DeleteConfigMap(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := h.checkWrite(w, r)
+	if !ok {
+		return
+	}
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+	name := chi.URLParam(r, "name")
+
+	if err := client.DeleteConfigMap(r.Context(), namespace, name, r.URL.Query().Get("resourceVersion"), dryRun); err != nil {
+		h.error(w, writeErrorStatus(err), err.Error())
+		return
+	}
+
+	h.json(w, map[string]interface{}{"status": "deleted", "kind": "ConfigMap", "namespace": namespace, "name": name, "dryRun": dryRun})
+}
+
+// DeleteSecret deletes a Secret. Unless it's a dry run, ?confirm=true is
+// required since a deleted secret's data can't be recovered from the
+// dashboard.
+func (h *Handler) DeleteSecret(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := h.checkWrite(w, r)
+	if !ok {
+		return
+	}
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+	name := chi.URLParam(r, "name")
+
+	if !dryRun && r.URL.Query().Get("confirm") != "true" {
+		h.error(w, http.StatusBadRequest, "add confirm=true to delete a secret")
+		return
+	}
+
+	if err := client.DeleteSecret(r.Context(), namespace, name, r.URL.Query().Get("resourceVersion"), dryRun); err != nil {
+		h.error(w, writeErrorStatus(err), err.Error())
+		return
+	}
+
+	h.logger.Info().
+		Str("namespace", namespace).
+		Str("secret", name).
+		Bool("dryRun", dryRun).
+		Msg("Deleted secret")
+
+	h.json(w, map[string]interface{}{"status": "deleted", "kind": "Secret", "namespace": namespace, "name": name, "dryRun": dryRun})
+}
+
+// PatchLabels sets or removes labels on an object. The body is a JSON
+// object of labels; a null value removes that label and labels not named
+// are left alone.
+func (h *Handler) PatchLabels(w http.ResponseWriter, r *http.Request) {
+	h.patchMetadata(w, r, (*k8s.Client).PatchLabels)
+}
+
+// PatchAnnotations sets or removes annotations on an object, like
+// PatchLabels
+func (h *Handler) PatchAnnotations(w http.ResponseWriter, r *http.Request) {
+	h.patchMetadata(w, r, (*k8s.Client).PatchAnnotations)
+}
+
+type metadataPatchFunc func(c *k8s.Client, ctx context.Context, namespace, kind, name string, patch k8s.MetadataPatch) (*k8s.MetadataPatchResult, error)
+
+func (h *Handler) patchMetadata(w http.ResponseWriter, r *http.Request, patch metadataPatchFunc) {
+	dryRun, ok := h.checkWrite(w, r)
+	if !ok {
+		return
+	}
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+	kind := chi.URLParam(r, "kind")
+	name := chi.URLParam(r, "name")
+
+	var values map[string]*string
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMetadataPatchBytes)).Decode(&values); err != nil {
+		h.error(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %v", err))
+		return
+	}
+	if len(values) == 0 {
+		h.error(w, http.StatusBadRequest, "body must name at least one key")
+		return
+	}
+
+	result, err := patch(client, r.Context(), namespace, kind, name, k8s.MetadataPatch{
+		Values:          values,
+		ResourceVersion: r.URL.Query().Get("resourceVersion"),
+		DryRun:          dryRun,
+	})
+	if err != nil {
+		status := writeErrorStatus(err)
+		if errors.Is(err, k8s.ErrUnsupportedKind) || apierrors.IsInvalid(err) || apierrors.IsBadRequest(err) {
+			status = http.StatusBadRequest
+		}
+		h.error(w, status, err.Error())
+		return
+	}
+
+	h.json(w, result)
+}
+
+// GetDeployments returns deployments in a namespace
+func (h *Handler) GetDeployments(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+
+	deployments, err := client.GetDeployments(r.Context(), namespace)
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.json(w, deployments)
+}
+
+// GetDeployment returns deployment details, including its ReplicaSets
+func (h *Handler) GetDeployment(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+	name := chi.URLParam(r, "name")
+
+	deployment, err := client.GetDeployment(r.Context(), namespace, name)
+	if err != nil {
+		h.error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.json(w, deployment)
+}
+
+// GetReplicaSets returns the ReplicaSets owned by a deployment
+func (h *Handler) GetReplicaSets(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+	name := chi.URLParam(r, "name")
+
+	replicaSets, err := client.GetReplicaSets(r.Context(), namespace, name)
+	if err != nil {
+		h.error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	h.json(w, replicaSets)
+}
+
+// RestartDeployment restarts a deployment
+func (h *Handler) RestartDeployment(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := h.checkWrite(w, r)
+	if !ok {
+		return
+	}
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+	name := chi.URLParam(r, "name")
+
+	deployment, err := client.RestartDeployment(r.Context(), namespace, name, r.URL.Query().Get("resourceVersion"), dryRun)
+	if err != nil {
+		h.error(w, writeErrorStatus(err), err.Error())
+		return
+	}
+
+	h.json(w, map[string]interface{}{
+		"status":     "restarted",
+		"dryRun":     dryRun,
+		"deployment": deployment,
+	})
+}
+
+// RestartAllDeployments restarts every deployment in a namespace
+func (h *Handler) RestartAllDeployments(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := h.checkWrite(w, r)
+	if !ok {
+		return
+	}
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+
+	result, err := client.RestartAllDeployments(r.Context(), namespace, dryRun)
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.json(w, result)
+}
+
+// CordonNode marks a node as unschedulable
+func (h *Handler) CordonNode(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := h.checkWrite(w, r)
+	if !ok {
+		return
+	}
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+
+	if err := client.CordonNode(r.Context(), name, dryRun); err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.json(w, map[string]interface{}{"status": "cordoned", "name": name, "dryRun": dryRun})
+}
+
+// UncordonNode marks a node as schedulable
+func (h *Handler) UncordonNode(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := h.checkWrite(w, r)
+	if !ok {
+		return
+	}
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+
+	if err := client.UncordonNode(r.Context(), name, dryRun); err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.json(w, map[string]interface{}{"status": "uncordoned", "name": name, "dryRun": dryRun})
+}
+
+// DrainNode cordons a node and evicts its pods
+func (h *Handler) DrainNode(w http.ResponseWriter, r *http.Request) {
+	dryRun, ok := h.checkWrite(w, r)
+	if !ok {
+		return
+	}
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	name := chi.URLParam(r, "name")
+
+	result, err := client.DrainNode(r.Context(), name, dryRun)
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.json(w, result)
+}
+
+// GetServices returns services in a namespace
+func (h *Handler) GetServices(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+
+	services, err := client.GetServices(r.Context(), namespace)
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.json(w, services)
+}
+
+// GetService returns a service with its selector and backing endpoints
+func (h *Handler) GetService(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+	name := chi.URLParam(r, "name")
+
+	service, err := client.GetService(r.Context(), namespace, name)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if apierrors.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		h.error(w, status, err.Error())
+		return
+	}
+
+	h.json(w, service)
+}
+
+// GetEndpoints returns the ready and not-ready addresses behind a service
+func (h *Handler) GetEndpoints(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+	name := chi.URLParam(r, "name")
+
+	endpoints, err := client.GetEndpoints(r.Context(), namespace, name)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if apierrors.IsNotFound(err) {
+			status = http.StatusNotFound
+		}
+		h.error(w, status, err.Error())
+		return
+	}
+
+	h.json(w, endpoints)
+}
+
+// GetHPAs returns the horizontal pod autoscalers in a namespace
+func (h *Handler) GetHPAs(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+
+	hpas, err := client.GetHPAs(r.Context(), namespace)
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.json(w, hpas)
+}
+
+// GetEvents returns events in a namespace
+func (h *Handler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+
+	var opts k8s.EventOptions
+	if since := r.URL.Query().Get("since"); since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil || d < 0 {
+			h.error(w, http.StatusBadRequest, "invalid since duration: "+since)
+			return
+		}
+		opts.Since = d
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			h.error(w, http.StatusBadRequest, "invalid limit: "+limit)
+			return
+		}
+		opts.Limit = n
+	}
+
+	events, err := client.GetEvents(r.Context(), namespace, opts)
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.json(w, events)
+}
+
+// StreamEvents streams a namespace's events as Server-Sent Events while they
+// happen. Each message's id is the event's resourceVersion, so a client
+// reconnecting with Last-Event-ID resumes where it left off.
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.error(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	updates, err := client.WatchEvents(r.Context(), namespace, r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for update := range updates {
+		data, err := json.Marshal(update.Event)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(w, "id: %s\ndata: %s\n\n", update.ResourceVersion, data)
+		flusher.Flush()
+	}
+}
+
+// DiffManifest compares a YAML manifest in the request body with the live
+// object. It only dry-runs the apply, so it works without write mode.
+func (h *Handler) DiffManifest(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	manifest, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxManifestBytes))
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	diff, err := client.DiffManifest(r.Context(), manifest)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, k8s.ErrInvalidManifest) || apierrors.IsInvalid(err) || apierrors.IsBadRequest(err) {
+			status = http.StatusBadRequest
+		}
+		h.error(w, status, err.Error())
+		return
+	}
+
+	h.json(w, diff)
+}
+
+// GetObjectEvents returns events for a single object in a namespace
+func (h *Handler) GetObjectEvents(w http.ResponseWriter, r *http.Request) {
+	client, ok := h.client(w, r)
+	if !ok {
+		return
+	}
+
+	namespace := chi.URLParam(r, "namespace")
+	kind := chi.URLParam(r, "kind")
+	name := chi.URLParam(r, "name")
+
+	events, err := client.GetEventsForObject(r.Context(), namespace, kind, name)
+	if err != nil {
+		h.error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.json(w, events)
+}
+
+// Helper methods
+
+// client returns the cluster client for a request: the one for ?context=
+// when given, otherwise the active context's. Targeting a context this way
+// doesn't change the active context for other requests.
+func (h *Handler) client(w http.ResponseWriter, r *http.Request) (*k8s.Client, bool) {
+	name := r.URL.Query().Get("context")
+	if name == "" {
+		return h.k8s, true
+	}
+
+	client, err := h.clusters.Get(name)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return client, true
+}
+
+// checkWrite reports whether a mutating request may proceed and whether it
+// asked for ?dryRun=true. Dry runs are allowed without write mode since the
+// cluster is never changed, which lets operators preview actions first.
+func (h *Handler) checkWrite(w http.ResponseWriter, r *http.Request) (dryRun bool, ok bool) {
+	dryRun = r.URL.Query().Get("dryRun") == "true"
+	if !h.writeMode && !dryRun {
+		h.error(w, http.StatusForbidden, "write mode is disabled")
+		return false, false
+	}
+	return dryRun, true
+}
+
+// writeErrorStatus maps a failed write on a single object to its HTTP
+// status: 404 when the object is missing, 409 when it changed since the
+// ?resourceVersion= the write was based on, and 500 otherwise
+func writeErrorStatus(err error) int {
+	switch {
+	case apierrors.IsNotFound(err):
+		return http.StatusNotFound
+	case apierrors.IsConflict(err):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
 
 func (h *Handler) json(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
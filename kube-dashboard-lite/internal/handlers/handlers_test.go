@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog"
+
+	"github.com/yourorg/kube-dashboard-lite/internal/k8s"
+)
+
+// recordingCluster answers every request with a node and records the
+// methods it was sent
+type recordingCluster struct {
+	*httptest.Server
+	mu      sync.Mutex
+	methods []string
+}
+
+func newRecordingCluster() *recordingCluster {
+	c := &recordingCluster{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		c.methods = append(c.methods, r.Method)
+		c.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"kind":"Node","apiVersion":"v1","metadata":{"name":"n1"}}`)
+	}))
+	return c
+}
+
+func (c *recordingCluster) requests() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.methods...)
+}
+
+func TestWriteTargetsRequestedContext(t *testing.T) {
+	east, west := newRecordingCluster(), newRecordingCluster()
+	defer east.Close()
+	defer west.Close()
+
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: east
+clusters:
+- name: east
+  cluster: {server: %q}
+- name: west
+  cluster: {server: %q}
+users:
+- name: user
+  user: {token: t}
+contexts:
+- name: east
+  context: {cluster: east, user: user}
+- name: west
+  context: {cluster: west, user: user}
+`, east.URL, west.URL)
+
+	client, err := k8s.NewClient(k8s.ClientOptions{KubeconfigData: []byte(kubeconfig)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(client, true, time.Second, zerolog.Nop())
+	r := chi.NewRouter()
+	r.Post("/nodes/{name}/cordon", h.CordonNode)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/nodes/n1/cordon?context=west", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if got := west.requests(); len(got) != 1 || got[0] != http.MethodPatch {
+		t.Errorf("west received %v, want one PATCH", got)
+	}
+	if got := east.requests(); len(got) != 0 {
+		t.Errorf("active context east received %v, want nothing", got)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/nodes/n1/cordon?context=missing", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown context status = %d, want 400", rec.Code)
+	}
+}
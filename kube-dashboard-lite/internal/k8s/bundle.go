@@ -0,0 +1,178 @@
+package k8s
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Limits on the logs included in a bundle, per container
+const (
+	bundleLogLines    = 500
+	bundleLogMaxBytes = 1 << 20
+)
+
+// redactedValue replaces env values that look like credentials in a bundle
+const redactedValue = "[REDACTED]"
+
+// sensitiveEnvName matches env var names whose literal values are likely
+// credentials. Values from secretKeyRef are never included in the first
+// place; this catches secrets set inline in the pod spec.
+var sensitiveEnvName = regexp.MustCompile(`(?i)(pass|secret|token|key|credential|auth|cert)`)
+
+// WriteBundle writes a gzipped tarball of a namespace's state to w, for
+// attaching to support cases: pods (with container details), deployments,
+// services, events, and the recent logs of every container. Secrets are not
+// collected and credential-looking env values are redacted. Sections that
+// fail are listed in errors.txt rather than aborting the bundle, since w may
+// already be partially written.
+func (c *Client) WriteBundle(ctx context.Context, namespace string, w io.Writer) error {
+	cs := c.kube()
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	b := &bundleWriter{tw: tw, dir: namespace, modTime: time.Now()}
+
+	if pods, err := cs.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{}); err != nil {
+		b.fail("pods", err)
+	} else {
+		var details []*PodDetail
+		for i := range pods.Items {
+			detail := podToDetail(&pods.Items[i])
+			redactPodEnv(detail)
+			details = append(details, detail)
+		}
+		b.writeJSON("pods.json", details)
+		b.writeLogs(ctx, cs, pods.Items)
+	}
+
+	if deployments, err := cs.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{}); err != nil {
+		b.fail("deployments", err)
+	} else {
+		var infos []DeploymentInfo
+		for i := range deployments.Items {
+			infos = append(infos, deploymentToInfo(&deployments.Items[i]))
+		}
+		b.writeJSON("deployments.json", infos)
+	}
+
+	if services, err := cs.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{}); err != nil {
+		b.fail("services", err)
+	} else {
+		var infos []ServiceInfo
+		for i := range services.Items {
+			infos = append(infos, serviceToInfo(&services.Items[i]))
+		}
+		b.writeJSON("services.json", infos)
+	}
+
+	if events, err := cs.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{}); err != nil {
+		b.fail("events", err)
+	} else {
+		b.writeJSON("events.json", eventsToInfo(events.Items))
+	}
+
+	if len(b.errors) > 0 {
+		b.writeFile("errors.txt", []byte(strings.Join(b.errors, "\n")+"\n"))
+	}
+
+	if b.err != nil {
+		return b.err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// bundleWriter adds files under dir to a tarball, remembering the first
+// write error and any sections that couldn't be collected
+type bundleWriter struct {
+	tw      *tar.Writer
+	dir     string
+	modTime time.Time
+	errors  []string
+	err     error
+}
+
+func (b *bundleWriter) fail(section string, err error) {
+	b.errors = append(b.errors, fmt.Sprintf("%s: %v", section, err))
+}
+
+func (b *bundleWriter) writeJSON(name string, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		b.fail(name, err)
+		return
+	}
+	b.writeFile(name, data)
+}
+
+func (b *bundleWriter) writeFile(name string, data []byte) {
+	if b.err != nil {
+		return
+	}
+
+	hdr := &tar.Header{
+		Name:    path.Join(b.dir, name),
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: b.modTime,
+	}
+	if err := b.tw.WriteHeader(hdr); err != nil {
+		b.err = err
+		return
+	}
+	if _, err := b.tw.Write(data); err != nil {
+		b.err = err
+	}
+}
+
+// writeLogs adds the last bundleLogLines lines of each container's log as
+// logs/<pod>/<container>.log
+func (b *bundleWriter) writeLogs(ctx context.Context, cs *kubernetes.Clientset, pods []corev1.Pod) {
+	tail := int64(bundleLogLines)
+	for _, pod := range pods {
+		for _, container := range pod.Spec.Containers {
+			name := path.Join("logs", pod.Name, container.Name+".log")
+
+			stream, err := cs.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+				Container: container.Name,
+				TailLines: &tail,
+			}).Stream(ctx)
+			if err != nil {
+				b.fail(name, err)
+				continue
+			}
+
+			data, err := io.ReadAll(io.LimitReader(stream, bundleLogMaxBytes))
+			stream.Close()
+			if err != nil {
+				b.fail(name, err)
+				continue
+			}
+			b.writeFile(name, data)
+		}
+	}
+}
+
+func redactPodEnv(detail *PodDetail) {
+	for i := range detail.Containers {
+		for j, env := range detail.Containers[i].Env {
+			if env.Value != "" && sensitiveEnvName.MatchString(env.Name) {
+				detail.Containers[i].Env[j].Value = redactedValue
+			}
+		}
+	}
+}
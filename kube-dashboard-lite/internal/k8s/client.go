@@ -7,34 +7,74 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// InClusterContext is the context reported when the dashboard runs in a pod
+// without a kubeconfig and talks to its own cluster as its service account
+const InClusterContext = "in-cluster"
+
 // Client wraps the Kubernetes client with convenience methods
 type Client struct {
-	clientset     *kubernetes.Clientset
-	config        *rest.Config
+	clientset      *kubernetes.Clientset
+	config         *rest.Config
 	currentContext string
-	kubeconfig    string
+
+	// Where the config came from: a kubeconfig path, an uploaded kubeconfig
+	// held only in memory, or the pod's service account
+	kubeconfig     string
+	kubeconfigData []byte
+	inCluster      bool
+
+	// mu guards every field above, which SwitchContext and LoadKubeconfig
+	// replace while other requests may be in flight
+	mu sync.RWMutex
+
+	// summaryFeeds share informers between the namespace summary streams
+	// of each cluster and namespace
+	summaryMu    sync.Mutex
+	summaryFeeds map[summaryFeedKey]*summaryFeed
 }
 
 // ClientOptions for creating a new client
 type ClientOptions struct {
 	Kubeconfig string
 	Context    string
+
+	// KubeconfigData, when set, is used instead of reading a kubeconfig file
+	KubeconfigData []byte
 }
 
-// NewClient creates a new Kubernetes client
+// NewClient creates a new Kubernetes client. Without an explicit or default
+// kubeconfig it falls back to the in-cluster config when running in a pod.
 func NewClient(opts ClientOptions) (*Client, error) {
+	if opts.KubeconfigData != nil {
+		return newClientFromData(opts.KubeconfigData, opts.Context)
+	}
+
 	kubeconfig := opts.Kubeconfig
 	if kubeconfig == "" {
 		kubeconfig = defaultKubeconfig()
+		if _, err := os.Stat(kubeconfig); os.IsNotExist(err) {
+			if config, err := rest.InClusterConfig(); err == nil {
+				return newInClusterClient(config, opts.Context)
+			}
+		}
 	}
 
 	// Build config from kubeconfig
@@ -47,6 +87,36 @@ func NewClient(opts ClientOptions) (*Client, error) {
 
 	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
 
+	client, err := newClientFromConfig(kubeConfig, opts.Context)
+	if err != nil {
+		return nil, err
+	}
+	client.kubeconfig = kubeconfig
+
+	return client, nil
+}
+
+func newClientFromData(data []byte, contextName string) (*Client, error) {
+	rawConfig, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKubeconfig, err)
+	}
+	if err := checkUploadedKubeconfig(rawConfig); err != nil {
+		return nil, err
+	}
+
+	kubeConfig := clientcmd.NewNonInteractiveClientConfig(*rawConfig, contextName, &clientcmd.ConfigOverrides{}, nil)
+
+	client, err := newClientFromConfig(kubeConfig, contextName)
+	if err != nil {
+		return nil, err
+	}
+	client.kubeconfigData = data
+
+	return client, nil
+}
+
+func newClientFromConfig(kubeConfig clientcmd.ClientConfig, contextName string) (*Client, error) {
 	config, err := kubeConfig.ClientConfig()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build config: %w", err)
@@ -57,16 +127,36 @@ func NewClient(opts ClientOptions) (*Client, error) {
 		return nil, fmt.Errorf("failed to create clientset: %w", err)
 	}
 
-	rawConfig, err := kubeConfig.RawConfig()
+	if contextName == "" {
+		rawConfig, err := kubeConfig.RawConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get raw config: %w", err)
+		}
+		contextName = rawConfig.CurrentContext
+	}
+
+	return &Client{
+		clientset:      clientset,
+		config:         config,
+		currentContext: contextName,
+	}, nil
+}
+
+func newInClusterClient(config *rest.Config, contextName string) (*Client, error) {
+	if contextName != "" && contextName != InClusterContext {
+		return nil, fmt.Errorf("context %q not found: running in-cluster without a kubeconfig", contextName)
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get raw config: %w", err)
+		return nil, fmt.Errorf("failed to create clientset: %w", err)
 	}
 
 	return &Client{
 		clientset:      clientset,
 		config:         config,
-		currentContext: rawConfig.CurrentContext,
-		kubeconfig:     kubeconfig,
+		currentContext: InClusterContext,
+		inCluster:      true,
 	}, nil
 }
 
@@ -78,23 +168,53 @@ func defaultKubeconfig() string {
 	return filepath.Join(home, ".kube", "config")
 }
 
+// options returns the options that recreate this client's config source for
+// another context
+func (c *Client) options(contextName string) ClientOptions {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return ClientOptions{
+		Kubeconfig:     c.kubeconfig,
+		KubeconfigData: c.kubeconfigData,
+		Context:        contextName,
+	}
+}
+
 // GetContexts returns available kubeconfig contexts
 func (c *Client) GetContexts() ([]ContextInfo, error) {
-	loadingRules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: c.kubeconfig}
-	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{})
+	c.mu.RLock()
+	inCluster, kubeconfig, data := c.inCluster, c.kubeconfig, c.kubeconfigData
+	c.mu.RUnlock()
+
+	if inCluster {
+		return []ContextInfo{{Name: InClusterContext, IsCurrent: true}}, nil
+	}
+
+	var kubeConfig clientcmd.ClientConfig
+	if data != nil {
+		rawConfig, err := clientcmd.Load(data)
+		if err != nil {
+			return nil, err
+		}
+		kubeConfig = clientcmd.NewNonInteractiveClientConfig(*rawConfig, "", &clientcmd.ConfigOverrides{}, nil)
+	} else {
+		loadingRules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig}
+		kubeConfig = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{})
+	}
 
 	rawConfig, err := kubeConfig.RawConfig()
 	if err != nil {
 		return nil, err
 	}
 
+	current := c.CurrentContext()
 	var contexts []ContextInfo
 	for name, ctx := range rawConfig.Contexts {
 		contexts = append(contexts, ContextInfo{
 			Name:      name,
 			Cluster:   ctx.Cluster,
 			Namespace: ctx.Namespace,
-			IsCurrent: name == rawConfig.CurrentContext,
+			IsCurrent: name == current,
 		})
 	}
 
@@ -107,39 +227,78 @@ func (c *Client) GetContexts() ([]ContextInfo, error) {
 
 // SwitchContext switches to a different context
 func (c *Client) SwitchContext(contextName string) error {
-	newClient, err := NewClient(ClientOptions{
-		Kubeconfig: c.kubeconfig,
-		Context:    contextName,
-	})
+	newClient, err := NewClient(c.options(contextName))
 	if err != nil {
 		return err
 	}
 
-	c.clientset = newClient.clientset
-	c.config = newClient.config
-	c.currentContext = contextName
+	c.replace(newClient)
+	return nil
+}
 
+// LoadKubeconfig replaces the client's config with an uploaded kubeconfig,
+// switching to contextName or, when empty, the kubeconfig's current context.
+// The kubeconfig is kept in memory only and is lost on restart.
+func (c *Client) LoadKubeconfig(data []byte, contextName string) error {
+	newClient, err := newClientFromData(data, contextName)
+	if err != nil {
+		return err
+	}
+
+	c.replace(newClient)
 	return nil
 }
 
+// ValidateKubeconfig checks that an uploaded kubeconfig is usable with
+// LoadKubeconfig without changing the client
+func ValidateKubeconfig(data []byte, contextName string) error {
+	_, err := newClientFromData(data, contextName)
+	return err
+}
+
+func (c *Client) replace(newClient *Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clientset = newClient.clientset
+	c.config = newClient.config
+	c.currentContext = newClient.currentContext
+	c.kubeconfig = newClient.kubeconfig
+	c.kubeconfigData = newClient.kubeconfigData
+	c.inCluster = newClient.inCluster
+}
+
 // CurrentContext returns the current context name
 func (c *Client) CurrentContext() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.currentContext
 }
 
+// kube returns the clientset for the current context. Methods making several
+// API calls should take it once so a concurrent SwitchContext can't split
+// them across clusters.
+func (c *Client) kube() *kubernetes.Clientset {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.clientset
+}
+
 // GetNamespaces returns all namespaces
 func (c *Client) GetNamespaces(ctx context.Context) ([]NamespaceInfo, error) {
-	list, err := c.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	list, err := c.kube().CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	var namespaces []NamespaceInfo
 	for _, ns := range list.Items {
+		age := time.Since(ns.CreationTimestamp.Time)
 		namespaces = append(namespaces, NamespaceInfo{
-			Name:   ns.Name,
-			Status: string(ns.Status.Phase),
-			Age:    time.Since(ns.CreationTimestamp.Time),
+			Name:     ns.Name,
+			Status:   string(ns.Status.Phase),
+			Age:      age,
+			AgeHuman: humanDuration(age),
 		})
 	}
 
@@ -147,8 +306,13 @@ func (c *Client) GetNamespaces(ctx context.Context) ([]NamespaceInfo, error) {
 }
 
 // GetPods returns pods in a namespace
-func (c *Client) GetPods(ctx context.Context, namespace string) ([]PodInfo, error) {
-	list, err := c.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+func (c *Client) GetPods(ctx context.Context, namespace string, opts PodOptions) ([]PodInfo, error) {
+	listOpts := metav1.ListOptions{}
+	if opts.Node != "" {
+		listOpts.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", opts.Node).String()
+	}
+
+	list, err := c.kube().CoreV1().Pods(namespace).List(ctx, listOpts)
 	if err != nil {
 		return nil, err
 	}
@@ -161,21 +325,119 @@ func (c *Client) GetPods(ctx context.Context, namespace string) ([]PodInfo, erro
 	return pods, nil
 }
 
+// WatchPods watches pod changes in a namespace
+func (c *Client) WatchPods(ctx context.Context, namespace string) (watch.Interface, error) {
+	return c.kube().CoreV1().Pods(namespace).Watch(ctx, metav1.ListOptions{})
+}
+
+// WatchRollout streams the rollout status of a deployment. The current status
+// is sent first; the channel is closed when the watch ends or ctx is done.
+func (c *Client) WatchRollout(ctx context.Context, namespace, name string) (<-chan RolloutStatus, error) {
+	cs := c.kube()
+
+	// Fail fast on a missing deployment rather than watching for nothing
+	if _, err := cs.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{}); err != nil {
+		return nil, err
+	}
+
+	watcher, err := cs.AppsV1().Deployments(namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make(chan RolloutStatus)
+	go func() {
+		defer close(statuses)
+		defer watcher.Stop()
+
+		for event := range watcher.ResultChan() {
+			deployment, ok := event.Object.(*appsv1.Deployment)
+			if !ok {
+				continue
+			}
+			select {
+			case statuses <- rolloutStatus(deployment):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return statuses, nil
+}
+
 // GetPod returns a single pod
 func (c *Client) GetPod(ctx context.Context, namespace, name string) (*PodDetail, error) {
-	pod, err := c.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	cs := c.kube()
+
+	pod, err := cs.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	return podToDetail(pod), nil
+	detail := podToDetail(pod)
+	detail.OwnerChain = ownerChain(ctx, cs, pod)
+
+	// Probe failures and restart events are a diagnostic extra; the pod is
+	// still worth returning if events can't be listed
+	events, err := cs.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.kind": "Pod",
+			"involvedObject.name": name,
+		}.AsSelector().String(),
+	})
+	if err == nil {
+		attachPodEvents(detail, pod, events.Items)
+	}
+
+	return detail, nil
+}
+
+// attachPodEvents adds what a pod's events say about its containers: probe
+// failures and restarts
+func attachPodEvents(detail *PodDetail, pod *corev1.Pod, events []corev1.Event) {
+	var unhealthy []corev1.Event
+	for _, e := range events {
+		if e.Reason == "Unhealthy" {
+			unhealthy = append(unhealthy, e)
+		}
+	}
+	attachProbeFailures(detail, unhealthy)
+	detail.RestartTimeline = restartTimeline(pod, events)
+}
+
+// maxProbeFailures caps the Unhealthy events kept per container
+const maxProbeFailures = 5
+
+// attachProbeFailures assigns a pod's Unhealthy events to the containers
+// they name in their field path, e.g. "spec.containers{app}"
+func attachProbeFailures(detail *PodDetail, events []corev1.Event) {
+	byContainer := make(map[string][]corev1.Event)
+	for _, e := range events {
+		path := e.InvolvedObject.FieldPath
+		if name, ok := strings.CutPrefix(path, "spec.containers{"); ok {
+			name = strings.TrimSuffix(name, "}")
+			byContainer[name] = append(byContainer[name], e)
+		}
+	}
+
+	for i := range detail.Containers {
+		failures := eventsToInfo(byContainer[detail.Containers[i].Name])
+		if len(failures) > maxProbeFailures {
+			failures = failures[:maxProbeFailures]
+		}
+		detail.Containers[i].ProbeFailures = failures
+	}
 }
 
 // GetPodLogs returns logs for a pod
 func (c *Client) GetPodLogs(ctx context.Context, namespace, name, container string, opts LogOptions) (io.ReadCloser, error) {
 	podLogOpts := &corev1.PodLogOptions{
-		Container: container,
-		Follow:    opts.Follow,
+		Container:  container,
+		Follow:     opts.Follow,
+		Timestamps: opts.Timestamps,
 	}
 
 	if opts.TailLines > 0 {
@@ -188,94 +450,376 @@ func (c *Client) GetPodLogs(ctx context.Context, namespace, name, container stri
 		podLogOpts.SinceSeconds = &seconds
 	}
 
-	req := c.clientset.CoreV1().Pods(namespace).GetLogs(name, podLogOpts)
+	req := c.kube().CoreV1().Pods(namespace).GetLogs(name, podLogOpts)
 	return req.Stream(ctx)
 }
 
 // GetDeployments returns deployments in a namespace
 func (c *Client) GetDeployments(ctx context.Context, namespace string) ([]DeploymentInfo, error) {
-	list, err := c.clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	list, err := c.kube().AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	var deployments []DeploymentInfo
 	for _, d := range list.Items {
-		deployments = append(deployments, DeploymentInfo{
-			Name:            d.Name,
-			Namespace:       d.Namespace,
-			Replicas:        *d.Spec.Replicas,
-			ReadyReplicas:   d.Status.ReadyReplicas,
-			UpdatedReplicas: d.Status.UpdatedReplicas,
-			Age:             time.Since(d.CreationTimestamp.Time),
-			Labels:          d.Labels,
-		})
+		deployments = append(deployments, deploymentToInfo(&d))
 	}
 
 	return deployments, nil
 }
 
+// GetDeployment returns a deployment with the ReplicaSets it owns
+func (c *Client) GetDeployment(ctx context.Context, namespace, name string) (*DeploymentDetail, error) {
+	cs := c.kube()
+
+	deployment, err := cs.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	replicaSets, err := ownedReplicaSets(ctx, cs, deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeploymentDetail{
+		DeploymentInfo:  deploymentToInfo(deployment),
+		ReplicaSets:     replicaSets,
+		ResourceVersion: deployment.ResourceVersion,
+	}, nil
+}
+
+// GetReplicaSets returns the ReplicaSets owned by a deployment, newest
+// revision first. Old ReplicaSets that still have replicas point at a
+// rollout that isn't scaling down.
+func (c *Client) GetReplicaSets(ctx context.Context, namespace, deploymentName string) ([]ReplicaSetInfo, error) {
+	cs := c.kube()
+
+	deployment, err := cs.AppsV1().Deployments(namespace).Get(ctx, deploymentName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return ownedReplicaSets(ctx, cs, deployment)
+}
+
+func ownedReplicaSets(ctx context.Context, cs *kubernetes.Clientset, deployment *appsv1.Deployment) ([]ReplicaSetInfo, error) {
+	list, err := cs.AppsV1().ReplicaSets(deployment.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	replicaSets := []ReplicaSetInfo{}
+	for _, rs := range list.Items {
+		if !metav1.IsControlledBy(&rs, deployment) {
+			continue
+		}
+
+		desired := int32(0)
+		if rs.Spec.Replicas != nil {
+			desired = *rs.Spec.Replicas
+		}
+
+		age := time.Since(rs.CreationTimestamp.Time)
+		replicaSets = append(replicaSets, ReplicaSetInfo{
+			Name:            rs.Name,
+			Revision:        rs.Annotations["deployment.kubernetes.io/revision"],
+			PodTemplateHash: rs.Labels[appsv1.DefaultDeploymentUniqueLabelKey],
+			Desired:         desired,
+			Ready:           rs.Status.ReadyReplicas,
+			Available:       rs.Status.AvailableReplicas,
+			Age:             age,
+			AgeHuman:        humanDuration(age),
+		})
+	}
+
+	// Sort by age, youngest (newest revision) first
+	sort.Slice(replicaSets, func(i, j int) bool {
+		return replicaSets[i].Age < replicaSets[j].Age
+	})
+
+	return replicaSets, nil
+}
+
 // GetServices returns services in a namespace
 func (c *Client) GetServices(ctx context.Context, namespace string) ([]ServiceInfo, error) {
-	list, err := c.clientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	list, err := c.kube().CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	var services []ServiceInfo
 	for _, s := range list.Items {
-		var ports []string
-		for _, p := range s.Spec.Ports {
-			ports = append(ports, fmt.Sprintf("%d/%s", p.Port, p.Protocol))
-		}
-
-		services = append(services, ServiceInfo{
-			Name:       s.Name,
-			Namespace:  s.Namespace,
-			Type:       string(s.Spec.Type),
-			ClusterIP:  s.Spec.ClusterIP,
-			ExternalIP: getExternalIP(&s),
-			Ports:      ports,
-			Age:        time.Since(s.CreationTimestamp.Time),
-		})
+		services = append(services, serviceToInfo(&s))
 	}
 
 	return services, nil
 }
 
-// GetEvents returns events in a namespace
-func (c *Client) GetEvents(ctx context.Context, namespace string) ([]EventInfo, error) {
-	list, err := c.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
+// GetEvents returns events in a namespace, most recent first
+func (c *Client) GetEvents(ctx context.Context, namespace string, opts EventOptions) ([]EventInfo, error) {
+	list, err := c.kube().CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	var events []EventInfo
-	for _, e := range list.Items {
-		events = append(events, EventInfo{
-			Type:      e.Type,
-			Reason:    e.Reason,
-			Message:   e.Message,
-			Object:    fmt.Sprintf("%s/%s", e.InvolvedObject.Kind, e.InvolvedObject.Name),
-			Count:     e.Count,
-			FirstSeen: e.FirstTimestamp.Time,
-			LastSeen:  e.LastTimestamp.Time,
+	events := eventsToInfo(list.Items)
+
+	if opts.Since > 0 {
+		cutoff := time.Now().Add(-opts.Since)
+		// Sorted newest first, so stop at the first event older than the cutoff
+		n := sort.Search(len(events), func(i int) bool {
+			return events[i].LastSeen.Before(cutoff)
 		})
+		events = events[:n]
 	}
 
-	// Sort by last seen, most recent first
-	sort.Slice(events, func(i, j int) bool {
-		return events[i].LastSeen.After(events[j].LastSeen)
-	})
+	if opts.Limit > 0 && len(events) > opts.Limit {
+		events = events[:opts.Limit]
+	}
 
 	return events, nil
 }
 
-// RestartDeployment performs a rollout restart
-func (c *Client) RestartDeployment(ctx context.Context, namespace, name string) error {
-	deployment, err := c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+// GetEventsForObject returns events in a namespace for a single involved object
+func (c *Client) GetEventsForObject(ctx context.Context, namespace, kind, name string) ([]EventInfo, error) {
+	selector := fields.Set{
+		"involvedObject.kind": kindForResource(kind),
+		"involvedObject.name": name,
+	}.AsSelector().String()
+
+	list, err := c.kube().CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: selector,
+	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return eventsToInfo(list.Items), nil
+}
+
+// GetNamespaceSummary returns resource counts for a namespace
+func (c *Client) GetNamespaceSummary(ctx context.Context, namespace string) (*NamespaceSummary, error) {
+	cs := c.kube()
+
+	pods, err := cs.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	deployments, err := cs.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	services, err := cs.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := cs.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &NamespaceSummary{
+		Namespace:   namespace,
+		Pods:        len(pods.Items),
+		PodsByPhase: podPhaseCounts(pods.Items),
+		Deployments: len(deployments.Items),
+		Services:    len(services.Items),
+		Events:      len(events.Items),
+	}
+
+	return summary, nil
+}
+
+// DeletePod deletes a pod and returns what was deleted. With dryRun the
+// request is validated server-side but nothing is removed.
+func (c *Client) DeletePod(ctx context.Context, namespace, name string, opts DeletePodOptions) (*DeletePodResult, error) {
+	cs := c.kube()
+
+	pod, err := cs.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	err = cs.CoreV1().Pods(namespace).Delete(ctx, name, podDeleteOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DeletePodResult{
+		Pod:    podToInfo(pod),
+		DryRun: opts.DryRun,
+		Force:  opts.Force,
+	}
+	if ref := metav1.GetControllerOf(pod); ref != nil {
+		result.Owner = &OwnerInfo{Kind: ref.Kind, Name: ref.Name}
+		result.WillBeRecreated = recreatingControllers[ref.Kind]
+	}
+
+	return result, nil
+}
+
+// deleteWorkers bounds concurrent deletions in DeletePodsByLabel
+const deleteWorkers = 5
+
+// DeletePodsByLabel deletes every pod in a namespace matching a label
+// selector. An empty selector is refused since it would match every pod.
+// Deletions run concurrently and a failure doesn't stop the rest;
+// per-pod errors are collected in the result.
+func (c *Client) DeletePodsByLabel(ctx context.Context, namespace, selector string, opts DeletePodOptions) (*DeletePodsResult, error) {
+	if strings.TrimSpace(selector) == "" {
+		return nil, fmt.Errorf("a label selector is required")
+	}
+
+	cs := c.kube()
+
+	list, err := cs.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DeletePodsResult{
+		Namespace: namespace,
+		Selector:  selector,
+		Deleted:   []string{},
+		Failed:    make(map[string]string),
+		DryRun:    opts.DryRun,
+		Force:     opts.Force,
+	}
+
+	deleteOpts := podDeleteOptions(opts)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	names := make(chan string)
+
+	for i := 0; i < min(deleteWorkers, len(list.Items)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				err := cs.CoreV1().Pods(namespace).Delete(ctx, name, deleteOpts)
+
+				mu.Lock()
+				switch {
+				case err == nil:
+					result.Deleted = append(result.Deleted, name)
+				case !apierrors.IsNotFound(err):
+					result.Failed[name] = err.Error()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, pod := range list.Items {
+		names <- pod.Name
+	}
+	close(names)
+	wg.Wait()
+
+	sort.Strings(result.Deleted)
+	result.DeletedCount = len(result.Deleted)
+	result.FailedCount = len(result.Failed)
+	return result, nil
+}
+
+func podDeleteOptions(opts DeletePodOptions) metav1.DeleteOptions {
+	deleteOpts := metav1.DeleteOptions{
+		DryRun:        dryRunOption(opts.DryRun),
+		Preconditions: resourceVersionPrecondition(opts.ResourceVersion),
+	}
+	if opts.Force {
+		var grace int64
+		deleteOpts.GracePeriodSeconds = &grace
+	}
+	return deleteOpts
+}
+
+// recreatingControllers are the built-in controller kinds that replace a
+// deleted pod. Pods owned by other controllers may or may not come back.
+var recreatingControllers = map[string]bool{
+	"ReplicaSet":            true,
+	"ReplicationController": true,
+	"StatefulSet":           true,
+	"DaemonSet":             true,
+	"Job":                   true,
+}
+
+// RestartDeployment performs a rollout restart and returns the updated
+// deployment. With dryRun the update is validated server-side only. A
+// non-empty resourceVersion makes the restart fail with a conflict if the
+// deployment has changed since it was read at that version.
+func (c *Client) RestartDeployment(ctx context.Context, namespace, name, resourceVersion string, dryRun bool) (*DeploymentInfo, error) {
+	return restartDeployment(ctx, c.kube(), namespace, name, resourceVersion, dryRun)
+}
+
+// restartWorkers bounds concurrent restarts in RestartAllDeployments
+const restartWorkers = 5
+
+// RestartAllDeployments performs a rollout restart of every deployment in a
+// namespace. Restarts run concurrently and a failure doesn't stop the rest;
+// per-deployment errors are collected in the result.
+func (c *Client) RestartAllDeployments(ctx context.Context, namespace string, dryRun bool) (*RestartAllResult, error) {
+	cs := c.kube()
+
+	list, err := cs.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RestartAllResult{
+		Namespace: namespace,
+		Restarted: []string{},
+		Failed:    make(map[string]string),
+		DryRun:    dryRun,
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	names := make(chan string)
+
+	for i := 0; i < min(restartWorkers, len(list.Items)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				_, err := restartDeployment(ctx, cs, namespace, name, "", dryRun)
+
+				mu.Lock()
+				if err != nil {
+					result.Failed[name] = err.Error()
+				} else {
+					result.Restarted = append(result.Restarted, name)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, d := range list.Items {
+		names <- d.Name
+	}
+	close(names)
+	wg.Wait()
+
+	sort.Strings(result.Restarted)
+	return result, nil
+}
+
+func restartDeployment(ctx context.Context, cs *kubernetes.Clientset, namespace, name, resourceVersion string, dryRun bool) (*DeploymentInfo, error) {
+	deployment, err := cs.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// The update itself is conditional on the version just read, so only a
+	// change before that read needs checking here
+	if resourceVersion != "" && deployment.ResourceVersion != resourceVersion {
+		return nil, staleVersionError(appsv1.Resource("deployments"), name, resourceVersion, deployment.ResourceVersion)
 	}
 
 	if deployment.Spec.Template.Annotations == nil {
@@ -283,24 +827,104 @@ func (c *Client) RestartDeployment(ctx context.Context, namespace, name string)
 	}
 	deployment.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"] = time.Now().Format(time.RFC3339)
 
-	_, err = c.clientset.AppsV1().Deployments(namespace).Update(ctx, deployment, metav1.UpdateOptions{})
+	updated, err := cs.AppsV1().Deployments(namespace).Update(ctx, deployment, metav1.UpdateOptions{DryRun: dryRunOption(dryRun)})
+	if err != nil {
+		return nil, err
+	}
+
+	info := deploymentToInfo(updated)
+	return &info, nil
+}
+
+// CordonNode marks a node as unschedulable
+func (c *Client) CordonNode(ctx context.Context, name string, dryRun bool) error {
+	return setUnschedulable(ctx, c.kube(), name, true, dryRun)
+}
+
+// UncordonNode marks a node as schedulable again
+func (c *Client) UncordonNode(ctx context.Context, name string, dryRun bool) error {
+	return setUnschedulable(ctx, c.kube(), name, false, dryRun)
+}
+
+func setUnschedulable(ctx context.Context, cs *kubernetes.Clientset, name string, unschedulable, dryRun bool) error {
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+	_, err := cs.CoreV1().Nodes().Patch(ctx, name, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{DryRun: dryRunOption(dryRun)})
 	return err
 }
 
+// DrainNode cordons a node and evicts its pods. Evictions go through the
+// eviction API so PodDisruptionBudgets are respected; pods a PDB protects are
+// reported as failed rather than force-deleted. DaemonSet and mirror pods are
+// skipped since evicting them has no effect. With dryRun the cordon and
+// evictions are validated server-side but the node is left untouched.
+func (c *Client) DrainNode(ctx context.Context, name string, dryRun bool) (*DrainResult, error) {
+	cs := c.kube()
+
+	if err := setUnschedulable(ctx, cs, name, true, dryRun); err != nil {
+		return nil, err
+	}
+
+	pods, err := cs.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", name).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DrainResult{
+		Node:    name,
+		Evicted: []string{},
+		Failed:  make(map[string]string),
+		DryRun:  dryRun,
+	}
+
+	for _, pod := range pods.Items {
+		podName := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+
+		if isDaemonSetPod(&pod) || isMirrorPod(&pod) {
+			result.Skipped = append(result.Skipped, podName)
+			continue
+		}
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			result.Skipped = append(result.Skipped, podName)
+			continue
+		}
+
+		err := cs.PolicyV1().Evictions(pod.Namespace).Evict(ctx, &policyv1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      pod.Name,
+				Namespace: pod.Namespace,
+			},
+			DeleteOptions: &metav1.DeleteOptions{DryRun: dryRunOption(dryRun)},
+		})
+		if err != nil {
+			result.Failed[podName] = err.Error()
+			continue
+		}
+		result.Evicted = append(result.Evicted, podName)
+	}
+
+	return result, nil
+}
+
 // GetClusterInfo returns basic cluster information
 func (c *Client) GetClusterInfo(ctx context.Context) (*ClusterInfo, error) {
-	version, err := c.clientset.Discovery().ServerVersion()
+	c.mu.RLock()
+	cs, currentContext := c.clientset, c.currentContext
+	c.mu.RUnlock()
+
+	version, err := cs.Discovery().ServerVersion()
 	if err != nil {
 		return nil, err
 	}
 
-	nodes, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	nodes, err := cs.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
 	return &ClusterInfo{
-		Context:     c.currentContext,
+		Context:     currentContext,
 		Version:     version.GitVersion,
 		Platform:    version.Platform,
 		NodeCount:   len(nodes.Items),
@@ -321,17 +945,90 @@ func podToInfo(pod *corev1.Pod) PodInfo {
 		}
 	}
 
+	var startTime *time.Time
+	if pod.Status.StartTime != nil {
+		t := pod.Status.StartTime.Time
+		startTime = &t
+	}
+
+	age := time.Since(pod.CreationTimestamp.Time)
 	return PodInfo{
-		Name:       pod.Name,
-		Namespace:  pod.Namespace,
-		Status:     string(pod.Status.Phase),
-		Ready:      fmt.Sprintf("%d/%d", ready, len(pod.Spec.Containers)),
-		Restarts:   restarts,
-		Age:        time.Since(pod.CreationTimestamp.Time),
-		Node:       pod.Spec.NodeName,
-		IP:         pod.Status.PodIP,
-		Labels:     pod.Labels,
+		Name:           pod.Name,
+		Namespace:      pod.Namespace,
+		Status:         string(pod.Status.Phase),
+		Ready:          fmt.Sprintf("%d/%d", ready, len(pod.Spec.Containers)),
+		Restarts:       restarts,
+		Age:            age,
+		AgeHuman:       humanDuration(age),
+		StartTime:      startTime,
+		Node:           pod.Spec.NodeName,
+		IP:             pod.Status.PodIP,
+		Labels:         pod.Labels,
+		ImagePullError: hasImagePullError(pod),
+	}
+}
+
+func deploymentToInfo(d *appsv1.Deployment) DeploymentInfo {
+	age := time.Since(d.CreationTimestamp.Time)
+	return DeploymentInfo{
+		Name:            d.Name,
+		Namespace:       d.Namespace,
+		Replicas:        *d.Spec.Replicas,
+		ReadyReplicas:   d.Status.ReadyReplicas,
+		UpdatedReplicas: d.Status.UpdatedReplicas,
+		Age:             age,
+		AgeHuman:        humanDuration(age),
+		Labels:          d.Labels,
+	}
+}
+
+// rolloutStatus mirrors `kubectl rollout status`: the rollout is complete
+// once the controller has observed the latest spec and every desired replica
+// is updated, ready and available with no old replicas left
+func rolloutStatus(d *appsv1.Deployment) RolloutStatus {
+	desired := int32(1)
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+
+	status := RolloutStatus{
+		Name:      d.Name,
+		Namespace: d.Namespace,
+		Desired:   desired,
+		Updated:   d.Status.UpdatedReplicas,
+		Ready:     d.Status.ReadyReplicas,
+		Available: d.Status.AvailableReplicas,
+	}
+	status.Complete = d.Status.ObservedGeneration >= d.Generation &&
+		status.Updated == desired &&
+		d.Status.Replicas == desired &&
+		status.Ready == desired &&
+		status.Available == desired
+
+	return status
+}
+
+// dryRunOption returns the server-side dry-run directive for mutating calls
+func dryRunOption(dryRun bool) []string {
+	if dryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
+
+// resourceVersionPrecondition makes a delete conditional on the object
+// still being at resourceVersion; an empty version deletes unconditionally
+func resourceVersionPrecondition(resourceVersion string) *metav1.Preconditions {
+	if resourceVersion == "" {
+		return nil
 	}
+	return &metav1.Preconditions{ResourceVersion: &resourceVersion}
+}
+
+// staleVersionError is the conflict for a write based on a resourceVersion
+// the object has since moved on from
+func staleVersionError(resource schema.GroupResource, name, expected, actual string) error {
+	return apierrors.NewConflict(resource, name, fmt.Errorf("the object has been modified since resourceVersion %s (now %s); reload it and try again", expected, actual))
 }
 
 func podToDetail(pod *corev1.Pod) *PodDetail {
@@ -346,13 +1043,142 @@ func podToDetail(pod *corev1.Pod) *PodDetail {
 			Ready:        status.Ready,
 			RestartCount: status.RestartCount,
 			State:        getContainerState(status),
+			Env:          containerEnv(c),
+			VolumeMounts: containerMounts(c),
+
+			LivenessProbe:  probeToInfo(c.LivenessProbe),
+			ReadinessProbe: probeToInfo(c.ReadinessProbe),
+			StartupProbe:   probeToInfo(c.StartupProbe),
+			ImagePull:      imagePullError(c.Image, status),
 		})
 	}
 
 	return &PodDetail{
-		PodInfo:    info,
-		Containers: containers,
+		PodInfo:         info,
+		Containers:      containers,
+		Conditions:      podConditions(pod),
+		ReadinessGates:  podReadinessGates(pod),
+		RestartTimeline: restartTimeline(pod, nil),
+		ResourceVersion: pod.ResourceVersion,
+	}
+}
+
+func probeToInfo(probe *corev1.Probe) *ProbeInfo {
+	if probe == nil {
+		return nil
 	}
+
+	info := &ProbeInfo{
+		InitialDelaySeconds: probe.InitialDelaySeconds,
+		PeriodSeconds:       probe.PeriodSeconds,
+		TimeoutSeconds:      probe.TimeoutSeconds,
+		SuccessThreshold:    probe.SuccessThreshold,
+		FailureThreshold:    probe.FailureThreshold,
+	}
+
+	switch h := probe.ProbeHandler; {
+	case h.HTTPGet != nil:
+		info.Handler = "httpGet"
+		info.Target = fmt.Sprintf("%s %s:%s%s", h.HTTPGet.Scheme, h.HTTPGet.Host, h.HTTPGet.Port.String(), h.HTTPGet.Path)
+	case h.TCPSocket != nil:
+		info.Handler = "tcpSocket"
+		info.Target = fmt.Sprintf("%s:%s", h.TCPSocket.Host, h.TCPSocket.Port.String())
+	case h.GRPC != nil:
+		info.Handler = "grpc"
+		info.Target = fmt.Sprintf(":%d", h.GRPC.Port)
+		if h.GRPC.Service != nil && *h.GRPC.Service != "" {
+			info.Target += " " + *h.GRPC.Service
+		}
+	case h.Exec != nil:
+		info.Handler = "exec"
+		info.Target = strings.Join(h.Exec.Command, " ")
+	}
+
+	return info
+}
+
+func podConditions(pod *corev1.Pod) []PodCondition {
+	var conditions []PodCondition
+	for _, c := range pod.Status.Conditions {
+		conditions = append(conditions, PodCondition{
+			Type:               string(c.Type),
+			Status:             string(c.Status),
+			Reason:             c.Reason,
+			Message:            c.Message,
+			LastTransitionTime: c.LastTransitionTime.Time,
+		})
+	}
+	return conditions
+}
+
+// podReadinessGates pairs each readiness gate in the spec with the status
+// of its condition, if reported
+func podReadinessGates(pod *corev1.Pod) []ReadinessGateInfo {
+	var gates []ReadinessGateInfo
+	for _, g := range pod.Spec.ReadinessGates {
+		gate := ReadinessGateInfo{ConditionType: string(g.ConditionType)}
+		for _, c := range pod.Status.Conditions {
+			if c.Type == g.ConditionType {
+				gate.Status = string(c.Status)
+				break
+			}
+		}
+		gates = append(gates, gate)
+	}
+	return gates
+}
+
+// containerEnv lists a container's env vars, including envFrom sources as
+// "<prefix>*" entries. Only literal values are shown; anything coming from a
+// secret, configmap or field is reported by reference.
+func containerEnv(c corev1.Container) []EnvVarInfo {
+	var env []EnvVarInfo
+	for _, e := range c.EnvFrom {
+		info := EnvVarInfo{Name: e.Prefix + "*"}
+		switch {
+		case e.SecretRef != nil:
+			info.ValueFrom = fmt.Sprintf("secret:%s", e.SecretRef.Name)
+		case e.ConfigMapRef != nil:
+			info.ValueFrom = fmt.Sprintf("configMap:%s", e.ConfigMapRef.Name)
+		}
+		env = append(env, info)
+	}
+
+	for _, e := range c.Env {
+		info := EnvVarInfo{Name: e.Name}
+		if e.ValueFrom == nil {
+			info.Value = e.Value
+			env = append(env, info)
+			continue
+		}
+
+		src := e.ValueFrom
+		switch {
+		case src.SecretKeyRef != nil:
+			info.ValueFrom = fmt.Sprintf("secret:%s/%s", src.SecretKeyRef.Name, src.SecretKeyRef.Key)
+		case src.ConfigMapKeyRef != nil:
+			info.ValueFrom = fmt.Sprintf("configMap:%s/%s", src.ConfigMapKeyRef.Name, src.ConfigMapKeyRef.Key)
+		case src.FieldRef != nil:
+			info.ValueFrom = fmt.Sprintf("field:%s", src.FieldRef.FieldPath)
+		case src.ResourceFieldRef != nil:
+			info.ValueFrom = fmt.Sprintf("resource:%s", src.ResourceFieldRef.Resource)
+		}
+		env = append(env, info)
+	}
+	return env
+}
+
+func containerMounts(c corev1.Container) []VolumeMountInfo {
+	var mounts []VolumeMountInfo
+	for _, m := range c.VolumeMounts {
+		mounts = append(mounts, VolumeMountInfo{
+			Name:      m.Name,
+			MountPath: m.MountPath,
+			SubPath:   m.SubPath,
+			ReadOnly:  m.ReadOnly,
+		})
+	}
+	return mounts
 }
 
 func getContainerStatus(pod *corev1.Pod, containerName string) corev1.ContainerStatus {
@@ -364,6 +1190,45 @@ func getContainerStatus(pod *corev1.Pod, containerName string) corev1.ContainerS
 	return corev1.ContainerStatus{}
 }
 
+// imagePullReasons are the kubelet's waiting reasons for an image that
+// can't be pulled
+var imagePullReasons = map[string]bool{
+	"ErrImagePull":           true,
+	"ImagePullBackOff":       true,
+	"ErrImageNeverPull":      true,
+	"InvalidImageName":       true,
+	"ErrImageInspect":        true,
+	"RegistryUnavailable":    true,
+	"ErrRegistryUnavailable": true,
+}
+
+// imagePullError returns the pull failure a container is waiting on, if any
+func imagePullError(image string, status corev1.ContainerStatus) *ImagePullInfo {
+	waiting := status.State.Waiting
+	if waiting == nil || !imagePullReasons[waiting.Reason] {
+		return nil
+	}
+
+	return &ImagePullInfo{
+		Reason:  waiting.Reason,
+		Image:   image,
+		Message: waiting.Message,
+	}
+}
+
+// hasImagePullError reports whether any container, init containers
+// included, is waiting on a failed image pull
+func hasImagePullError(pod *corev1.Pod) bool {
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, cs := range statuses {
+			if cs.State.Waiting != nil && imagePullReasons[cs.State.Waiting.Reason] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func getContainerState(status corev1.ContainerStatus) string {
 	if status.State.Running != nil {
 		return "Running"
@@ -377,6 +1242,139 @@ func getContainerState(status corev1.ContainerStatus) string {
 	return "Unknown"
 }
 
+func isDaemonSetPod(pod *corev1.Pod) bool {
+	for _, ref := range pod.OwnerReferences {
+		if ref.Kind == "DaemonSet" {
+			return true
+		}
+	}
+	return false
+}
+
+func isMirrorPod(pod *corev1.Pod) bool {
+	_, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]
+	return ok
+}
+
+func podPhaseCounts(pods []corev1.Pod) map[string]int {
+	phases := make(map[string]int)
+	for _, pod := range pods {
+		phases[string(pod.Status.Phase)]++
+	}
+	return phases
+}
+
+func eventsToInfo(items []corev1.Event) []EventInfo {
+	var events []EventInfo
+	for i := range items {
+		events = append(events, eventToInfo(&items[i]))
+	}
+
+	// Sort by last seen, most recent first
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].LastSeen.After(events[j].LastSeen)
+	})
+
+	return events
+}
+
+func eventToInfo(e *corev1.Event) EventInfo {
+	return EventInfo{
+		Type:      e.Type,
+		Reason:    e.Reason,
+		Message:   e.Message,
+		Object:    fmt.Sprintf("%s/%s", e.InvolvedObject.Kind, e.InvolvedObject.Name),
+		Count:     e.Count,
+		FirstSeen: e.FirstTimestamp.Time,
+		LastSeen:  eventLastSeen(e),
+	}
+}
+
+// humanDuration formats an age in its two largest units, like kubectl:
+// "3d4h", "5h12m", "7m30s", "45s"
+func humanDuration(d time.Duration) string {
+	if d < time.Second {
+		return "0s"
+	}
+
+	units := []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	}
+	for i, u := range units {
+		if d < u.size {
+			continue
+		}
+		out := fmt.Sprintf("%d%s", d/u.size, u.suffix)
+		if i+1 < len(units) {
+			next := units[i+1]
+			if rest := (d % u.size) / next.size; rest > 0 {
+				out += fmt.Sprintf("%d%s", rest, next.suffix)
+			}
+		}
+		return out
+	}
+	return "0s"
+}
+
+// eventLastSeen falls back to EventTime for events written through the
+// events.k8s.io API, which leave the legacy timestamps unset
+func eventLastSeen(e *corev1.Event) time.Time {
+	if !e.LastTimestamp.IsZero() {
+		return e.LastTimestamp.Time
+	}
+	return e.EventTime.Time
+}
+
+// kindForResource maps a URL resource segment (e.g. "pods") to its object kind
+func kindForResource(resource string) string {
+	kinds := map[string]string{
+		"pods":         "Pod",
+		"deployments":  "Deployment",
+		"replicasets":  "ReplicaSet",
+		"statefulsets": "StatefulSet",
+		"daemonsets":   "DaemonSet",
+		"jobs":         "Job",
+		"cronjobs":     "CronJob",
+		"services":     "Service",
+		"nodes":        "Node",
+
+		"configmaps":             "ConfigMap",
+		"persistentvolumeclaims": "PersistentVolumeClaim",
+		"serviceaccounts":        "ServiceAccount",
+		"ingresses":              "Ingress",
+	}
+
+	if kind, ok := kinds[strings.ToLower(resource)]; ok {
+		return kind
+	}
+	return resource
+}
+
+func serviceToInfo(s *corev1.Service) ServiceInfo {
+	var ports []string
+	for _, p := range s.Spec.Ports {
+		ports = append(ports, fmt.Sprintf("%d/%s", p.Port, p.Protocol))
+	}
+
+	age := time.Since(s.CreationTimestamp.Time)
+	return ServiceInfo{
+		Name:       s.Name,
+		Namespace:  s.Namespace,
+		Type:       string(s.Spec.Type),
+		ClusterIP:  s.Spec.ClusterIP,
+		ExternalIP: getExternalIP(s),
+		Ports:      ports,
+		Age:        age,
+		AgeHuman:   humanDuration(age),
+	}
+}
+
 func getExternalIP(svc *corev1.Service) string {
 	if len(svc.Status.LoadBalancer.Ingress) > 0 {
 		if svc.Status.LoadBalancer.Ingress[0].IP != "" {
@@ -0,0 +1,97 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakeCluster serves a pod list holding one pod named after the cluster
+func fakeCluster(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"1"},"items":[
+			{"metadata":{"name":%q,"namespace":"default"},"status":{"phase":"Running"}}]}`, name)
+	}))
+}
+
+// Run with -race: SwitchContext replaces the clientset while GetPods and
+// CurrentContext read it
+func TestSwitchContextConcurrentWithGetPods(t *testing.T) {
+	east, west := fakeCluster("east"), fakeCluster("west")
+	defer east.Close()
+	defer west.Close()
+
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: east
+clusters:
+- name: east
+  cluster: {server: %q}
+- name: west
+  cluster: {server: %q}
+users:
+- name: user
+  user: {token: t}
+contexts:
+- name: east
+  context: {cluster: east, user: user}
+- name: west
+  context: {cluster: west, user: user}
+`, east.URL, west.URL)
+
+	c, err := NewClient(ClientOptions{KubeconfigData: []byte(kubeconfig)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if err := c.SwitchContext([]string{"west", "east"}[i%2]); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	// Few reads: client-go throttles each clientset to 5 requests a second
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				pods, err := c.GetPods(ctx, "default", PodOptions{})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if len(pods) != 1 || (pods[0].Name != "east" && pods[0].Name != "west") {
+					t.Errorf("pods = %+v, want one cluster's pod", pods)
+					return
+				}
+				if current := c.CurrentContext(); current != "east" && current != "west" {
+					t.Errorf("current context = %q", current)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if current := c.CurrentContext(); current != "east" {
+		t.Errorf("current context after an even number of switches = %q, want east", current)
+	}
+	pods, err := c.GetPods(ctx, "default", PodOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods) != 1 || pods[0].Name != "east" {
+		t.Errorf("pods after switching back = %+v, want east's", pods)
+	}
+}
@@ -0,0 +1,27 @@
+package k8s
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DeleteConfigMap deletes a ConfigMap. With dryRun the deletion is validated
+// server-side only. A non-empty resourceVersion makes the delete fail with a
+// conflict if the ConfigMap has changed since it was read at that version.
+func (c *Client) DeleteConfigMap(ctx context.Context, namespace, name, resourceVersion string, dryRun bool) error {
+	return c.kube().CoreV1().ConfigMaps(namespace).Delete(ctx, name, metav1.DeleteOptions{
+		DryRun:        dryRunOption(dryRun),
+		Preconditions: resourceVersionPrecondition(resourceVersion),
+	})
+}
+
+// DeleteSecret deletes a Secret. The secret is never read first, so only
+// the delete verb is needed and its data never passes through the
+// dashboard. dryRun and resourceVersion work as for DeleteConfigMap.
+func (c *Client) DeleteSecret(ctx context.Context, namespace, name, resourceVersion string, dryRun bool) error {
+	return c.kube().CoreV1().Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{
+		DryRun:        dryRunOption(dryRun),
+		Preconditions: resourceVersionPrecondition(resourceVersion),
+	})
+}
@@ -0,0 +1,213 @@
+package k8s
+
+import (
+	"bufio"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DeploymentLogLine is one line from a deployment's combined log stream
+type DeploymentLogLine struct {
+	Pod  string
+	Line string
+}
+
+// DeploymentLogOptions for following a deployment's logs
+type DeploymentLogOptions struct {
+	// Container to follow in each pod; empty follows the first container
+	Container string
+	// TailLines is how many existing lines each pod starts with
+	TailLines  int
+	Timestamps bool
+	// Resync is how often the deployment's pods are re-resolved
+	Resync time.Duration
+	// MaxPods caps the pods followed at once; zero is unlimited
+	MaxPods int
+}
+
+// FollowDeploymentLogs follows the logs of every running pod the
+// deployment's selector matches and multiplexes them into one channel,
+// which is closed once ctx is done and every pod stream has stopped. The
+// pods are re-resolved every opts.Resync, so pods started during a rollout
+// are picked up and deleted ones are dropped. A pod whose stream ends, such
+// as when its container restarts, is followed again from where it left off.
+func (c *Client) FollowDeploymentLogs(ctx context.Context, namespace, name string, opts DeploymentLogOptions) (<-chan DeploymentLogLine, error) {
+	cs := c.kube()
+
+	deployment, err := cs.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &deploymentLogFollower{
+		cs:        cs,
+		namespace: namespace,
+		selector:  selector.String(),
+		opts:      opts,
+		lines:     make(chan DeploymentLogLine),
+		streams:   make(map[string]*podLogStream),
+	}
+	go f.run(ctx)
+
+	return f.lines, nil
+}
+
+// deploymentLogFollower keeps one log stream open per matching pod
+type deploymentLogFollower struct {
+	cs        *kubernetes.Clientset
+	namespace string
+	selector  string
+	opts      DeploymentLogOptions
+	lines     chan DeploymentLogLine
+	wg        sync.WaitGroup
+
+	mu      sync.Mutex
+	streams map[string]*podLogStream // pod name -> its stream
+}
+
+// podLogStream is a pod's log stream, running or ended
+type podLogStream struct {
+	cancel context.CancelFunc
+	done   bool
+	// ended is when the stream stopped, so following again resumes there
+	ended time.Time
+}
+
+func (f *deploymentLogFollower) run(ctx context.Context) {
+	defer close(f.lines)
+	defer f.wg.Wait()
+
+	ticker := time.NewTicker(f.opts.Resync)
+	defer ticker.Stop()
+
+	for {
+		f.resync(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resync starts streams for new pods, restarts ended ones and stops those
+// of pods that are gone. A failed list keeps the current streams.
+func (f *deploymentLogFollower) resync(ctx context.Context) {
+	list, err := f.cs.CoreV1().Pods(f.namespace).List(ctx, metav1.ListOptions{LabelSelector: f.selector})
+	if err != nil {
+		return
+	}
+
+	pods := podsToFollow(list.Items, f.opts.MaxPods)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	current := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		current[pod.Name] = true
+
+		stream, ok := f.streams[pod.Name]
+		switch {
+		case !ok:
+			f.follow(ctx, pod, nil)
+		case stream.done:
+			since := metav1.NewTime(stream.ended)
+			f.follow(ctx, pod, &since)
+		}
+	}
+
+	for name, stream := range f.streams {
+		if !current[name] {
+			stream.cancel()
+			delete(f.streams, name)
+		}
+	}
+}
+
+// podsToFollow picks the running pods to follow, at most maxPods of them
+// when maxPods is positive. Pods not being deleted come before terminating
+// ones, newest first within each, so during a rollout a capped stream
+// follows the pods coming up and drops those on their way out.
+func podsToFollow(pods []corev1.Pod, maxPods int) []*corev1.Pod {
+	running := make([]*corev1.Pod, 0, len(pods))
+	for i := range pods {
+		if pods[i].Status.Phase == corev1.PodRunning {
+			running = append(running, &pods[i])
+		}
+	}
+
+	sort.SliceStable(running, func(i, j int) bool {
+		iTerminating, jTerminating := running[i].DeletionTimestamp != nil, running[j].DeletionTimestamp != nil
+		if iTerminating != jTerminating {
+			return jTerminating
+		}
+		return running[j].CreationTimestamp.Before(&running[i].CreationTimestamp)
+	})
+
+	if maxPods > 0 && len(running) > maxPods {
+		running = running[:maxPods]
+	}
+	return running
+}
+
+// follow starts streaming a pod's log, from since when it's set or the last
+// TailLines lines otherwise; callers hold mu
+func (f *deploymentLogFollower) follow(ctx context.Context, pod *corev1.Pod, since *metav1.Time) {
+	logOpts := &corev1.PodLogOptions{
+		Container:  f.opts.Container,
+		Follow:     true,
+		Timestamps: f.opts.Timestamps,
+	}
+	if logOpts.Container == "" && len(pod.Spec.Containers) > 0 {
+		logOpts.Container = pod.Spec.Containers[0].Name
+	}
+	if since != nil {
+		logOpts.SinceTime = since
+	} else if f.opts.TailLines > 0 {
+		lines := int64(f.opts.TailLines)
+		logOpts.TailLines = &lines
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	stream := &podLogStream{cancel: cancel}
+	f.streams[pod.Name] = stream
+
+	f.wg.Add(1)
+	go func(name string) {
+		defer f.wg.Done()
+		defer func() {
+			cancel()
+			f.mu.Lock()
+			stream.done = true
+			stream.ended = time.Now()
+			f.mu.Unlock()
+		}()
+
+		body, err := f.cs.CoreV1().Pods(f.namespace).GetLogs(name, logOpts).Stream(streamCtx)
+		if err != nil {
+			return
+		}
+		defer body.Close()
+
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			select {
+			case f.lines <- DeploymentLogLine{Pod: name, Line: scanner.Text()}:
+			case <-streamCtx.Done():
+				return
+			}
+		}
+	}(pod.Name)
+}
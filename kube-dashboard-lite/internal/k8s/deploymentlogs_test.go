@@ -0,0 +1,60 @@
+package k8s
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodsToFollow(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pod := func(name string, age time.Duration, phase corev1.PodPhase, terminating bool) corev1.Pod {
+		p := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(base.Add(-age))},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+		if terminating {
+			deleted := metav1.NewTime(base)
+			p.DeletionTimestamp = &deleted
+		}
+		return p
+	}
+
+	// Mid-rollout: old pods terminating, new ones up, one still pending
+	pods := []corev1.Pod{
+		pod("old-a", 3*time.Hour, corev1.PodRunning, true),
+		pod("old-b", 2*time.Hour, corev1.PodRunning, false),
+		pod("new-a", 2*time.Minute, corev1.PodRunning, false),
+		pod("old-c", time.Hour, corev1.PodRunning, true),
+		pod("new-b", time.Minute, corev1.PodRunning, false),
+		pod("new-c", 0, corev1.PodPending, false),
+	}
+
+	tests := []struct {
+		maxPods int
+		want    []string
+	}{
+		{maxPods: 0, want: []string{"new-b", "new-a", "old-b", "old-c", "old-a"}},
+		{maxPods: 4, want: []string{"new-b", "new-a", "old-b", "old-c"}},
+		{maxPods: 2, want: []string{"new-b", "new-a"}},
+	}
+	for _, tt := range tests {
+		got := podsToFollow(pods, tt.maxPods)
+		var names []string
+		for _, p := range got {
+			names = append(names, p.Name)
+		}
+		if len(names) != len(tt.want) {
+			t.Errorf("maxPods %d: got %v, want %v", tt.maxPods, names, tt.want)
+			continue
+		}
+		for i := range names {
+			if names[i] != tt.want[i] {
+				t.Errorf("maxPods %d: got %v, want %v", tt.maxPods, names, tt.want)
+				break
+			}
+		}
+	}
+}
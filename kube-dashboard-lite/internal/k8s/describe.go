@@ -0,0 +1,87 @@
+package k8s
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// Limits on a pod description, which is meant for a single screen
+const (
+	describeMaxEvents      = 50
+	describeLogMaxBytes    = 256 << 10
+	DefaultDescribeLogTail = 50
+)
+
+// DescribePod returns a pod's detail, its recent events and the last
+// tailLines log lines of each container, like kubectl describe and logs
+// together. Only a missing pod is an error; events or logs that can't be
+// read are reported in the description.
+func (c *Client) DescribePod(ctx context.Context, namespace, name string, tailLines int) (*PodDescription, error) {
+	cs := c.kube()
+
+	pod, err := cs.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	desc := &PodDescription{Pod: podToDetail(pod)}
+	desc.Pod.OwnerChain = ownerChain(ctx, cs, pod)
+
+	events, err := cs.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.kind": "Pod",
+			"involvedObject.name": name,
+		}.AsSelector().String(),
+	})
+	if err != nil {
+		desc.Errors = append(desc.Errors, fmt.Sprintf("events: %v", err))
+	} else {
+		attachPodEvents(desc.Pod, pod, events.Items)
+
+		desc.Events = eventsToInfo(events.Items)
+		if len(desc.Events) > describeMaxEvents {
+			desc.Events = desc.Events[:describeMaxEvents]
+		}
+	}
+
+	tail := int64(tailLines)
+	for _, container := range pod.Spec.Containers {
+		if tailLines == 0 {
+			break
+		}
+		logs := ContainerLogs{Container: container.Name}
+
+		stream, err := cs.CoreV1().Pods(namespace).GetLogs(name, &corev1.PodLogOptions{
+			Container: container.Name,
+			TailLines: &tail,
+		}).Stream(ctx)
+		if err != nil {
+			logs.Error = err.Error()
+		} else {
+			logs.Lines, err = readLines(io.LimitReader(stream, describeLogMaxBytes))
+			stream.Close()
+			if err != nil {
+				logs.Error = err.Error()
+			}
+		}
+
+		desc.Logs = append(desc.Logs, logs)
+	}
+
+	return desc, nil
+}
+
+func readLines(r io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,174 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"sigs.k8s.io/yaml"
+)
+
+// diffFieldManager is the field manager used for apply dry-runs
+const diffFieldManager = "kube-dashboard-lite"
+
+// ErrInvalidManifest is returned when a manifest can't be parsed or doesn't
+// name a known resource
+var ErrInvalidManifest = errors.New("invalid manifest")
+
+// DiffManifest compares a YAML manifest with the live object it names. The
+// manifest is applied with a server-side dry-run, so the diff shows what the
+// object would actually become, including defaults and merge behavior.
+func (c *Client) DiffManifest(ctx context.Context, manifest []byte) (*ManifestDiff, error) {
+	c.mu.RLock()
+	cs, config := c.clientset, c.config
+	c.mu.RUnlock()
+
+	data, err := yaml.YAMLToJSON(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+	if obj.GetName() == "" {
+		return nil, fmt.Errorf("%w: metadata.name is required", ErrInvalidManifest)
+	}
+
+	gvk := obj.GroupVersionKind()
+	// A diff shows live values, and the dashboard never shows secret data
+	if gvk.Group == "" && gvk.Kind == "Secret" {
+		return nil, fmt.Errorf("%w: Secrets can't be diffed", ErrInvalidManifest)
+	}
+
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(cs.Discovery()))
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+
+	dyn, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var resource dynamic.ResourceInterface = dyn.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace("default")
+		}
+		resource = dyn.Resource(mapping.Resource).Namespace(obj.GetNamespace())
+	}
+
+	result := &ManifestDiff{
+		Kind:      gvk.Kind,
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Exists:    true,
+	}
+
+	live, err := resource.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		live, result.Exists = &unstructured.Unstructured{Object: map[string]interface{}{}}, false
+	} else if err != nil {
+		return nil, err
+	}
+
+	applied, err := resource.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{
+		FieldManager: diffFieldManager,
+		Force:        true,
+		DryRun:       []string{metav1.DryRunAll},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Changes = diffFields(comparable(live.Object), comparable(applied.Object))
+	return result, nil
+}
+
+// comparable drops server-managed fields that change on every write and
+// would only add noise to a diff
+func comparable(obj map[string]interface{}) map[string]interface{} {
+	obj = runtime.DeepCopyJSON(obj)
+	for _, path := range [][]string{
+		{"metadata", "managedFields"},
+		{"metadata", "resourceVersion"},
+		{"metadata", "generation"},
+		{"metadata", "uid"},
+		{"metadata", "creationTimestamp"},
+		{"status"},
+	} {
+		unstructured.RemoveNestedField(obj, path...)
+	}
+	return obj
+}
+
+// diffFields lists the fields that differ between two objects, sorted by path
+func diffFields(before, after map[string]interface{}) []FieldChange {
+	changes := []FieldChange{}
+	diffValues("", before, after, &changes)
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+func diffValues(path string, before, after interface{}, changes *[]FieldChange) {
+	switch o := before.(type) {
+	case map[string]interface{}:
+		if n, ok := after.(map[string]interface{}); ok {
+			for k, ov := range o {
+				nv, found := n[k]
+				if !found {
+					*changes = append(*changes, FieldChange{Path: joinPath(path, k), Op: "removed", Old: ov})
+					continue
+				}
+				diffValues(joinPath(path, k), ov, nv, changes)
+			}
+			for k, nv := range n {
+				if _, found := o[k]; !found {
+					*changes = append(*changes, FieldChange{Path: joinPath(path, k), Op: "added", New: nv})
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if n, ok := after.([]interface{}); ok {
+			for i := 0; i < len(o) || i < len(n); i++ {
+				p := path + "[" + strconv.Itoa(i) + "]"
+				switch {
+				case i >= len(n):
+					*changes = append(*changes, FieldChange{Path: p, Op: "removed", Old: o[i]})
+				case i >= len(o):
+					*changes = append(*changes, FieldChange{Path: p, Op: "added", New: n[i]})
+				default:
+					diffValues(p, o[i], n[i], changes)
+				}
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		*changes = append(*changes, FieldChange{Path: path, Op: "changed", Old: before, New: after})
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
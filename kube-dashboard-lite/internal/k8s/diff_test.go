@@ -0,0 +1,44 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestDiffManifestRefusesSecrets(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	config := &rest.Config{Host: srv.URL}
+	cs, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{clientset: cs, config: config}
+
+	manifest := []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+  namespace: default
+stringData:
+  password: guess
+`)
+	diff, err := c.DiffManifest(context.Background(), manifest)
+	if !errors.Is(err, ErrInvalidManifest) {
+		t.Fatalf("err = %v, diff = %+v; want ErrInvalidManifest", err, diff)
+	}
+	if called {
+		t.Error("the live Secret was read")
+	}
+}
@@ -0,0 +1,179 @@
+package k8s
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Where ServiceEndpoints were read from
+const (
+	EndpointSourceSlices    = "EndpointSlice"
+	EndpointSourceEndpoints = "Endpoints"
+)
+
+// GetService returns a service with its selector and backing endpoints
+func (c *Client) GetService(ctx context.Context, namespace, name string) (*ServiceDetail, error) {
+	cs := c.kube()
+
+	svc, err := cs.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints, err := serviceEndpoints(ctx, cs, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServiceDetail{
+		ServiceInfo:     serviceToInfo(svc),
+		Selector:        svc.Spec.Selector,
+		Endpoints:       *endpoints,
+		ResourceVersion: svc.ResourceVersion,
+	}, nil
+}
+
+// GetEndpoints returns the ready and not-ready addresses behind a service.
+// No addresses at all usually means the selector matches no pods.
+func (c *Client) GetEndpoints(ctx context.Context, namespace, serviceName string) (*ServiceEndpoints, error) {
+	cs := c.kube()
+
+	// A missing service would otherwise look like one with no endpoints
+	if _, err := cs.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{}); err != nil {
+		return nil, err
+	}
+
+	return serviceEndpoints(ctx, cs, namespace, serviceName)
+}
+
+// serviceEndpoints reads a service's EndpointSlices, falling back to the
+// legacy Endpoints object on clusters without the discovery.k8s.io/v1 API
+func serviceEndpoints(ctx context.Context, cs *kubernetes.Clientset, namespace, serviceName string) (*ServiceEndpoints, error) {
+	slices, err := cs.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + serviceName,
+	})
+	if err == nil {
+		return slicesToEndpoints(namespace, serviceName, slices.Items), nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	endpoints, err := cs.CoreV1().Endpoints(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// No pods have ever matched, or the service has no selector
+		return newServiceEndpoints(namespace, serviceName, EndpointSourceEndpoints), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return endpointsToInfo(endpoints), nil
+}
+
+func newServiceEndpoints(namespace, serviceName, source string) *ServiceEndpoints {
+	return &ServiceEndpoints{
+		Service:   serviceName,
+		Namespace: namespace,
+		Source:    source,
+		Ready:     []EndpointAddress{},
+		NotReady:  []EndpointAddress{},
+		Ports:     []EndpointPort{},
+	}
+}
+
+func slicesToEndpoints(namespace, serviceName string, slices []discoveryv1.EndpointSlice) *ServiceEndpoints {
+	info := newServiceEndpoints(namespace, serviceName, EndpointSourceSlices)
+	seenAddrs := make(map[string]bool)
+	seenPorts := make(map[EndpointPort]bool)
+
+	for _, slice := range slices {
+		for _, p := range slice.Ports {
+			port := EndpointPort{}
+			if p.Name != nil {
+				port.Name = *p.Name
+			}
+			if p.Port != nil {
+				port.Port = *p.Port
+			}
+			if p.Protocol != nil {
+				port.Protocol = string(*p.Protocol)
+			}
+			if !seenPorts[port] {
+				seenPorts[port] = true
+				info.Ports = append(info.Ports, port)
+			}
+		}
+
+		for _, ep := range slice.Endpoints {
+			// A nil ready condition means unknown, which consumers treat
+			// as ready
+			ready := ep.Conditions.Ready == nil || *ep.Conditions.Ready
+			terminating := ep.Conditions.Terminating != nil && *ep.Conditions.Terminating
+
+			for _, ip := range ep.Addresses {
+				if seenAddrs[ip] {
+					continue
+				}
+				seenAddrs[ip] = true
+
+				addr := EndpointAddress{IP: ip, Terminating: terminating}
+				if ep.Hostname != nil {
+					addr.Hostname = *ep.Hostname
+				}
+				if ep.NodeName != nil {
+					addr.Node = *ep.NodeName
+				}
+				if ep.TargetRef != nil && ep.TargetRef.Kind == "Pod" {
+					addr.Pod = ep.TargetRef.Name
+				}
+
+				if ready {
+					info.Ready = append(info.Ready, addr)
+				} else {
+					info.NotReady = append(info.NotReady, addr)
+				}
+			}
+		}
+	}
+
+	return info
+}
+
+func endpointsToInfo(endpoints *corev1.Endpoints) *ServiceEndpoints {
+	info := newServiceEndpoints(endpoints.Namespace, endpoints.Name, EndpointSourceEndpoints)
+	seenPorts := make(map[EndpointPort]bool)
+
+	for _, subset := range endpoints.Subsets {
+		for _, p := range subset.Ports {
+			port := EndpointPort{Name: p.Name, Port: p.Port, Protocol: string(p.Protocol)}
+			if !seenPorts[port] {
+				seenPorts[port] = true
+				info.Ports = append(info.Ports, port)
+			}
+		}
+		for _, a := range subset.Addresses {
+			info.Ready = append(info.Ready, endpointAddress(a))
+		}
+		for _, a := range subset.NotReadyAddresses {
+			info.NotReady = append(info.NotReady, endpointAddress(a))
+		}
+	}
+
+	return info
+}
+
+func endpointAddress(a corev1.EndpointAddress) EndpointAddress {
+	addr := EndpointAddress{IP: a.IP, Hostname: a.Hostname}
+	if a.NodeName != nil {
+		addr.Node = *a.NodeName
+	}
+	if a.TargetRef != nil && a.TargetRef.Kind == "Pod" {
+		addr.Pod = a.TargetRef.Name
+	}
+	return addr
+}
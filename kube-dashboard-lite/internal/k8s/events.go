@@ -0,0 +1,148 @@
+package k8s
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// eventWatchRetry is how long WatchEvents waits before re-establishing a
+// watch that failed for a reason other than an expired resourceVersion
+const eventWatchRetry = 2 * time.Second
+
+// WatchEvents streams events in a namespace as they are created or updated.
+// With an empty resourceVersion only events from now on are sent; otherwise
+// the watch resumes after that version. Watches the API server closes are
+// re-established from the last version seen, and when that version has
+// expired the events are listed again and any newer than the last one sent
+// are delivered before watching resumes. The channel is closed when ctx is
+// done.
+func (c *Client) WatchEvents(ctx context.Context, namespace, resourceVersion string) (<-chan EventUpdate, error) {
+	cs := c.kube()
+
+	// Fail fast on a namespace we can't read rather than retrying forever
+	list, err := cs.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if resourceVersion == "" {
+		resourceVersion = list.ResourceVersion
+	}
+
+	w := &eventWatcher{
+		cs:              cs,
+		namespace:       namespace,
+		resourceVersion: resourceVersion,
+		lastSeen:        time.Now(),
+		updates:         make(chan EventUpdate),
+	}
+	go w.run(ctx)
+
+	return w.updates, nil
+}
+
+// eventWatcher keeps an event watch going across API server timeouts and
+// expired resource versions
+type eventWatcher struct {
+	cs              *kubernetes.Clientset
+	namespace       string
+	resourceVersion string
+	lastSeen        time.Time // newest event sent, for catching up after a relist
+	updates         chan EventUpdate
+}
+
+func (w *eventWatcher) run(ctx context.Context) {
+	defer close(w.updates)
+
+	for ctx.Err() == nil {
+		watcher, err := w.cs.CoreV1().Events(w.namespace).Watch(ctx, metav1.ListOptions{
+			ResourceVersion:     w.resourceVersion,
+			AllowWatchBookmarks: true,
+		})
+		if err == nil {
+			err = w.consume(ctx, watcher)
+			watcher.Stop()
+		}
+
+		switch {
+		case ctx.Err() != nil:
+			return
+		case apierrors.IsResourceExpired(err) || apierrors.IsGone(err):
+			err = w.relist(ctx)
+		}
+		if err != nil {
+			select {
+			case <-time.After(eventWatchRetry):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// consume delivers a watch's events until it closes, returning the error
+// it ended with, if any
+func (w *eventWatcher) consume(ctx context.Context, watcher watch.Interface) error {
+	for event := range watcher.ResultChan() {
+		switch event.Type {
+		case watch.Error:
+			return apierrors.FromObject(event.Object)
+		case watch.Added, watch.Modified:
+			e, ok := event.Object.(*corev1.Event)
+			if !ok {
+				continue
+			}
+			w.resourceVersion = e.ResourceVersion
+			if !w.send(ctx, eventToInfo(e)) {
+				return ctx.Err()
+			}
+		default:
+			// Bookmarks and deletions only move the resume point
+			if obj, err := meta.Accessor(event.Object); err == nil {
+				w.resourceVersion = obj.GetResourceVersion()
+			}
+		}
+	}
+	return nil
+}
+
+// relist catches up after the watch's resourceVersion expired, sending the
+// events seen since the last one delivered, oldest first
+func (w *eventWatcher) relist(ctx context.Context) error {
+	list, err := w.cs.CoreV1().Events(w.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	w.resourceVersion = list.ResourceVersion
+
+	events := eventsToInfo(list.Items)
+	since := w.lastSeen
+	n := sort.Search(len(events), func(i int) bool {
+		return !events[i].LastSeen.After(since)
+	})
+	for i := n - 1; i >= 0; i-- {
+		if !w.send(ctx, events[i]) {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (w *eventWatcher) send(ctx context.Context, info EventInfo) bool {
+	if info.LastSeen.After(w.lastSeen) {
+		w.lastSeen = info.LastSeen
+	}
+	select {
+	case w.updates <- EventUpdate{Event: info, ResourceVersion: w.resourceVersion}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
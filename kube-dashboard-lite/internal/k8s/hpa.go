@@ -0,0 +1,178 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetHPAs returns the HorizontalPodAutoscalers in a namespace with their
+// current and desired replicas and each scaling metric
+func (c *Client) GetHPAs(ctx context.Context, namespace string) ([]HPAInfo, error) {
+	list, err := c.kube().AutoscalingV2().HorizontalPodAutoscalers(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var hpas []HPAInfo
+	for i := range list.Items {
+		hpas = append(hpas, hpaToInfo(&list.Items[i]))
+	}
+
+	return hpas, nil
+}
+
+func hpaToInfo(hpa *autoscalingv2.HorizontalPodAutoscaler) HPAInfo {
+	ref := hpa.Spec.ScaleTargetRef
+	age := time.Since(hpa.CreationTimestamp.Time)
+	info := HPAInfo{
+		Name:      hpa.Name,
+		Namespace: hpa.Namespace,
+		Target: HPATarget{
+			Kind:       ref.Kind,
+			Name:       ref.Name,
+			APIVersion: ref.APIVersion,
+		},
+		MaxReplicas:     hpa.Spec.MaxReplicas,
+		CurrentReplicas: hpa.Status.CurrentReplicas,
+		DesiredReplicas: hpa.Status.DesiredReplicas,
+		Age:             age,
+		AgeHuman:        humanDuration(age),
+	}
+
+	// minReplicas defaults to 1 when unset
+	info.MinReplicas = 1
+	if hpa.Spec.MinReplicas != nil {
+		info.MinReplicas = *hpa.Spec.MinReplicas
+	}
+
+	if ref.Kind == "Deployment" {
+		info.Deployment = ref.Name
+	}
+
+	if hpa.Status.LastScaleTime != nil {
+		t := hpa.Status.LastScaleTime.Time
+		info.LastScaleTime = &t
+	}
+
+	for _, spec := range hpa.Spec.Metrics {
+		metric := hpaMetric(spec)
+		for _, status := range hpa.Status.CurrentMetrics {
+			if current, ok := hpaMetricCurrent(metric, status); ok {
+				metric.Current = current
+				break
+			}
+		}
+		info.Metrics = append(info.Metrics, metric)
+	}
+
+	for _, cond := range hpa.Status.Conditions {
+		info.Conditions = append(info.Conditions, HPACondition{
+			Type:    string(cond.Type),
+			Status:  string(cond.Status),
+			Reason:  cond.Reason,
+			Message: cond.Message,
+		})
+	}
+
+	return info
+}
+
+// hpaMetric describes a metric spec and its target
+func hpaMetric(spec autoscalingv2.MetricSpec) HPAMetric {
+	metric := HPAMetric{Type: string(spec.Type)}
+
+	switch spec.Type {
+	case autoscalingv2.ResourceMetricSourceType:
+		if spec.Resource != nil {
+			metric.Name = string(spec.Resource.Name)
+			metric.Target = formatMetricTarget(spec.Resource.Target)
+		}
+	case autoscalingv2.ContainerResourceMetricSourceType:
+		if spec.ContainerResource != nil {
+			metric.Name = string(spec.ContainerResource.Name)
+			metric.Container = spec.ContainerResource.Container
+			metric.Target = formatMetricTarget(spec.ContainerResource.Target)
+		}
+	case autoscalingv2.PodsMetricSourceType:
+		if spec.Pods != nil {
+			metric.Name = spec.Pods.Metric.Name
+			metric.Target = formatMetricTarget(spec.Pods.Target)
+		}
+	case autoscalingv2.ObjectMetricSourceType:
+		if spec.Object != nil {
+			metric.Name = spec.Object.Metric.Name
+			metric.Target = formatMetricTarget(spec.Object.Target)
+		}
+	case autoscalingv2.ExternalMetricSourceType:
+		if spec.External != nil {
+			metric.Name = spec.External.Metric.Name
+			metric.Target = formatMetricTarget(spec.External.Target)
+		}
+	}
+
+	return metric
+}
+
+// hpaMetricCurrent returns the current value from status if it reports on
+// the given metric
+func hpaMetricCurrent(metric HPAMetric, status autoscalingv2.MetricStatus) (string, bool) {
+	if string(status.Type) != metric.Type {
+		return "", false
+	}
+
+	switch status.Type {
+	case autoscalingv2.ResourceMetricSourceType:
+		if status.Resource != nil && string(status.Resource.Name) == metric.Name {
+			return formatMetricValue(status.Resource.Current), true
+		}
+	case autoscalingv2.ContainerResourceMetricSourceType:
+		if status.ContainerResource != nil && string(status.ContainerResource.Name) == metric.Name &&
+			status.ContainerResource.Container == metric.Container {
+			return formatMetricValue(status.ContainerResource.Current), true
+		}
+	case autoscalingv2.PodsMetricSourceType:
+		if status.Pods != nil && status.Pods.Metric.Name == metric.Name {
+			return formatMetricValue(status.Pods.Current), true
+		}
+	case autoscalingv2.ObjectMetricSourceType:
+		if status.Object != nil && status.Object.Metric.Name == metric.Name {
+			return formatMetricValue(status.Object.Current), true
+		}
+	case autoscalingv2.ExternalMetricSourceType:
+		if status.External != nil && status.External.Metric.Name == metric.Name {
+			return formatMetricValue(status.External.Current), true
+		}
+	}
+
+	return "", false
+}
+
+// formatMetricTarget renders a target as a utilization percentage or a
+// quantity, e.g. "80%" or "500m"
+func formatMetricTarget(target autoscalingv2.MetricTarget) string {
+	switch {
+	case target.AverageUtilization != nil:
+		return fmt.Sprintf("%d%%", *target.AverageUtilization)
+	case target.AverageValue != nil:
+		return target.AverageValue.String()
+	case target.Value != nil:
+		return target.Value.String()
+	}
+	return ""
+}
+
+func formatMetricValue(current autoscalingv2.MetricValueStatus) string {
+	switch {
+	case current.AverageUtilization != nil:
+		return fmt.Sprintf("%d%%", *current.AverageUtilization)
+	case current.AverageValue != nil:
+		return current.AverageValue.String()
+	case current.Value != nil:
+		return current.Value.String()
+	}
+	return ""
+}
@@ -0,0 +1,42 @@
+package k8s
+
+import (
+	"errors"
+	"fmt"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ErrInvalidKubeconfig is returned when an uploaded kubeconfig can't be
+// parsed or uses settings the dashboard refuses to run with
+var ErrInvalidKubeconfig = errors.New("invalid kubeconfig")
+
+// checkUploadedKubeconfig rejects kubeconfigs that would make the dashboard
+// read its own files or run commands: an upload comes from a browser, so
+// credentials must be inline and exec or auth-provider plugins are refused.
+func checkUploadedKubeconfig(cfg *clientcmdapi.Config) error {
+	if len(cfg.Contexts) == 0 {
+		return fmt.Errorf("%w: no contexts", ErrInvalidKubeconfig)
+	}
+
+	for name, cluster := range cfg.Clusters {
+		if cluster.CertificateAuthority != "" {
+			return fmt.Errorf("%w: cluster %q: certificate-authority must be inline (certificate-authority-data)", ErrInvalidKubeconfig, name)
+		}
+	}
+
+	for name, user := range cfg.AuthInfos {
+		switch {
+		case user.Exec != nil:
+			return fmt.Errorf("%w: user %q: exec credential plugins are not allowed", ErrInvalidKubeconfig, name)
+		case user.AuthProvider != nil:
+			return fmt.Errorf("%w: user %q: auth-provider plugins are not allowed", ErrInvalidKubeconfig, name)
+		case user.ClientCertificate != "" || user.ClientKey != "":
+			return fmt.Errorf("%w: user %q: client certificate and key must be inline", ErrInvalidKubeconfig, name)
+		case user.TokenFile != "":
+			return fmt.Errorf("%w: user %q: tokenFile is not allowed, use token", ErrInvalidKubeconfig, name)
+		}
+	}
+
+	return nil
+}
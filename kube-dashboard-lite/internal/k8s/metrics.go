@@ -0,0 +1,263 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ErrMetricsUnavailable is returned when the cluster doesn't serve the
+// metrics.k8s.io API, usually because metrics-server isn't installed
+var ErrMetricsUnavailable = errors.New("metrics API unavailable")
+
+// podMetricsPath lists pod usage across all namespaces from metrics-server
+const podMetricsPath = "/apis/metrics.k8s.io/v1beta1/pods"
+
+// podMetricsList is the subset of metrics.k8s.io PodMetricsList used here
+type podMetricsList struct {
+	Items []struct {
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Timestamp  time.Time `json:"timestamp"`
+		Containers []struct {
+			Usage map[string]resource.Quantity `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// podUsage is one pod's usage from a single metrics-server read
+type podUsage struct {
+	namespace string
+	name      string
+	sample    MetricsSample
+}
+
+// podMetrics reads the current usage of every pod from metrics-server,
+// summed over each pod's containers
+func podMetrics(ctx context.Context, cs *kubernetes.Clientset) ([]podUsage, error) {
+	data, err := cs.CoreV1().RESTClient().Get().AbsPath(podMetricsPath).DoRaw(ctx)
+	if err != nil {
+		if apierrors.IsNotFound(err) || apierrors.IsServiceUnavailable(err) {
+			return nil, fmt.Errorf("%w: %v", ErrMetricsUnavailable, err)
+		}
+		return nil, err
+	}
+
+	var list podMetricsList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode pod metrics: %w", err)
+	}
+
+	usage := make([]podUsage, 0, len(list.Items))
+	for _, item := range list.Items {
+		sample := MetricsSample{Time: item.Timestamp}
+		for _, container := range item.Containers {
+			if cpu, ok := container.Usage["cpu"]; ok {
+				sample.CPUMillicores += cpu.MilliValue()
+			}
+			if memory, ok := container.Usage["memory"]; ok {
+				sample.MemoryBytes += memory.Value()
+			}
+		}
+		usage = append(usage, podUsage{
+			namespace: item.Metadata.Namespace,
+			name:      item.Metadata.Name,
+			sample:    sample,
+		})
+	}
+	return usage, nil
+}
+
+// MetricsHistory samples pod usage from metrics-server on an interval and
+// keeps the most recent samples per pod in memory, for sparklines. Memory is
+// bounded by maxPods series of window samples each; pods beyond maxPods
+// aren't tracked, and a pod's series is dropped once it stops reporting.
+// Only the client's active context is sampled, and switching context starts
+// the history over.
+type MetricsHistory struct {
+	client   *Client
+	interval time.Duration
+	window   int
+	maxPods  int
+
+	mu        sync.RWMutex
+	clientset *kubernetes.Clientset // the clientset the series came from
+	series    map[string]*metricsRing
+	lastErr   error
+	sampledAt time.Time
+}
+
+// NewMetricsHistory creates a history that samples every interval and keeps
+// window samples for up to maxPods pods. Run starts the sampling.
+func NewMetricsHistory(client *Client, interval time.Duration, window, maxPods int) *MetricsHistory {
+	return &MetricsHistory{
+		client:   client,
+		interval: interval,
+		window:   window,
+		maxPods:  maxPods,
+		series:   make(map[string]*metricsRing),
+	}
+}
+
+// Run samples until ctx is done. Failed samples, such as when metrics-server
+// isn't installed, are recorded and retried on the next tick.
+func (m *MetricsHistory) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.sample(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *MetricsHistory) sample(ctx context.Context) {
+	cs := m.client.kube()
+
+	sampleCtx, cancel := context.WithTimeout(ctx, m.interval)
+	defer cancel()
+	usage, err := podMetrics(sampleCtx, cs)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cs != m.clientset {
+		m.clientset = cs
+		m.series = make(map[string]*metricsRing)
+	}
+	m.lastErr = err
+	if err != nil {
+		return
+	}
+	m.sampledAt = time.Now()
+
+	seen := make(map[string]bool, len(usage))
+	for _, u := range usage {
+		key := u.namespace + "/" + u.name
+		ring, ok := m.series[key]
+		if !ok {
+			if len(m.series) >= m.maxPods {
+				continue
+			}
+			ring = newMetricsRing(m.window)
+			m.series[key] = ring
+		}
+		ring.add(u.sample)
+		seen[key] = true
+	}
+	for key := range m.series {
+		if !seen[key] {
+			delete(m.series, key)
+		}
+	}
+}
+
+// Namespace returns the recorded series for every tracked pod in a
+// namespace, sorted by pod name
+func (m *MetricsHistory) Namespace(namespace string) *MetricsHistoryInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	info := m.info()
+	prefix := namespace + "/"
+	for key, ring := range m.series {
+		if name, ok := strings.CutPrefix(key, prefix); ok {
+			info.Pods = append(info.Pods, PodMetricsSeries{
+				Namespace: namespace,
+				Name:      name,
+				Samples:   ring.samples(),
+			})
+		}
+	}
+	sort.Slice(info.Pods, func(i, j int) bool {
+		return info.Pods[i].Name < info.Pods[j].Name
+	})
+	return info
+}
+
+// Pod returns the recorded series for one pod; Pods is empty when the pod
+// isn't tracked
+func (m *MetricsHistory) Pod(namespace, name string) *MetricsHistoryInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	info := m.info()
+	if ring, ok := m.series[namespace+"/"+name]; ok {
+		info.Pods = append(info.Pods, PodMetricsSeries{
+			Namespace: namespace,
+			Name:      name,
+			Samples:   ring.samples(),
+		})
+	}
+	return info
+}
+
+// info reports the sampler's state; callers hold mu
+func (m *MetricsHistory) info() *MetricsHistoryInfo {
+	info := &MetricsHistoryInfo{
+		Available: m.lastErr == nil && !m.sampledAt.IsZero(),
+		Interval:  m.interval.String(),
+		Window:    m.window,
+		Pods:      []PodMetricsSeries{},
+	}
+	if m.lastErr != nil {
+		info.Error = m.lastErr.Error()
+	}
+	if !m.sampledAt.IsZero() {
+		sampledAt := m.sampledAt
+		info.SampledAt = &sampledAt
+	}
+	return info
+}
+
+// metricsRing is a fixed-size ring of samples, oldest overwritten first
+type metricsRing struct {
+	buf   []MetricsSample
+	start int
+	count int
+}
+
+func newMetricsRing(size int) *metricsRing {
+	return &metricsRing{buf: make([]MetricsSample, size)}
+}
+
+func (r *metricsRing) add(s MetricsSample) {
+	// metrics-server only refreshes every scrape window, so the same
+	// reading can come back on consecutive ticks
+	if r.count > 0 && r.buf[(r.start+r.count-1)%len(r.buf)].Time.Equal(s.Time) {
+		return
+	}
+
+	if r.count < len(r.buf) {
+		r.buf[(r.start+r.count)%len(r.buf)] = s
+		r.count++
+		return
+	}
+	r.buf[r.start] = s
+	r.start = (r.start + 1) % len(r.buf)
+}
+
+// samples returns a copy of the ring, oldest first
+func (r *metricsRing) samples() []MetricsSample {
+	out := make([]MetricsSample, r.count)
+	for i := range out {
+		out[i] = r.buf[(r.start+i)%len(r.buf)]
+	}
+	return out
+}
@@ -0,0 +1,167 @@
+package k8s
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// nodeRoleLabelPrefix marks a node's roles, e.g.
+// node-role.kubernetes.io/control-plane
+const nodeRoleLabelPrefix = "node-role.kubernetes.io/"
+
+// activePodsSelector leaves out finished pods, which no longer hold any of
+// their node's resources
+var activePodsSelector = fields.AndSelectors(
+	fields.OneTermNotEqualSelector("status.phase", string(corev1.PodSucceeded)),
+	fields.OneTermNotEqualSelector("status.phase", string(corev1.PodFailed)),
+)
+
+// GetNodes returns every node with its pod count against max pods and the
+// CPU and memory its pods request against what it can allocate, sorted by
+// name
+func (c *Client) GetNodes(ctx context.Context) ([]NodeInfo, error) {
+	cs := c.kube()
+
+	nodes, err := cs.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := cs.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: activePodsSelector.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byNode := make(map[string][]corev1.Pod)
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != "" {
+			byNode[pod.Spec.NodeName] = append(byNode[pod.Spec.NodeName], pod)
+		}
+	}
+
+	infos := make([]NodeInfo, 0, len(nodes.Items))
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		infos = append(infos, nodeToInfo(node, byNode[node.Name]))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return infos, nil
+}
+
+// GetNode returns one node with its pod and resource allocation
+func (c *Client) GetNode(ctx context.Context, name string) (*NodeInfo, error) {
+	cs := c.kube()
+
+	node, err := cs.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := cs.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.AndSelectors(
+			fields.OneTermEqualSelector("spec.nodeName", name),
+			activePodsSelector,
+		).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info := nodeToInfo(node, pods.Items)
+	return &info, nil
+}
+
+func nodeToInfo(node *corev1.Node, pods []corev1.Pod) NodeInfo {
+	age := time.Since(node.CreationTimestamp.Time)
+	info := NodeInfo{
+		Name:           node.Name,
+		Roles:          nodeRoles(node),
+		Unschedulable:  node.Spec.Unschedulable,
+		KubeletVersion: node.Status.NodeInfo.KubeletVersion,
+		Age:            age,
+		AgeHuman:       humanDuration(age),
+	}
+
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			info.Ready = cond.Status == corev1.ConditionTrue
+		}
+	}
+
+	var cpu, memory int64
+	for i := range pods {
+		podCPU, podMemory := podRequests(&pods[i])
+		cpu += podCPU
+		memory += podMemory
+	}
+
+	allocatable := node.Status.Allocatable
+	info.Pods = newNodeAllocation(int64(len(pods)), allocatable.Pods().Value())
+	info.CPU = newNodeAllocation(cpu, allocatable.Cpu().MilliValue())
+	info.Memory = newNodeAllocation(memory, allocatable.Memory().Value())
+
+	return info
+}
+
+func nodeRoles(node *corev1.Node) []string {
+	var roles []string
+	for label := range node.Labels {
+		if role, ok := strings.CutPrefix(label, nodeRoleLabelPrefix); ok && role != "" {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+func newNodeAllocation(allocated, allocatable int64) NodeAllocation {
+	a := NodeAllocation{Allocated: allocated, Allocatable: allocatable}
+	if allocatable > 0 {
+		a.Percent = math.Round(float64(allocated)/float64(allocatable)*1000) / 10
+	}
+	return a
+}
+
+// podRequests returns the CPU (millicores) and memory (bytes) a pod
+// reserves on its node, computed the way the scheduler does: the larger of
+// its containers' requests and its biggest init container, plus sidecars
+// (init containers that keep running) and the pod overhead
+func podRequests(pod *corev1.Pod) (cpu, memory int64) {
+	var sidecarCPU, sidecarMemory, initCPU, initMemory int64
+	for _, c := range pod.Spec.InitContainers {
+		req := c.Resources.Requests
+		if c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			sidecarCPU += req.Cpu().MilliValue()
+			sidecarMemory += req.Memory().Value()
+			continue
+		}
+		// A regular init container runs alongside the sidecars started
+		// before it
+		initCPU = max(initCPU, sidecarCPU+req.Cpu().MilliValue())
+		initMemory = max(initMemory, sidecarMemory+req.Memory().Value())
+	}
+
+	for _, c := range pod.Spec.Containers {
+		cpu += c.Resources.Requests.Cpu().MilliValue()
+		memory += c.Resources.Requests.Memory().Value()
+	}
+	cpu = max(cpu+sidecarCPU, initCPU)
+	memory = max(memory+sidecarMemory, initMemory)
+
+	overhead := pod.Spec.Overhead
+	cpu += overhead.Cpu().MilliValue()
+	memory += overhead.Memory().Value()
+	return cpu, memory
+}
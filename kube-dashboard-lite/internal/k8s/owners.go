@@ -0,0 +1,44 @@
+package k8s
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ownerChain walks a pod's controller references up to the top-level
+// workload, nearest owner first: a Deployment's pod gives ReplicaSet then
+// Deployment, and a CronJob's gives Job then CronJob. Pods owned directly
+// by a StatefulSet, DaemonSet or other controller stop at that owner. An
+// owner that can't be read, because it's gone or RBAC forbids it, ends the
+// chain there rather than failing the pod.
+func ownerChain(ctx context.Context, cs *kubernetes.Clientset, pod *corev1.Pod) []OwnerInfo {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return nil
+	}
+
+	chain := []OwnerInfo{{Kind: ref.Kind, Name: ref.Name}}
+	var parent *metav1.OwnerReference
+	switch ref.Kind {
+	case "ReplicaSet":
+		rs, err := cs.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return chain
+		}
+		parent = metav1.GetControllerOf(rs)
+	case "Job":
+		job, err := cs.BatchV1().Jobs(pod.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return chain
+		}
+		parent = metav1.GetControllerOf(job)
+	}
+
+	if parent != nil {
+		chain = append(chain, OwnerInfo{Kind: parent.Kind, Name: parent.Name})
+	}
+	return chain
+}
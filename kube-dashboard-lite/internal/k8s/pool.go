@@ -0,0 +1,45 @@
+package k8s
+
+import "sync"
+
+// Pool holds one Client per kubeconfig context, created on first use, so a
+// request can target any cluster without switching the active context
+type Pool struct {
+	base    *Client
+	mu      sync.Mutex
+	clients map[string]*Client
+}
+
+// NewPool creates a pool over the same config source as base
+func NewPool(base *Client) *Pool {
+	return &Pool{
+		base:    base,
+		clients: make(map[string]*Client),
+	}
+}
+
+// Get returns the client for a context, connecting on first use
+func (p *Pool) Get(contextName string) (*Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if c, ok := p.clients[contextName]; ok {
+		return c, nil
+	}
+
+	c, err := NewClient(p.base.options(contextName))
+	if err != nil {
+		return nil, err
+	}
+	p.clients[contextName] = c
+
+	return c, nil
+}
+
+// Reset drops every pooled client, for when base's config source changes
+func (p *Pool) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.clients = make(map[string]*Client)
+}
@@ -0,0 +1,88 @@
+package k8s
+
+import (
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Where a RestartEvent was derived from
+const (
+	RestartSourceTermination = "lastTermination"
+	RestartSourceEvent       = "event"
+)
+
+// maxRestartEvents caps a pod's restart timeline
+const maxRestartEvents = 20
+
+// restartTimeline builds a pod's restart timeline, newest first, from each
+// container's last termination and, when events is non-nil, the kubelet's
+// BackOff events and liveness kills. The kubelet only keeps the last
+// termination and folds repeated events into one with a count, so a
+// timeline is a handful of entries rather than one per restart; an event's
+// count over its FirstSeen to Time span gives the restart rate.
+func restartTimeline(pod *corev1.Pod, events []corev1.Event) []RestartEvent {
+	var timeline []RestartEvent
+
+	statuses := append(append([]corev1.ContainerStatus(nil), pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		terminated := status.LastTerminationState.Terminated
+		if status.RestartCount == 0 || terminated == nil {
+			continue
+		}
+		exitCode := terminated.ExitCode
+		timeline = append(timeline, RestartEvent{
+			Container: status.Name,
+			Time:      terminated.FinishedAt.Time,
+			Count:     1,
+			Source:    RestartSourceTermination,
+			Reason:    terminated.Reason,
+			Message:   terminated.Message,
+			ExitCode:  &exitCode,
+		})
+	}
+
+	for i := range events {
+		e := &events[i]
+		if !isRestartEvent(e) {
+			continue
+		}
+		entry := RestartEvent{
+			Time:    eventLastSeen(e),
+			Count:   max(e.Count, 1),
+			Source:  RestartSourceEvent,
+			Reason:  e.Reason,
+			Message: e.Message,
+		}
+		if name, ok := strings.CutPrefix(e.InvolvedObject.FieldPath, "spec.containers{"); ok {
+			entry.Container = strings.TrimSuffix(name, "}")
+		}
+		if !e.FirstTimestamp.IsZero() {
+			firstSeen := e.FirstTimestamp.Time
+			entry.FirstSeen = &firstSeen
+		}
+		timeline = append(timeline, entry)
+	}
+
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].Time.After(timeline[j].Time)
+	})
+	if len(timeline) > maxRestartEvents {
+		timeline = timeline[:maxRestartEvents]
+	}
+	return timeline
+}
+
+// isRestartEvent reports whether a pod event marks a container restart: a
+// crash-looping container backing off, or one killed by its liveness probe.
+// Kills for other reasons, such as the pod being deleted, don't count.
+func isRestartEvent(e *corev1.Event) bool {
+	switch e.Reason {
+	case "BackOff":
+		return strings.HasPrefix(e.Message, "Back-off restarting")
+	case "Killing":
+		return strings.Contains(e.Message, "will be restarted")
+	}
+	return false
+}
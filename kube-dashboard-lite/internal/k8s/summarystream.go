@@ -0,0 +1,218 @@
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// summaryDebounce is how long a namespace summary waits after a change
+// before it is recomputed, so a burst such as a rollout's pod updates costs
+// one recompute and one update per watcher
+const summaryDebounce = time.Second
+
+// WatchNamespaceSummary streams a namespace's summary: the current one once
+// known, then a new one whenever its pod, deployment, service or event
+// counts change, at most one per summaryDebounce. Every watcher of a
+// namespace shares one set of informers, so the summary is computed from
+// their caches rather than listed per watcher; they run until the last
+// watcher's ctx is done. The channel is closed when ctx is done.
+func (c *Client) WatchNamespaceSummary(ctx context.Context, namespace string) (<-chan NamespaceSummary, error) {
+	cs := c.kube()
+
+	// Fail fast on a namespace we can't read; an informer would retry
+	// forever without a word
+	if _, err := cs.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{Limit: 1}); err != nil {
+		return nil, err
+	}
+
+	key := summaryFeedKey{cs: cs, namespace: namespace}
+	updates := make(chan NamespaceSummary, 1)
+
+	c.summaryMu.Lock()
+	if c.summaryFeeds == nil {
+		c.summaryFeeds = make(map[summaryFeedKey]*summaryFeed)
+	}
+	feed, ok := c.summaryFeeds[key]
+	if !ok {
+		feed = newSummaryFeed(cs, namespace)
+		c.summaryFeeds[key] = feed
+		go feed.run()
+	}
+	feed.subscribe(updates)
+	c.summaryMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		c.summaryMu.Lock()
+		defer c.summaryMu.Unlock()
+		if feed.unsubscribe(updates) {
+			close(feed.stop)
+			delete(c.summaryFeeds, key)
+		}
+	}()
+
+	return updates, nil
+}
+
+// summaryFeedKey identifies a feed by clientset as well as namespace, so
+// watchers from before a context switch keep the cluster they started on
+type summaryFeedKey struct {
+	cs        *kubernetes.Clientset
+	namespace string
+}
+
+// summaryFeed keeps a namespace's summary current from informer caches
+// and fans it out to the namespace's watchers
+type summaryFeed struct {
+	namespace string
+	factory   informers.SharedInformerFactory
+	stop      chan struct{}
+	changed   chan struct{}
+
+	pods        cache.SharedIndexInformer
+	deployments cache.SharedIndexInformer
+	services    cache.SharedIndexInformer
+	events      cache.SharedIndexInformer
+
+	mu       sync.Mutex
+	latest   *NamespaceSummary
+	watchers map[chan NamespaceSummary]bool
+}
+
+func newSummaryFeed(cs *kubernetes.Clientset, namespace string) *summaryFeed {
+	factory := informers.NewSharedInformerFactoryWithOptions(cs, 0, informers.WithNamespace(namespace))
+	f := &summaryFeed{
+		namespace:   namespace,
+		factory:     factory,
+		stop:        make(chan struct{}),
+		changed:     make(chan struct{}, 1),
+		pods:        factory.Core().V1().Pods().Informer(),
+		deployments: factory.Apps().V1().Deployments().Informer(),
+		services:    factory.Core().V1().Services().Informer(),
+		events:      factory.Core().V1().Events().Informer(),
+		watchers:    make(map[chan NamespaceSummary]bool),
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { f.notify() },
+		UpdateFunc: func(interface{}, interface{}) { f.notify() },
+		DeleteFunc: func(interface{}) { f.notify() },
+	}
+	for _, informer := range []cache.SharedIndexInformer{f.pods, f.deployments, f.services, f.events} {
+		informer.AddEventHandler(handler)
+	}
+	return f
+}
+
+func (f *summaryFeed) run() {
+	f.factory.Start(f.stop)
+	defer f.factory.Shutdown()
+
+	if !cache.WaitForCacheSync(f.stop, f.pods.HasSynced, f.deployments.HasSynced, f.services.HasSynced, f.events.HasSynced) {
+		return
+	}
+	// The initial listing's adds are all in the first summary
+	select {
+	case <-f.changed:
+	default:
+	}
+
+	for {
+		f.publish()
+
+		select {
+		case <-f.stop:
+			return
+		case <-f.changed:
+		}
+		select {
+		case <-f.stop:
+			return
+		case <-time.After(summaryDebounce):
+		}
+	}
+}
+
+// notify marks the summary as out of date without blocking the informer
+func (f *summaryFeed) notify() {
+	select {
+	case f.changed <- struct{}{}:
+	default:
+	}
+}
+
+// publish sends the summary to every watcher if it changed. A watcher that
+// hasn't taken the previous one yet only gets the newer.
+func (f *summaryFeed) publish() {
+	summary := f.summary()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.latest != nil && reflect.DeepEqual(*f.latest, summary) {
+		return
+	}
+	f.latest = &summary
+	for updates := range f.watchers {
+		sendLatest(updates, summary)
+	}
+}
+
+func (f *summaryFeed) summary() NamespaceSummary {
+	var pods []corev1.Pod
+	for _, obj := range f.pods.GetStore().List() {
+		if pod, ok := obj.(*corev1.Pod); ok {
+			pods = append(pods, *pod)
+		}
+	}
+
+	return NamespaceSummary{
+		Namespace:   f.namespace,
+		Pods:        len(pods),
+		PodsByPhase: podPhaseCounts(pods),
+		Deployments: len(f.deployments.GetStore().ListKeys()),
+		Services:    len(f.services.GetStore().ListKeys()),
+		Events:      len(f.events.GetStore().ListKeys()),
+	}
+}
+
+// subscribe adds a watcher, sending it the current summary if there is one
+func (f *summaryFeed) subscribe(updates chan NamespaceSummary) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.watchers[updates] = true
+	if f.latest != nil {
+		sendLatest(updates, *f.latest)
+	}
+}
+
+// unsubscribe removes a watcher and closes its channel, reporting whether
+// it was the last
+func (f *summaryFeed) unsubscribe(updates chan NamespaceSummary) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.watchers, updates)
+	close(updates)
+	return len(f.watchers) == 0
+}
+
+// sendLatest puts summary in a one-slot channel, dropping any summary not yet
+// taken. Callers hold the feed's mu, so no other send can fill the slot.
+func sendLatest(updates chan NamespaceSummary, summary NamespaceSummary) {
+	select {
+	case <-updates:
+	default:
+	}
+	updates <- summary
+}
@@ -0,0 +1,129 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// fakeSummaryAPI serves one namespace's pods, deployments, services and
+// events, counting the lists made of each. Watches stay open and quiet.
+type fakeSummaryAPI struct {
+	mu    sync.Mutex
+	lists map[string]int
+	quit  chan struct{}
+}
+
+var fakeSummaryLists = map[string]string{
+	"pods": `{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"1"},"items":[
+		{"metadata":{"name":"a","namespace":"ns","resourceVersion":"1"},"status":{"phase":"Running"}},
+		{"metadata":{"name":"b","namespace":"ns","resourceVersion":"1"},"status":{"phase":"Pending"}}]}`,
+	"deployments": `{"kind":"DeploymentList","apiVersion":"apps/v1","metadata":{"resourceVersion":"1"},"items":[
+		{"metadata":{"name":"web","namespace":"ns","resourceVersion":"1"}}]}`,
+	"services": `{"kind":"ServiceList","apiVersion":"v1","metadata":{"resourceVersion":"1"},"items":[
+		{"metadata":{"name":"web","namespace":"ns","resourceVersion":"1"}}]}`,
+	"events": `{"kind":"EventList","apiVersion":"v1","metadata":{"resourceVersion":"1"},"items":[]}`,
+}
+
+func (f *fakeSummaryAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resource := path.Base(r.URL.Path)
+	body, ok := fakeSummaryLists[resource]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Query().Get("watch") == "true" {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-f.quit:
+		}
+		return
+	}
+
+	// The fail-fast probe lists with limit=1; only count the informers'
+	if r.URL.Query().Get("limit") != "1" {
+		f.mu.Lock()
+		f.lists[resource]++
+		f.mu.Unlock()
+	}
+	fmt.Fprint(w, body)
+}
+
+func TestWatchNamespaceSummaryShared(t *testing.T) {
+	api := &fakeSummaryAPI{lists: make(map[string]int), quit: make(chan struct{})}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	defer close(api.quit)
+
+	cs, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{clientset: cs}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel1()
+	defer cancel2()
+
+	first, err := c.WatchNamespaceSummary(ctx1, "ns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.WatchNamespaceSummary(ctx2, "ns")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, updates := range []<-chan NamespaceSummary{first, second} {
+		select {
+		case summary := <-updates:
+			if summary.Pods != 2 || summary.PodsByPhase["Running"] != 1 || summary.PodsByPhase["Pending"] != 1 ||
+				summary.Deployments != 1 || summary.Services != 1 || summary.Events != 0 {
+				t.Errorf("summary = %+v", summary)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no summary within 5s")
+		}
+	}
+
+	api.mu.Lock()
+	for resource := range fakeSummaryLists {
+		if n := api.lists[resource]; n != 1 {
+			t.Errorf("%s listed %d times, want once for both watchers", resource, n)
+		}
+	}
+	api.mu.Unlock()
+
+	cancel1()
+	cancel2()
+	for _, updates := range []<-chan NamespaceSummary{first, second} {
+		select {
+		case _, ok := <-updates:
+			if ok {
+				// A pending summary may still be buffered
+				<-updates
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("channel not closed after cancel")
+		}
+	}
+
+	c.summaryMu.Lock()
+	defer c.summaryMu.Unlock()
+	if len(c.summaryFeeds) != 0 {
+		t.Errorf("%d feeds left running after every watcher left", len(c.summaryFeeds))
+	}
+}
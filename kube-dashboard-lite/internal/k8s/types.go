@@ -12,9 +12,11 @@ type ContextInfo struct {
 
 // NamespaceInfo represents a namespace
 type NamespaceInfo struct {
-	Name   string        `json:"name"`
-	Status string        `json:"status"`
-	Age    time.Duration `json:"age"`
+	Name     string        `json:"name"`
+	Status   string        `json:"status"`
+	Age      time.Duration `json:"age"`
+	AgeHuman string        `json:"ageHuman"`
+	Favorite bool          `json:"favorite,omitempty"`
 }
 
 // PodInfo represents basic pod information
@@ -25,24 +27,133 @@ type PodInfo struct {
 	Ready     string            `json:"ready"`
 	Restarts  int32             `json:"restarts"`
 	Age       time.Duration     `json:"age"`
+	AgeHuman  string            `json:"ageHuman"`
 	Node      string            `json:"node"`
 	IP        string            `json:"ip"`
 	Labels    map[string]string `json:"labels,omitempty"`
+	// ImagePullError is set when any container can't pull its image
+	ImagePullError bool `json:"imagePullError,omitempty"`
+	// StartTime is when the kubelet started the pod, unset until scheduled
+	StartTime *time.Time `json:"startTime,omitempty"`
 }
 
 // PodDetail represents detailed pod information
 type PodDetail struct {
 	PodInfo
-	Containers []ContainerInfo `json:"containers"`
+	Containers     []ContainerInfo     `json:"containers"`
+	Conditions     []PodCondition      `json:"conditions,omitempty"`
+	ReadinessGates []ReadinessGateInfo `json:"readinessGates,omitempty"`
+	// OwnerChain is the pod's controllers, nearest first, e.g. its
+	// ReplicaSet and then that ReplicaSet's Deployment
+	OwnerChain []OwnerInfo `json:"ownerChain,omitempty"`
+	// RestartTimeline is when and why the pod's containers restarted,
+	// newest first
+	RestartTimeline []RestartEvent `json:"restartTimeline,omitempty"`
+	// ResourceVersion can be passed back to a write as a precondition
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+// RestartEvent is an entry in a pod's restart timeline. One from a
+// container's last termination is a single restart with its exit code; one
+// from an event is Count occurrences between FirstSeen and Time.
+type RestartEvent struct {
+	Container string     `json:"container,omitempty"`
+	Time      time.Time  `json:"time"`
+	FirstSeen *time.Time `json:"firstSeen,omitempty"`
+	Count     int32      `json:"count"`
+	Source    string     `json:"source"` // "lastTermination" or "event"
+	Reason    string     `json:"reason"` // e.g. OOMKilled, Error, BackOff
+	Message   string     `json:"message,omitempty"`
+	ExitCode  *int32     `json:"exitCode,omitempty"`
+}
+
+// PodDescription is a pod's detail, recent events and log tails in one
+// payload, for a troubleshooting view
+type PodDescription struct {
+	Pod    *PodDetail      `json:"pod"`
+	Events []EventInfo     `json:"events"`
+	Logs   []ContainerLogs `json:"logs"`
+	Errors []string        `json:"errors,omitempty"` // parts that couldn't be read
+}
+
+// ContainerLogs is the tail of one container's log
+type ContainerLogs struct {
+	Container string   `json:"container"`
+	Lines     []string `json:"lines"`
+	Error     string   `json:"error,omitempty"` // e.g. the container hasn't started
+}
+
+// PodCondition represents a pod status condition such as PodScheduled
+type PodCondition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"`
+	Reason             string    `json:"reason,omitempty"`
+	Message            string    `json:"message,omitempty"`
+	LastTransitionTime time.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// ReadinessGateInfo represents a custom readiness gate and the status of
+// its condition. Status is empty until the condition is first reported,
+// which Kubernetes treats as False.
+type ReadinessGateInfo struct {
+	ConditionType string `json:"conditionType"`
+	Status        string `json:"status,omitempty"`
 }
 
 // ContainerInfo represents container information
 type ContainerInfo struct {
-	Name         string `json:"name"`
-	Image        string `json:"image"`
-	Ready        bool   `json:"ready"`
-	RestartCount int32  `json:"restartCount"`
-	State        string `json:"state"`
+	Name         string            `json:"name"`
+	Image        string            `json:"image"`
+	Ready        bool              `json:"ready"`
+	RestartCount int32             `json:"restartCount"`
+	State        string            `json:"state"`
+	Env          []EnvVarInfo      `json:"env,omitempty"`
+	VolumeMounts []VolumeMountInfo `json:"volumeMounts,omitempty"`
+
+	LivenessProbe  *ProbeInfo `json:"livenessProbe,omitempty"`
+	ReadinessProbe *ProbeInfo `json:"readinessProbe,omitempty"`
+	StartupProbe   *ProbeInfo `json:"startupProbe,omitempty"`
+	// ProbeFailures are the container's recent Unhealthy events, newest first
+	ProbeFailures []EventInfo `json:"probeFailures,omitempty"`
+	// ImagePull is set while the container is waiting on a failed image pull
+	ImagePull *ImagePullInfo `json:"imagePull,omitempty"`
+}
+
+// ImagePullInfo explains why a container's image can't be pulled. Message
+// is the kubelet's full error, naming the image reference and the registry
+// response (not found, unauthorized, ...).
+type ImagePullInfo struct {
+	Reason  string `json:"reason"`
+	Image   string `json:"image"`
+	Message string `json:"message,omitempty"`
+}
+
+// ProbeInfo represents a container probe. Handler is "httpGet", "tcpSocket",
+// "grpc" or "exec", and Target what it checks, e.g. "HTTP :8080/healthz".
+type ProbeInfo struct {
+	Handler             string `json:"handler"`
+	Target              string `json:"target"`
+	InitialDelaySeconds int32  `json:"initialDelaySeconds"`
+	PeriodSeconds       int32  `json:"periodSeconds"`
+	TimeoutSeconds      int32  `json:"timeoutSeconds"`
+	SuccessThreshold    int32  `json:"successThreshold"`
+	FailureThreshold    int32  `json:"failureThreshold"`
+}
+
+// EnvVarInfo represents a container environment variable. Values sourced
+// from secrets are never included, only the reference in ValueFrom.
+type EnvVarInfo struct {
+	Name      string `json:"name"`
+	Value     string `json:"value,omitempty"`
+	ValueFrom string `json:"valueFrom,omitempty"`
+}
+
+// VolumeMountInfo represents a container volume mount
+type VolumeMountInfo struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mountPath"`
+	SubPath   string `json:"subPath,omitempty"`
+	ReadOnly  bool   `json:"readOnly"`
 }
 
 // DeploymentInfo represents deployment information
@@ -53,9 +164,30 @@ type DeploymentInfo struct {
 	ReadyReplicas   int32             `json:"readyReplicas"`
 	UpdatedReplicas int32             `json:"updatedReplicas"`
 	Age             time.Duration     `json:"age"`
+	AgeHuman        string            `json:"ageHuman"`
 	Labels          map[string]string `json:"labels,omitempty"`
 }
 
+// DeploymentDetail represents detailed deployment information
+type DeploymentDetail struct {
+	DeploymentInfo
+	ReplicaSets []ReplicaSetInfo `json:"replicaSets"`
+	// ResourceVersion can be passed back to a write as a precondition
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+// ReplicaSetInfo represents a ReplicaSet owned by a deployment
+type ReplicaSetInfo struct {
+	Name            string        `json:"name"`
+	Revision        string        `json:"revision,omitempty"`
+	PodTemplateHash string        `json:"podTemplateHash,omitempty"`
+	Desired         int32         `json:"desired"`
+	Ready           int32         `json:"ready"`
+	Available       int32         `json:"available"`
+	Age             time.Duration `json:"age"`
+	AgeHuman        string        `json:"ageHuman"`
+}
+
 // ServiceInfo represents service information
 type ServiceInfo struct {
 	Name       string        `json:"name"`
@@ -65,6 +197,87 @@ type ServiceInfo struct {
 	ExternalIP string        `json:"externalIP,omitempty"`
 	Ports      []string      `json:"ports"`
 	Age        time.Duration `json:"age"`
+	AgeHuman   string        `json:"ageHuman"`
+}
+
+// ServiceDetail represents a service with its selector and the endpoints
+// behind it
+type ServiceDetail struct {
+	ServiceInfo
+	Selector  map[string]string `json:"selector,omitempty"`
+	Endpoints ServiceEndpoints  `json:"endpoints"`
+	// ResourceVersion can be passed back to a write as a precondition
+	ResourceVersion string `json:"resourceVersion"`
+}
+
+// ServiceEndpoints are the addresses a service routes to. Source is
+// "EndpointSlice", or "Endpoints" on clusters without EndpointSlices.
+type ServiceEndpoints struct {
+	Service   string            `json:"service"`
+	Namespace string            `json:"namespace"`
+	Source    string            `json:"source"`
+	Ready     []EndpointAddress `json:"ready"`
+	NotReady  []EndpointAddress `json:"notReady"`
+	Ports     []EndpointPort    `json:"ports"`
+}
+
+// EndpointAddress is one backend of a service, usually a pod
+type EndpointAddress struct {
+	IP          string `json:"ip"`
+	Hostname    string `json:"hostname,omitempty"`
+	Node        string `json:"node,omitempty"`
+	Pod         string `json:"pod,omitempty"`
+	Terminating bool   `json:"terminating,omitempty"`
+}
+
+// EndpointPort is a port the endpoints serve on
+type EndpointPort struct {
+	Name     string `json:"name,omitempty"`
+	Port     int32  `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+// HPAInfo represents a HorizontalPodAutoscaler and its scaling state
+type HPAInfo struct {
+	Name            string         `json:"name"`
+	Namespace       string         `json:"namespace"`
+	Target          HPATarget      `json:"target"`
+	Deployment      string         `json:"deployment,omitempty"` // set when the target is a Deployment
+	MinReplicas     int32          `json:"minReplicas"`
+	MaxReplicas     int32          `json:"maxReplicas"`
+	CurrentReplicas int32          `json:"currentReplicas"`
+	DesiredReplicas int32          `json:"desiredReplicas"`
+	Metrics         []HPAMetric    `json:"metrics"`
+	Conditions      []HPACondition `json:"conditions,omitempty"`
+	LastScaleTime   *time.Time     `json:"lastScaleTime,omitempty"`
+	Age             time.Duration  `json:"age"`
+	AgeHuman        string         `json:"ageHuman"`
+}
+
+// HPATarget is the workload an HPA scales
+type HPATarget struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	APIVersion string `json:"apiVersion,omitempty"`
+}
+
+// HPAMetric is one scaling metric with its target and latest value, e.g.
+// resource cpu at 45% against a target of 80%
+type HPAMetric struct {
+	Type      string `json:"type"` // Resource, ContainerResource, Pods, Object or External
+	Name      string `json:"name"`
+	Container string `json:"container,omitempty"`
+	Target    string `json:"target"`
+	Current   string `json:"current,omitempty"` // empty until the metric has been read
+}
+
+// HPACondition explains whether an HPA can scale and why it may be held
+// back, e.g. ScalingLimited at maxReplicas
+type HPACondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
 }
 
 // EventInfo represents an event
@@ -78,6 +291,110 @@ type EventInfo struct {
 	LastSeen  time.Time `json:"lastSeen"`
 }
 
+// EventUpdate is an event delivered by WatchEvents. ResourceVersion can be
+// passed back to WatchEvents to resume after it.
+type EventUpdate struct {
+	Event           EventInfo
+	ResourceVersion string
+}
+
+// NamespaceSummary represents aggregate resource counts for a namespace
+type NamespaceSummary struct {
+	Namespace   string         `json:"namespace"`
+	Pods        int            `json:"pods"`
+	PodsByPhase map[string]int `json:"podsByPhase"`
+	Deployments int            `json:"deployments"`
+	Services    int            `json:"services"`
+	Events      int            `json:"events"`
+}
+
+// DrainResult reports the outcome of draining a node
+type DrainResult struct {
+	Node    string            `json:"node"`
+	Evicted []string          `json:"evicted"`
+	Skipped []string          `json:"skipped,omitempty"`
+	Failed  map[string]string `json:"failed,omitempty"`
+	DryRun  bool              `json:"dryRun,omitempty"`
+}
+
+// RolloutStatus reports the progress of a deployment rollout
+type RolloutStatus struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Desired   int32  `json:"desired"`
+	Updated   int32  `json:"updated"`
+	Ready     int32  `json:"ready"`
+	Available int32  `json:"available"`
+	Complete  bool   `json:"complete"`
+}
+
+// RestartAllResult reports the outcome of restarting every deployment in a namespace
+type RestartAllResult struct {
+	Namespace string            `json:"namespace"`
+	Restarted []string          `json:"restarted"`
+	Failed    map[string]string `json:"failed,omitempty"`
+	DryRun    bool              `json:"dryRun,omitempty"`
+}
+
+// DeletePodOptions for pod deletion
+type DeletePodOptions struct {
+	// DryRun validates the deletion server-side without applying it
+	DryRun bool
+	// Force deletes immediately with a grace period of 0
+	Force bool
+	// ResourceVersion, when set, deletes only if the pod hasn't changed
+	// since it was read at that version; otherwise the delete fails with a
+	// conflict
+	ResourceVersion string
+}
+
+// DeletePodResult reports a pod deletion and whether the pod's controller
+// will replace it
+type DeletePodResult struct {
+	Pod             PodInfo    `json:"pod"`
+	Owner           *OwnerInfo `json:"owner,omitempty"`
+	WillBeRecreated bool       `json:"willBeRecreated"`
+	DryRun          bool       `json:"dryRun,omitempty"`
+	Force           bool       `json:"force,omitempty"`
+}
+
+// DeletePodsResult reports the outcome of deleting the pods matching a
+// label selector. Pods that were already gone count as neither.
+type DeletePodsResult struct {
+	Namespace    string            `json:"namespace"`
+	Selector     string            `json:"selector"`
+	DeletedCount int               `json:"deletedCount"`
+	FailedCount  int               `json:"failedCount"`
+	Deleted      []string          `json:"deleted"`
+	Failed       map[string]string `json:"failed,omitempty"`
+	DryRun       bool              `json:"dryRun,omitempty"`
+	Force        bool              `json:"force,omitempty"`
+}
+
+// OwnerInfo identifies the controller managing an object
+type OwnerInfo struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// ManifestDiff is a field-level diff between a live object and what it would
+// become if a manifest were applied
+type ManifestDiff struct {
+	Kind      string        `json:"kind"`
+	Namespace string        `json:"namespace,omitempty"`
+	Name      string        `json:"name"`
+	Exists    bool          `json:"exists"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+// FieldChange is one differing field. Op is "added", "removed" or "changed".
+type FieldChange struct {
+	Path string      `json:"path"`
+	Op   string      `json:"op"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
 // ClusterInfo represents cluster information
 type ClusterInfo struct {
 	Context   string `json:"context"`
@@ -88,9 +405,76 @@ type ClusterInfo struct {
 	BuildDate string `json:"buildDate"`
 }
 
+// NodeInfo represents a node and how full it is: pods scheduled against its
+// max pods, and the CPU and memory those pods request against what it can
+// allocate
+type NodeInfo struct {
+	Name           string         `json:"name"`
+	Roles          []string       `json:"roles,omitempty"`
+	Ready          bool           `json:"ready"`
+	Unschedulable  bool           `json:"unschedulable"`
+	KubeletVersion string         `json:"kubeletVersion"`
+	Age            time.Duration  `json:"age"`
+	AgeHuman       string         `json:"ageHuman"`
+	Pods           NodeAllocation `json:"pods"`
+	CPU            NodeAllocation `json:"cpu"`    // millicores
+	Memory         NodeAllocation `json:"memory"` // bytes
+}
+
+// NodeAllocation compares what a node's pods have claimed with what it can
+// allocate; Percent is 0 when the node reports nothing allocatable
+type NodeAllocation struct {
+	Allocated   int64   `json:"allocated"`
+	Allocatable int64   `json:"allocatable"`
+	Percent     float64 `json:"percent"`
+}
+
+// MetricsSample is a pod's usage at one point in time, summed over its
+// containers
+type MetricsSample struct {
+	Time          time.Time `json:"time"`
+	CPUMillicores int64     `json:"cpuMillicores"`
+	MemoryBytes   int64     `json:"memoryBytes"`
+}
+
+// PodMetricsSeries is a pod's recent usage, oldest sample first
+type PodMetricsSeries struct {
+	Namespace string          `json:"namespace"`
+	Name      string          `json:"name"`
+	Samples   []MetricsSample `json:"samples"`
+}
+
+// MetricsHistoryInfo is the recorded usage history with the sampler's
+// state. Available is false until metrics-server has been read, and Error
+// explains the last failed read.
+type MetricsHistoryInfo struct {
+	Available bool               `json:"available"`
+	Error     string             `json:"error,omitempty"`
+	SampledAt *time.Time         `json:"sampledAt,omitempty"`
+	Interval  string             `json:"interval"`
+	Window    int                `json:"window"`
+	Pods      []PodMetricsSeries `json:"pods"`
+}
+
+// PodOptions for pod listing
+type PodOptions struct {
+	// Node keeps only pods scheduled on this node; empty keeps all
+	Node string
+}
+
+// EventOptions for event retrieval
+type EventOptions struct {
+	// Since keeps only events last seen within this duration; zero keeps all
+	Since time.Duration
+	// Limit caps the number of events returned, most recent first; zero is unlimited
+	Limit int
+}
+
 // LogOptions for log retrieval
 type LogOptions struct {
 	Follow       bool
 	TailLines    int
 	SinceSeconds int
+	// Timestamps prefixes each line with its RFC3339 timestamp
+	Timestamps bool
 }
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"embed"
+	"encoding/json"
 	"fmt"
 	"io/fs"
 	"net/http"
@@ -25,8 +26,42 @@ type Config struct {
 	Port      int
 	Host      string
 	WriteMode bool
+
+	// LogBatchWindow is how long followed log lines are coalesced before
+	// being flushed to the client; zero uses defaultLogBatchWindow and a
+	// negative window flushes every line
+	LogBatchWindow time.Duration
+
+	// FavoritesFile persists favorite namespaces; empty keeps them in
+	// memory only
+	FavoritesFile string
+
+	// MetricsInterval is how often pod usage is sampled from metrics-server
+	// for the usage history; zero disables sampling. MetricsWindow samples
+	// are kept for each of up to MetricsMaxPods pods.
+	MetricsInterval time.Duration
+	MetricsWindow   int
+	MetricsMaxPods  int
+
+	// Build info, set from main at link time
+	Version   string
+	Commit    string
+	BuildDate string
 }
 
+// Defaults for a usage history when the config leaves its bounds unset
+const (
+	defaultMetricsWindow  = 40
+	defaultMetricsMaxPods = 500
+)
+
+// defaultLogBatchWindow batches followed logs when the config leaves the
+// window unset
+const defaultLogBatchWindow = 100 * time.Millisecond
+
+// requestTimeout bounds every request except the streaming endpoints
+const requestTimeout = 60 * time.Second
+
 // Server represents the dashboard server
 type Server struct {
 	cfg       Config
@@ -34,6 +69,10 @@ type Server struct {
 	k8sClient *k8s.Client
 	logger    zerolog.Logger
 	server    *http.Server
+
+	// metrics samples pod usage while the server runs; nil when disabled
+	metrics     *k8s.MetricsHistory
+	stopMetrics context.CancelFunc
 }
 
 // New creates a new server
@@ -44,6 +83,21 @@ func New(cfg Config, k8sClient *k8s.Client, logger zerolog.Logger) *Server {
 		logger:    logger,
 	}
 
+	if s.cfg.LogBatchWindow == 0 {
+		s.cfg.LogBatchWindow = defaultLogBatchWindow
+	}
+
+	if cfg.MetricsInterval > 0 {
+		window, maxPods := cfg.MetricsWindow, cfg.MetricsMaxPods
+		if window <= 0 {
+			window = defaultMetricsWindow
+		}
+		if maxPods <= 0 {
+			maxPods = defaultMetricsMaxPods
+		}
+		s.metrics = k8s.NewMetricsHistory(k8sClient, cfg.MetricsInterval, window, maxPods)
+	}
+
 	s.setupRouter()
 
 	return s
@@ -57,51 +111,55 @@ func (s *Server) setupRouter() {
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
 
 	// CORS for local development
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Content-Type"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
 	// Create handler
-	h := handlers.New(s.k8sClient, s.cfg.WriteMode, s.logger)
+	h := handlers.New(s.k8sClient, s.cfg.WriteMode, s.cfg.LogBatchWindow, s.logger)
+	if s.cfg.FavoritesFile != "" {
+		if err := h.LoadFavorites(s.cfg.FavoritesFile); err != nil {
+			s.logger.Warn().Err(err).Msg("Failed to load favorite namespaces, starting with none")
+		}
+	}
+	if s.metrics != nil {
+		h.SetMetricsHistory(s.metrics)
+	}
 
 	// API routes
 	r.Route("/api", func(r chi.Router) {
-		// Cluster
-		r.Get("/cluster", h.GetClusterInfo)
-		r.Get("/contexts", h.GetContexts)
-		r.Post("/contexts/{name}", h.SwitchContext)
-
-		// Namespaces
-		r.Get("/namespaces", h.GetNamespaces)
-
-		// Pods
-		r.Get("/namespaces/{namespace}/pods", h.GetPods)
-		r.Get("/namespaces/{namespace}/pods/{name}", h.GetPod)
-		r.Get("/namespaces/{namespace}/pods/{name}/logs", h.GetPodLogs)
-		r.Delete("/namespaces/{namespace}/pods/{name}", h.DeletePod)
+		// Streams run until the client goes away, so they get neither the
+		// request timeout nor the server's write timeout
+		r.Group(func(r chi.Router) {
+			r.Use(withoutWriteDeadline)
 
-		// Deployments
-		r.Get("/namespaces/{namespace}/deployments", h.GetDeployments)
-		r.Post("/namespaces/{namespace}/deployments/{name}/restart", h.RestartDeployment)
+			r.Get("/namespaces/{namespace}/summary/stream", h.StreamNamespaceSummary)
+			r.Get("/namespaces/{namespace}/pods/{name}/logs", h.GetPodLogs) // streams with ?follow=true
+			r.Get("/namespaces/{namespace}/events/stream", h.StreamEvents)
+			r.Get("/namespaces/{namespace}/deployments/{name}/rollout/stream", h.StreamRollout)
+			r.Get("/namespaces/{namespace}/deployments/{name}/logs", h.StreamDeploymentLogs)
+		})
 
-		// Services
-		r.Get("/namespaces/{namespace}/services", h.GetServices)
-
-		// Events
-		r.Get("/namespaces/{namespace}/events", h.GetEvents)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Timeout(requestTimeout))
+			s.routes(r, h)
+		})
 	})
 
 	// Health check
-	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+	r.With(middleware.Timeout(requestTimeout)).Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		info := s.buildInfo()
+		info["status"] = "ok"
+
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"ok"}`))
+		json.NewEncoder(w).Encode(info)
 	})
 
 	// Serve static files
@@ -111,11 +169,100 @@ func (s *Server) setupRouter() {
 	}
 
 	fileServer := http.FileServer(http.FS(staticContent))
-	r.Handle("/*", fileServer)
+	r.With(middleware.Timeout(requestTimeout)).Handle("/*", fileServer)
 
 	s.router = r
 }
 
+// routes mounts the API's request-response endpoints
+func (s *Server) routes(r chi.Router, h *handlers.Handler) {
+	// Version
+	r.Get("/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.buildInfo())
+	})
+
+	// Cluster
+	r.Get("/cluster", h.GetClusterInfo)
+	r.Get("/contexts", h.GetContexts)
+	r.Post("/contexts/{name}", h.SwitchContext)
+	r.Post("/kubeconfig", h.UploadKubeconfig)
+
+	// Namespaces
+	r.Get("/namespaces", h.GetNamespaces)
+	r.Get("/namespaces/{namespace}/summary", h.GetNamespaceSummary)
+	r.Get("/namespaces/{namespace}/bundle", h.ExportNamespace)
+	r.Get("/namespaces/{namespace}/metrics/pods", h.GetNamespaceMetrics)
+
+	// Favorite namespaces
+	r.Get("/favorites/namespaces", h.GetFavoriteNamespaces)
+	r.Put("/favorites/namespaces/{namespace}", h.AddFavoriteNamespace)
+	r.Delete("/favorites/namespaces/{namespace}", h.RemoveFavoriteNamespace)
+
+	// Pods
+	r.Get("/namespaces/{namespace}/pods", h.GetPods)
+	r.Delete("/namespaces/{namespace}/pods", h.DeletePodsByLabel)
+	r.Get("/namespaces/{namespace}/pods/{name}", h.GetPod)
+	r.Get("/namespaces/{namespace}/pods/{name}/describe", h.DescribePod)
+	r.Get("/namespaces/{namespace}/pods/{name}/metrics", h.GetPodMetrics)
+	r.Delete("/namespaces/{namespace}/pods/{name}", h.DeletePod)
+
+	// Deployments
+	r.Get("/namespaces/{namespace}/deployments", h.GetDeployments)
+	r.Get("/namespaces/{namespace}/deployments/{name}", h.GetDeployment)
+	r.Get("/namespaces/{namespace}/deployments/{name}/replicasets", h.GetReplicaSets)
+	r.Post("/namespaces/{namespace}/deployments/{name}/restart", h.RestartDeployment)
+	r.Post("/namespaces/{namespace}/deployments/restart-all", h.RestartAllDeployments)
+
+	// Services
+	r.Get("/namespaces/{namespace}/services", h.GetServices)
+	r.Get("/namespaces/{namespace}/services/{name}", h.GetService)
+	r.Get("/namespaces/{namespace}/services/{name}/endpoints", h.GetEndpoints)
+
+	// Config
+	r.Delete("/namespaces/{namespace}/configmaps/{name}", h.DeleteConfigMap)
+	r.Delete("/namespaces/{namespace}/secrets/{name}", h.DeleteSecret)
+
+	// Autoscalers
+	r.Get("/namespaces/{namespace}/hpas", h.GetHPAs)
+
+	// Events
+	r.Get("/namespaces/{namespace}/events", h.GetEvents)
+	r.Get("/namespaces/{namespace}/{kind}/{name}/events", h.GetObjectEvents)
+
+	// Labels and annotations
+	r.Patch("/namespaces/{namespace}/{kind}/{name}/labels", h.PatchLabels)
+	r.Patch("/namespaces/{namespace}/{kind}/{name}/annotations", h.PatchAnnotations)
+
+	// Manifests
+	r.Post("/diff", h.DiffManifest)
+
+	// Nodes
+	r.Get("/nodes", h.GetNodes)
+	r.Get("/nodes/{name}", h.GetNode)
+	r.Get("/nodes/{name}/pods", h.GetNodePods)
+	r.Post("/nodes/{name}/cordon", h.CordonNode)
+	r.Post("/nodes/{name}/uncordon", h.UncordonNode)
+	r.Post("/nodes/{name}/drain", h.DrainNode)
+}
+
+// withoutWriteDeadline lifts the server's WriteTimeout for one response,
+// which would otherwise cut a stream off once it had run that long
+func withoutWriteDeadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) buildInfo() map[string]string {
+	return map[string]string{
+		"version":   s.cfg.Version,
+		"commit":    s.cfg.Commit,
+		"buildDate": s.cfg.BuildDate,
+	}
+}
+
 // Start starts the server
 func (s *Server) Start() error {
 	addr := fmt.Sprintf("%s:%d", s.cfg.Host, s.cfg.Port)
@@ -137,10 +284,19 @@ func (s *Server) Start() error {
 	fmt.Printf("📍 Context: %s\n", s.k8sClient.CurrentContext())
 	fmt.Printf("🌐 Dashboard: http://%s\n\n", addr)
 
+	if s.metrics != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopMetrics = cancel
+		go s.metrics.Run(ctx)
+	}
+
 	return s.server.ListenAndServe()
 }
 
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown(ctx context.Context) error {
+	if s.stopMetrics != nil {
+		s.stopMetrics()
+	}
 	return s.server.Shutdown(ctx)
 }
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/yourorg/kube-dashboard-lite/internal/k8s"
+)
+
+func TestLogBatchWindowDefault(t *testing.T) {
+	for _, tt := range []struct {
+		window, want time.Duration
+	}{
+		{0, defaultLogBatchWindow},
+		{250 * time.Millisecond, 250 * time.Millisecond},
+		{-1, -1},
+	} {
+		s := New(Config{LogBatchWindow: tt.window}, &k8s.Client{}, zerolog.Nop())
+		if s.cfg.LogBatchWindow != tt.want {
+			t.Errorf("LogBatchWindow %v: got %v, want %v", tt.window, s.cfg.LogBatchWindow, tt.want)
+		}
+	}
+}
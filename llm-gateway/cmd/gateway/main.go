@@ -46,10 +46,15 @@ func main() {
 	}
 
 	// Create and start server
-	srv, err := server.New(cfg, logger)
+	srv, err := server.New(cfg, server.BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+	}, logger)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Failed to create server")
 	}
+	srv.SetConfigPath(*configPath)
 
 	// Start server in goroutine
 	go func() {
@@ -9,10 +9,20 @@ import (
 // Cache interface for caching LLM responses
 type Cache interface {
 	Get(key string) ([]byte, bool)
-	Set(key string, value []byte)
-	Delete(key string)
+	// Set stores value under key, recording the model it was generated for
+	// so DeleteByModel can find it
+	Set(key, model string, value []byte)
+	// Delete removes an entry and reports whether it existed
+	Delete(key string) bool
+	// DeleteByModel removes every entry stored for model and returns how
+	// many were removed
+	DeleteByModel(model string) int
 	Clear()
 	Stats() CacheStats
+	// Peek returns an entry without serving it: it neither updates LRU
+	// position nor counts as a hit or miss, and may return expired entries
+	// that have not been purged yet
+	Peek(key string) (*Entry, bool)
 }
 
 type CacheStats struct {
@@ -21,6 +31,14 @@ type CacheStats struct {
 	Size   int
 }
 
+// Entry is a cached value with its metadata, as returned by Peek
+type Entry struct {
+	Value     []byte
+	Model     string
+	ExpiresAt time.Time
+	Size      int
+}
+
 // MemoryCache implements an in-memory LRU cache with TTL
 type MemoryCache struct {
 	maxSize  int
@@ -34,6 +52,7 @@ type MemoryCache struct {
 
 type cacheItem struct {
 	key       string
+	model     string
 	value     []byte
 	expiresAt time.Time
 	element   *list.Element
@@ -77,12 +96,13 @@ func (c *MemoryCache) Get(key string) ([]byte, bool) {
 	return item.value, true
 }
 
-func (c *MemoryCache) Set(key string, value []byte) {
+func (c *MemoryCache) Set(key, model string, value []byte) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	// Check if item already exists
 	if item, ok := c.items[key]; ok {
+		item.model = model
 		item.value = value
 		item.expiresAt = time.Now().Add(c.ttl)
 		c.lru.MoveToFront(item.element)
@@ -97,6 +117,7 @@ func (c *MemoryCache) Set(key string, value []byte) {
 	// Add new item
 	item := &cacheItem{
 		key:       key,
+		model:     model,
 		value:     value,
 		expiresAt: time.Now().Add(c.ttl),
 	}
@@ -104,13 +125,29 @@ func (c *MemoryCache) Set(key string, value []byte) {
 	c.items[key] = item
 }
 
-func (c *MemoryCache) Delete(key string) {
+func (c *MemoryCache) Delete(key string) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if item, ok := c.items[key]; ok {
+	item, ok := c.items[key]
+	if ok {
 		c.removeItem(item)
 	}
+	return ok
+}
+
+func (c *MemoryCache) DeleteByModel(model string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for _, item := range c.items {
+		if item.model == model {
+			c.removeItem(item)
+			removed++
+		}
+	}
+	return removed
 }
 
 func (c *MemoryCache) Clear() {
@@ -121,6 +158,23 @@ func (c *MemoryCache) Clear() {
 	c.lru = list.New()
 }
 
+func (c *MemoryCache) Peek(key string) (*Entry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	item, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	return &Entry{
+		Value:     item.value,
+		Model:     item.model,
+		ExpiresAt: item.expiresAt,
+		Size:      len(item.value),
+	}, true
+}
+
 func (c *MemoryCache) Stats() CacheStats {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -0,0 +1,254 @@
+package cache
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var diskBucket = []byte("responses")
+
+// diskModelBucket maps each key to the model its entry was stored for. It is
+// kept apart from the entries so files written before it existed still read.
+var diskModelBucket = []byte("models")
+
+// DiskCache implements a persistent cache backed by a bbolt file with TTL.
+// Entries survive restarts; expired ones are purged on open and lazily on read.
+type DiskCache struct {
+	db     *bolt.DB
+	ttl    time.Duration
+	hits   int64
+	misses int64
+}
+
+func NewDiskCache(path string, ttl time.Duration) (*DiskCache, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache file %s: %w", path, err)
+	}
+
+	c := &DiskCache{
+		db:  db,
+		ttl: ttl,
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(diskBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(diskModelBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize cache file: %w", err)
+	}
+
+	if err := c.purgeExpired(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to purge expired entries: %w", err)
+	}
+
+	return c, nil
+}
+
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	var value []byte
+	var expired bool
+
+	c.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(diskBucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+
+		expiresAt, payload := decodeDiskEntry(data)
+		if time.Now().After(expiresAt) {
+			expired = true
+			return nil
+		}
+
+		// Copy out, the slice is only valid inside the transaction
+		value = append([]byte(nil), payload...)
+		return nil
+	})
+
+	if expired {
+		c.deleteExpired([]byte(key))
+	}
+
+	if value == nil {
+		atomic.AddInt64(&c.misses, 1)
+		return nil, false
+	}
+
+	atomic.AddInt64(&c.hits, 1)
+	return value, true
+}
+
+func (c *DiskCache) Set(key, model string, value []byte) {
+	entry := encodeDiskEntry(time.Now().Add(c.ttl), value)
+
+	c.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(diskBucket).Put([]byte(key), entry); err != nil {
+			return err
+		}
+		return tx.Bucket(diskModelBucket).Put([]byte(key), []byte(model))
+	})
+}
+
+func (c *DiskCache) Delete(key string) bool {
+	var existed bool
+
+	c.db.Update(func(tx *bolt.Tx) error {
+		existed = tx.Bucket(diskBucket).Get([]byte(key)) != nil
+		return deleteDiskEntry(tx, []byte(key))
+	})
+
+	return existed
+}
+
+func (c *DiskCache) DeleteByModel(model string) int {
+	var removed int
+
+	c.db.Update(func(tx *bolt.Tx) error {
+		// Collect first, deleting while iterating a cursor can skip entries
+		var keys [][]byte
+		tx.Bucket(diskModelBucket).ForEach(func(k, v []byte) error {
+			if string(v) == model {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+
+		for _, k := range keys {
+			if err := deleteDiskEntry(tx, k); err != nil {
+				return err
+			}
+		}
+		removed = len(keys)
+		return nil
+	})
+
+	return removed
+}
+
+func (c *DiskCache) Clear() {
+	c.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{diskBucket, diskModelBucket} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *DiskCache) Peek(key string) (*Entry, bool) {
+	var entry *Entry
+
+	c.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(diskBucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+
+		expiresAt, payload := decodeDiskEntry(data)
+		entry = &Entry{
+			Value:     append([]byte(nil), payload...),
+			Model:     string(tx.Bucket(diskModelBucket).Get([]byte(key))),
+			ExpiresAt: expiresAt,
+			Size:      len(payload),
+		}
+		return nil
+	})
+
+	return entry, entry != nil
+}
+
+func (c *DiskCache) Stats() CacheStats {
+	var size int
+	c.db.View(func(tx *bolt.Tx) error {
+		size = tx.Bucket(diskBucket).Stats().KeyN
+		return nil
+	})
+
+	return CacheStats{
+		Hits:   atomic.LoadInt64(&c.hits),
+		Misses: atomic.LoadInt64(&c.misses),
+		Size:   size,
+	}
+}
+
+// Close releases the underlying cache file
+func (c *DiskCache) Close() error {
+	return c.db.Close()
+}
+
+func (c *DiskCache) purgeExpired() error {
+	now := time.Now()
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(diskBucket)
+
+		// Collect first, deleting while iterating a cursor can skip entries
+		var expired [][]byte
+		bucket.ForEach(func(k, v []byte) error {
+			if expiresAt, _ := decodeDiskEntry(v); now.After(expiresAt) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+
+		for _, k := range expired {
+			if err := deleteDiskEntry(tx, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// deleteExpired removes key if it is still expired. The entry is checked
+// again inside the write transaction, since a Set may have refreshed it
+// after the read that found it expired.
+func (c *DiskCache) deleteExpired(key []byte) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		data := tx.Bucket(diskBucket).Get(key)
+		if data == nil {
+			return nil
+		}
+		if expiresAt, _ := decodeDiskEntry(data); !time.Now().After(expiresAt) {
+			return nil
+		}
+		return deleteDiskEntry(tx, key)
+	})
+}
+
+func deleteDiskEntry(tx *bolt.Tx, key []byte) error {
+	if err := tx.Bucket(diskBucket).Delete(key); err != nil {
+		return err
+	}
+	return tx.Bucket(diskModelBucket).Delete(key)
+}
+
+// Entries are stored as an 8-byte expiry (unix nanoseconds) followed by the value
+func encodeDiskEntry(expiresAt time.Time, value []byte) []byte {
+	entry := make([]byte, 8+len(value))
+	binary.BigEndian.PutUint64(entry, uint64(expiresAt.UnixNano()))
+	copy(entry[8:], value)
+	return entry
+}
+
+func decodeDiskEntry(data []byte) (time.Time, []byte) {
+	if len(data) < 8 {
+		return time.Time{}, nil
+	}
+	expiresAt := time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+	return expiresAt, data[8:]
+}
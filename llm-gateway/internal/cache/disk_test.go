@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskCacheExpiredEntryRefreshedBeforeDelete(t *testing.T) {
+	c, err := NewDiskCache(filepath.Join(t.TempDir(), "cache.db"), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Write an entry that has already expired
+	c.ttl = -time.Second
+	c.Set("k", "m", []byte("old"))
+	if _, ok := c.Get("k"); ok {
+		t.Fatal("expired entry served")
+	}
+	if _, ok := c.Peek("k"); ok {
+		t.Error("expired entry kept after Get")
+	}
+
+	// A Get that read the entry as expired, then lost the race to a Set
+	// refreshing it, must leave the fresh entry alone
+	c.Set("k", "m", []byte("old"))
+	c.ttl = time.Hour
+	c.Set("k", "m", []byte("new"))
+	if err := c.deleteExpired([]byte("k")); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := c.Get("k"); !ok || string(value) != "new" {
+		t.Errorf("Get = %q, %v; want the refreshed entry", value, ok)
+	}
+}
@@ -0,0 +1,383 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+// Redis keys: entries live under redisKeyPrefix, and each model has a
+// sorted set of the entry keys stored for it, scored by expiry, so
+// DeleteByModel needn't scan
+const (
+	redisKeyPrefix   = "llm-gateway:cache:"
+	redisModelPrefix = "llm-gateway:cache-model:"
+	redisScanPattern = "llm-gateway:cache*"
+)
+
+// redisNoExpiry scores index members whose entries never expire
+const redisNoExpiry = 1 << 62
+
+// redisMaxIdleConns bounds the connections kept open between commands
+const redisMaxIdleConns = 16
+
+// errBreakerOpen is returned without touching Redis while the breaker is open
+var errBreakerOpen = errors.New("redis circuit breaker open")
+
+// RedisOptions tunes how the cache copes with a slow or failing Redis
+type RedisOptions struct {
+	// Timeout bounds each command, including dialing
+	Timeout time.Duration
+	// BreakerThreshold consecutive failures open the breaker, which then
+	// skips Redis for BreakerCooldown before letting one probe through
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// RedisBackendStats reports Redis failures for metrics
+type RedisBackendStats struct {
+	// Errors counts failed commands
+	Errors int64
+	// Skipped counts operations not sent because the breaker was open
+	Skipped     int64
+	BreakerOpen bool
+}
+
+// RedisCache implements a cache shared between gateway replicas, backed by
+// Redis. It fails open: a Redis error or timeout is a miss on read and a
+// no-op on write, so an outage slows nothing down beyond Timeout and never
+// fails a request. After BreakerThreshold consecutive failures Redis isn't
+// tried at all for BreakerCooldown.
+type RedisCache struct {
+	client  *redis.Client
+	ttl     time.Duration
+	timeout time.Duration
+	breaker *breaker
+	logger  zerolog.Logger
+
+	hits    int64
+	misses  int64
+	errors  int64
+	skipped int64
+}
+
+// NewRedisCache creates a cache for the Redis at url, a
+// redis://[[user]:password@]host[:port][/db] or rediss:// URL. It doesn't
+// connect up front, so the gateway starts even while Redis is down.
+func NewRedisCache(url string, ttl time.Duration, opts RedisOptions, logger zerolog.Logger) (*RedisCache, error) {
+	clientOpts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url: %w", err)
+	}
+	clientOpts.DialTimeout = opts.Timeout
+	clientOpts.ReadTimeout = opts.Timeout
+	clientOpts.WriteTimeout = opts.Timeout
+	clientOpts.ContextTimeoutEnabled = true
+	clientOpts.MaxIdleConns = redisMaxIdleConns
+	// Retrying would stretch an outage past Timeout; the breaker decides
+	// when to try again
+	clientOpts.MaxRetries = -1
+	clientOpts.DisableIndentity = true
+
+	return &RedisCache{
+		client:  redis.NewClient(clientOpts),
+		ttl:     ttl,
+		timeout: opts.Timeout,
+		breaker: newBreaker(opts.BreakerThreshold, opts.BreakerCooldown),
+		logger:  logger,
+	}, nil
+}
+
+func (c *RedisCache) Get(key string) ([]byte, bool) {
+	var data []byte
+	err := c.run(func(ctx context.Context) (err error) {
+		data, err = c.client.Get(ctx, redisKeyPrefix+key).Bytes()
+		return err
+	})
+	if err != nil {
+		atomic.AddInt64(&c.misses, 1)
+		return nil, false
+	}
+
+	_, value := decodeRedisEntry(data)
+	atomic.AddInt64(&c.hits, 1)
+	return value, true
+}
+
+// Set stores the entry and indexes it under its model. Index members whose
+// entries have expired are pruned on the way, and the index itself expires
+// with the newest entry, so it holds no more than what's cached.
+func (c *RedisCache) Set(key, model string, value []byte) {
+	entryKey := redisKeyPrefix + key
+	index := redisModelPrefix + model
+	now := time.Now()
+
+	c.run(func(ctx context.Context) error {
+		_, err := c.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Set(ctx, entryKey, encodeRedisEntry(model, value), c.ttl)
+			p.ZRemRangeByScore(ctx, index, "-inf", fmt.Sprint(now.UnixMilli()))
+			if c.ttl > 0 {
+				p.ZAdd(ctx, index, redis.Z{Score: float64(now.Add(c.ttl).UnixMilli()), Member: entryKey})
+				p.PExpire(ctx, index, c.ttl)
+			} else {
+				p.ZAdd(ctx, index, redis.Z{Score: redisNoExpiry, Member: entryKey})
+			}
+			return nil
+		})
+		return err
+	})
+}
+
+func (c *RedisCache) Delete(key string) bool {
+	var n int64
+	err := c.run(func(ctx context.Context) (err error) {
+		n, err = c.client.Del(ctx, redisKeyPrefix+key).Result()
+		return err
+	})
+	return err == nil && n > 0
+}
+
+func (c *RedisCache) DeleteByModel(model string) int {
+	index := redisModelPrefix + model
+	var keys []string
+	err := c.run(func(ctx context.Context) (err error) {
+		keys, err = c.client.ZRange(ctx, index, 0, -1).Result()
+		return err
+	})
+	if err != nil {
+		return 0
+	}
+
+	// Entries expire before the set prunes them, so DEL's count is what
+	// was actually still cached
+	var removed int64
+	err = c.run(func(ctx context.Context) error {
+		del := c.client.Del(ctx, append(keys, index)...)
+		removed = del.Val()
+		return del.Err()
+	})
+	if err != nil {
+		return 0
+	}
+	if len(keys) > 0 {
+		// The index itself was one of the keys deleted
+		removed--
+	}
+	return int(removed)
+}
+
+func (c *RedisCache) Clear() {
+	c.scan(func(keys []string) {
+		c.run(func(ctx context.Context) error {
+			return c.client.Del(ctx, keys...).Err()
+		})
+	})
+}
+
+func (c *RedisCache) Peek(key string) (*Entry, bool) {
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	err := c.run(func(ctx context.Context) error {
+		_, err := c.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+			get = p.Get(ctx, redisKeyPrefix+key)
+			pttl = p.PTTL(ctx, redisKeyPrefix+key)
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return nil, false
+	}
+	data, _ := get.Bytes()
+
+	model, value := decodeRedisEntry(data)
+	entry := &Entry{Value: value, Model: model, Size: len(value)}
+	if ttl := pttl.Val(); ttl > 0 {
+		entry.ExpiresAt = time.Now().Add(ttl)
+	}
+	return entry, true
+}
+
+// Stats counts the entries with a SCAN, so it costs a round trip per few
+// hundred keys
+func (c *RedisCache) Stats() CacheStats {
+	size := 0
+	c.scan(func(keys []string) {
+		for _, k := range keys {
+			if strings.HasPrefix(k, redisKeyPrefix) {
+				size++
+			}
+		}
+	})
+
+	return CacheStats{
+		Hits:   atomic.LoadInt64(&c.hits),
+		Misses: atomic.LoadInt64(&c.misses),
+		Size:   size,
+	}
+}
+
+// BackendStats reports Redis errors and the breaker state
+func (c *RedisCache) BackendStats() RedisBackendStats {
+	return RedisBackendStats{
+		Errors:      atomic.LoadInt64(&c.errors),
+		Skipped:     atomic.LoadInt64(&c.skipped),
+		BreakerOpen: c.breaker.isOpen(),
+	}
+}
+
+// Close closes the connection pool
+func (c *RedisCache) Close() error {
+	return c.client.Close()
+}
+
+// scan calls fn with each batch of the gateway's keys
+func (c *RedisCache) scan(fn func(keys []string)) {
+	var cursor uint64
+	for {
+		var keys []string
+		err := c.run(func(ctx context.Context) (err error) {
+			keys, cursor, err = c.client.Scan(ctx, cursor, redisScanPattern, 500).Result()
+			return err
+		})
+		if err != nil {
+			return
+		}
+		if len(keys) > 0 {
+			fn(keys)
+		}
+		if cursor == 0 {
+			return
+		}
+	}
+}
+
+// run sends fn's commands within Timeout, going through the breaker and
+// counting failures. A missing key comes back as redis.Nil, which isn't one.
+func (c *RedisCache) run(fn func(ctx context.Context) error) error {
+	if !c.breaker.allow() {
+		atomic.AddInt64(&c.skipped, 1)
+		return errBreakerOpen
+	}
+
+	ctx := context.Background()
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	err := fn(ctx)
+
+	// An error reply means the server answered, so Redis is up
+	var replyErr redis.Error
+	if err != nil && !errors.As(err, &replyErr) {
+		atomic.AddInt64(&c.errors, 1)
+		if c.breaker.failure() {
+			c.logger.Error().Err(err).Dur("cooldown", c.breaker.cooldown).Msg("Redis cache unavailable, serving without it")
+		} else {
+			c.logger.Warn().Err(err).Msg("Redis cache command failed, treating as a miss")
+		}
+		return err
+	}
+	if c.breaker.success() {
+		c.logger.Info().Msg("Redis cache reachable again")
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		atomic.AddInt64(&c.errors, 1)
+		c.logger.Warn().Err(err).Msg("Redis cache command rejected")
+	}
+	return err
+}
+
+// encodeRedisEntry prefixes the value with the model it was stored for
+func encodeRedisEntry(model string, value []byte) []byte {
+	entry := make([]byte, 2+len(model)+len(value))
+	binary.BigEndian.PutUint16(entry, uint16(len(model)))
+	copy(entry[2:], model)
+	copy(entry[2+len(model):], value)
+	return entry
+}
+
+func decodeRedisEntry(data []byte) (string, []byte) {
+	if len(data) < 2 {
+		return "", data
+	}
+	n := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+n {
+		return "", data
+	}
+	return string(data[2 : 2+n]), data[2+n:]
+}
+
+// breaker is a consecutive-failure circuit breaker. Once open it rejects
+// calls until cooldown has passed, then lets a single probe through: success
+// closes it, failure opens it for another cooldown.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a call may go ahead
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return true
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// failure records a failed call and reports whether it opened the breaker
+func (b *breaker) failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasOpen := b.threshold > 0 && b.failures >= b.threshold
+	b.failures++
+	b.probing = false
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+		return !wasOpen
+	}
+	return false
+}
+
+// success records a successful call and reports whether it closed the
+// breaker
+func (b *breaker) success() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasOpen := b.threshold > 0 && b.failures >= b.threshold
+	b.failures = 0
+	b.probing = false
+	return wasOpen
+}
+
+func (b *breaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.threshold > 0 && b.failures >= b.threshold
+}
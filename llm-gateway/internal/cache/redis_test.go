@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/rs/zerolog"
+)
+
+func testRedisOptions() RedisOptions {
+	return RedisOptions{Timeout: 200 * time.Millisecond, BreakerThreshold: 3, BreakerCooldown: time.Minute}
+}
+
+func TestRedisCacheRoundTrip(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c, err := NewRedisCache("redis://"+mr.Addr(), time.Hour, testRedisOptions(), zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, ok := c.Get("k"); ok {
+		t.Fatal("Get on an empty cache hit")
+	}
+
+	c.Set("k", "gpt-4", []byte(`{"id":"1"}`))
+	value, ok := c.Get("k")
+	if !ok || string(value) != `{"id":"1"}` {
+		t.Fatalf("Get = %q, %v", value, ok)
+	}
+
+	entry, ok := c.Peek("k")
+	if !ok || entry.Model != "gpt-4" || entry.ExpiresAt.IsZero() {
+		t.Fatalf("Peek = %+v, %v", entry, ok)
+	}
+
+	if n := c.DeleteByModel("gpt-4"); n != 1 {
+		t.Fatalf("DeleteByModel = %d, want 1", n)
+	}
+	if _, ok := c.Get("k"); ok {
+		t.Fatal("entry survived DeleteByModel")
+	}
+	if stats := c.BackendStats(); stats.Errors != 0 || stats.BreakerOpen {
+		t.Fatalf("BackendStats = %+v", stats)
+	}
+}
+
+func TestRedisCacheFailsOpen(t *testing.T) {
+	// A listener closed straight away leaves a port nothing answers on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	c, err := NewRedisCache("redis://"+addr, time.Hour, testRedisOptions(), zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, ok := c.Get("k"); ok {
+			t.Fatal("Get hit while Redis is down")
+		}
+		c.Set("k", "gpt-4", []byte("v"))
+	}
+
+	stats := c.BackendStats()
+	if !stats.BreakerOpen {
+		t.Fatal("breaker still closed after repeated failures")
+	}
+	if stats.Errors != 3 {
+		t.Errorf("Errors = %d, want 3 (the breaker threshold)", stats.Errors)
+	}
+	if stats.Skipped != 7 {
+		t.Errorf("Skipped = %d, want 7", stats.Skipped)
+	}
+	if cs := c.Stats(); cs.Misses != 5 {
+		t.Errorf("Misses = %d, want 5", cs.Misses)
+	}
+}
+
+func TestBreakerProbesAfterCooldown(t *testing.T) {
+	b := newBreaker(2, 10*time.Millisecond)
+	b.failure()
+	if !b.failure() {
+		t.Fatal("second failure didn't open the breaker")
+	}
+	if b.allow() {
+		t.Fatal("open breaker allowed a call")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("breaker didn't allow a probe after the cooldown")
+	}
+	if b.allow() {
+		t.Fatal("breaker allowed a second call while probing")
+	}
+	if !b.success() {
+		t.Fatal("successful probe didn't close the breaker")
+	}
+	if !b.allow() {
+		t.Fatal("closed breaker rejected a call")
+	}
+}
+
+func TestRedisCacheModelIndexExpires(t *testing.T) {
+	mr := miniredis.RunT(t)
+	c, err := NewRedisCache("redis://"+mr.Addr(), 50*time.Millisecond, testRedisOptions(), zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	index := redisModelPrefix + "gpt-4"
+	c.Set("old", "gpt-4", []byte("v"))
+	time.Sleep(60 * time.Millisecond)
+	c.Set("new", "gpt-4", []byte("v"))
+
+	members, err := mr.ZMembers(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 1 || members[0] != redisKeyPrefix+"new" {
+		t.Errorf("index members = %v, want only the live entry", members)
+	}
+	if ttl := mr.TTL(index); ttl <= 0 || ttl > 50*time.Millisecond {
+		t.Errorf("index TTL = %v, want the entry TTL", ttl)
+	}
+
+	mr.FastForward(time.Second)
+	if mr.Exists(index) {
+		t.Error("index outlived its entries")
+	}
+}
+
+func TestNewRedisCacheRejectsBadURL(t *testing.T) {
+	for _, url := range []string{"http://cache", "redis://cache/x"} {
+		if _, err := NewRedisCache(url, time.Hour, testRedisOptions(), zerolog.Nop()); err == nil {
+			t.Errorf("NewRedisCache(%q) succeeded", url)
+		}
+	}
+}
@@ -25,29 +25,211 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration `mapstructure:"readTimeout"`
 	WriteTimeout time.Duration `mapstructure:"writeTimeout"`
 	CORS         CORSConfig    `mapstructure:"cors"`
+	// StrictDecoding rejects request bodies containing unknown fields
+	StrictDecoding bool `mapstructure:"strictDecoding"`
+	// GRPCHealth serves the standard gRPC health service for Kubernetes
+	// gRPC probes, on its own port alongside the HTTP server
+	GRPCHealth GRPCHealthConfig `mapstructure:"grpcHealth"`
+	// WarmupProviders opens a connection to each provider at startup so the
+	// first requests don't pay for the TLS handshake
+	WarmupProviders bool `mapstructure:"warmupProviders"`
+	// AdminKeys are the bearer tokens accepted by admin endpoints such as
+	// /api/v1/config, which is disabled while this is empty
+	AdminKeys []string `mapstructure:"adminKeys" redact:"true"`
+	// MaxStreamDuration bounds how long a streaming completion is relayed
+	// before it is ended with an error event; zero is unlimited
+	MaxStreamDuration time.Duration `mapstructure:"maxStreamDuration"`
+	// StreamHeartbeat sends an SSE comment on a stream idle this long, so
+	// proxies that drop idle connections don't cut off a slow upstream;
+	// zero sends none. Requests can override it with
+	// x-gateway.heartbeat_interval.
+	StreamHeartbeat time.Duration `mapstructure:"streamHeartbeat"`
+	// Batch bounds /v1/chat/completions/batch
+	Batch BatchConfig `mapstructure:"batch"`
+}
+
+// BatchConfig bounds batch completion requests. MaxRequests caps the
+// requests in one batch (zero is unlimited) and Concurrency is how many of
+// them run at once.
+type BatchConfig struct {
+	MaxRequests int `mapstructure:"maxRequests"`
+	Concurrency int `mapstructure:"concurrency"`
+}
+
+type GRPCHealthConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	Port    int  `mapstructure:"port"`
 }
 
 type CORSConfig struct {
-	Enabled        bool     `mapstructure:"enabled"`
-	AllowedOrigins []string `mapstructure:"allowedOrigins"`
-	AllowedMethods []string `mapstructure:"allowedMethods"`
-	AllowedHeaders []string `mapstructure:"allowedHeaders"`
+	Enabled          bool     `mapstructure:"enabled"`
+	AllowedOrigins   []string `mapstructure:"allowedOrigins"`
+	AllowedMethods   []string `mapstructure:"allowedMethods"`
+	AllowedHeaders   []string `mapstructure:"allowedHeaders"`
+	AllowCredentials bool     `mapstructure:"allowCredentials"`
+
+	// Public and Admin replace the policy above for the OpenAI-compatible
+	// /v1 routes and the /api/v1 gateway routes respectively. Unset, they
+	// use the policy above.
+	Public *CORSPolicy `mapstructure:"public"`
+	Admin  *CORSPolicy `mapstructure:"admin"`
+}
+
+// CORSPolicy is the CORS policy for one group of routes. A disabled policy
+// sends no CORS headers, so browsers on other origins can't call them.
+type CORSPolicy struct {
+	Enabled          bool     `mapstructure:"enabled"`
+	AllowedOrigins   []string `mapstructure:"allowedOrigins"`
+	AllowedMethods   []string `mapstructure:"allowedMethods"`
+	AllowedHeaders   []string `mapstructure:"allowedHeaders"`
+	AllowCredentials bool     `mapstructure:"allowCredentials"`
+}
+
+// DefaultPolicy is the top-level policy, for routes without their own
+func (c CORSConfig) DefaultPolicy() CORSPolicy {
+	return CORSPolicy{
+		Enabled:          c.Enabled,
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   c.AllowedMethods,
+		AllowedHeaders:   c.AllowedHeaders,
+		AllowCredentials: c.AllowCredentials,
+	}
+}
+
+// PublicPolicy is the policy for the /v1 routes
+func (c CORSConfig) PublicPolicy() CORSPolicy {
+	if c.Public != nil {
+		return *c.Public
+	}
+	return c.DefaultPolicy()
+}
+
+// AdminPolicy is the policy for the /api/v1 routes
+func (c CORSConfig) AdminPolicy() CORSPolicy {
+	if c.Admin != nil {
+		return *c.Admin
+	}
+	return c.DefaultPolicy()
 }
 
 type ProviderConfig struct {
 	Name       string        `mapstructure:"name"`
-	APIKey     string        `mapstructure:"apiKey"`
+	APIKey     string        `mapstructure:"apiKey" redact:"true"`
 	BaseURL    string        `mapstructure:"baseUrl"`
+	// ChatPath overrides the chat endpoint path appended to BaseURL. It may
+	// contain {model}, replaced per request, for backends such as Azure that
+	// put the deployment in the path.
+	ChatPath string `mapstructure:"chatPath"`
 	Models     []string      `mapstructure:"models"`
 	Priority   int           `mapstructure:"priority"`
+	// Timeout bounds the wait for the provider's response headers. It does
+	// not cap how long a streaming response may run; that is governed by the
+	// request context (client disconnect or server.writeTimeout).
 	Timeout    time.Duration `mapstructure:"timeout"`
 	MaxRetries int           `mapstructure:"maxRetries"`
+	// DisableStreaming serves stream requests by making a regular call and
+	// re-emitting the result as SSE, for backends without stream support
+	DisableStreaming bool `mapstructure:"disableStreaming"`
+	// DisableHTTP2 forces HTTP/1.1 to the upstream. HTTP/2 is negotiated by
+	// default, multiplexing requests over fewer connections.
+	DisableHTTP2 bool `mapstructure:"disableHTTP2"`
+	// CostModel selects how request cost is computed: "token" (default) uses
+	// the per-model token pricing, "free" records zero, and "request" charges
+	// CostPerRequest regardless of tokens, for self-hosted backends
+	CostModel      string  `mapstructure:"costModel"`
+	CostPerRequest float64 `mapstructure:"costPerRequest"`
+	// ModelLimits overrides per-model output token defaults and caps
+	ModelLimits map[string]ModelLimit `mapstructure:"modelLimits"`
+	// PromptCaching marks prompts for Anthropic's server-side prompt cache
+	PromptCaching PromptCachingConfig `mapstructure:"promptCaching"`
+	// UnsupportedParams lists optional request params (e.g. logprobs) the
+	// provider can't accept, replacing the built-in list for known providers.
+	// UnsupportedParamsAction is "strip" (default) to drop them or "reject"
+	// to answer 400.
+	UnsupportedParams       []string `mapstructure:"unsupportedParams"`
+	UnsupportedParamsAction string   `mapstructure:"unsupportedParamsAction"`
+	// RequestIDHeader forwards the gateway's request id to the provider in
+	// this header (e.g. X-Request-ID) for end-to-end tracing; empty doesn't
+	RequestIDHeader string `mapstructure:"requestIdHeader"`
+	// Organization and Project are sent to OpenAI as OpenAI-Organization
+	// and OpenAI-Project for billing separation; empty omits the header
+	Organization string `mapstructure:"organization"`
+	Project      string `mapstructure:"project"`
+	// AllowedOrganizations and AllowedProjects list the values a request
+	// may pick with the openai_organization and openai_project metadata;
+	// a value not listed is rejected
+	AllowedOrganizations []string `mapstructure:"allowedOrganizations"`
+	AllowedProjects      []string `mapstructure:"allowedProjects"`
+	// OwnedBy is the owned_by reported for this provider's models in
+	// /v1/models, for clients that expect e.g. "openai"; defaults to Name
+	OwnedBy string `mapstructure:"ownedBy"`
+}
+
+// PromptCachingConfig controls Anthropic prompt caching (cache_control)
+type PromptCachingConfig struct {
+	// Enabled marks the system prompt as cacheable. Requests can override
+	// it with x-gateway.prompt_cache.
+	Enabled bool `mapstructure:"enabled"`
+	// MinMessageChars also marks user messages at least this long; zero
+	// marks the system prompt only
+	MinMessageChars int `mapstructure:"minMessageChars"`
+}
+
+// ModelLimit bounds max_tokens for one model. DefaultMaxTokens applies when
+// the client doesn't set max_tokens; MaxOutputTokens caps whatever is sent.
+// MaxCompletionTokens marks models that take max_completion_tokens instead
+// of max_tokens, beyond the built-in o1/o3 families.
+type ModelLimit struct {
+	DefaultMaxTokens    int  `mapstructure:"defaultMaxTokens"`
+	MaxOutputTokens     int  `mapstructure:"maxOutputTokens"`
+	MaxCompletionTokens bool `mapstructure:"maxCompletionTokens"`
 }
 
 type RoutingConfig struct {
 	DefaultProvider string                  `mapstructure:"defaultProvider"`
 	ModelMappings   map[string]ModelMapping `mapstructure:"modelMappings"`
 	FallbackChain   []string                `mapstructure:"fallbackChain"`
+	// FallbackOn lists the errors that move a request to the next provider
+	// in FallbackChain: status codes ("429"), classes ("5xx") and
+	// "connection". Other errors are returned to the client at once.
+	FallbackOn []string `mapstructure:"fallbackOn"`
+	// JSONValidation checks that non-streaming JSON-mode responses parse
+	JSONValidation JSONValidationConfig `mapstructure:"jsonValidation"`
+	// SystemPrefixes maps a requested model to a system prompt the gateway
+	// prepends to every request for it, ahead of any client system message
+	SystemPrefixes map[string]string `mapstructure:"systemPrefixes"`
+	// ReasoningTransforms maps a requested model to what the gateway does
+	// with reasoning in its responses: "strip" removes it, "separate" moves
+	// <think> blocks out of the content into reasoning_content
+	ReasoningTransforms map[string]string `mapstructure:"reasoningTransforms"`
+	// AllowedModels, when non-empty, is the only set of models clients may
+	// request; DeniedModels are always rejected. Both match case-insensitively.
+	AllowedModels []string `mapstructure:"allowedModels"`
+	DeniedModels  []string `mapstructure:"deniedModels"`
+	// HealthCheckConcurrency caps how many providers are health checked or
+	// warmed up at once; zero checks them all in parallel
+	HealthCheckConcurrency int `mapstructure:"healthCheckConcurrency"`
+	// RetryBudget limits provider retries across the gateway so an upstream
+	// outage isn't multiplied by every request retrying
+	RetryBudget RetryBudgetConfig `mapstructure:"retryBudget"`
+}
+
+// RetryBudgetConfig is a token bucket for retries: each request earns Ratio
+// retries, up to MaxTokens banked, and each retry spends one. Once it is
+// empty, failed attempts return at once instead of retrying.
+type RetryBudgetConfig struct {
+	Enabled   bool    `mapstructure:"enabled"`
+	Ratio     float64 `mapstructure:"ratio"`
+	MaxTokens int     `mapstructure:"maxTokens"`
+}
+
+// JSONValidationConfig retries JSON-mode responses whose content isn't valid
+// JSON, such as output cut off at max_tokens
+type JSONValidationConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MaxRetries is how many more times an invalid response is requested
+	// before it is returned as-is; zero only records the soft failure
+	MaxRetries int `mapstructure:"maxRetries"`
 }
 
 type ModelMapping struct {
@@ -57,10 +239,26 @@ type ModelMapping struct {
 
 type CacheConfig struct {
 	Enabled  bool          `mapstructure:"enabled"`
-	Backend  string        `mapstructure:"backend"` // "memory" or "redis"
+	Backend  string        `mapstructure:"backend"` // "memory", "disk" or "redis"
 	TTL      time.Duration `mapstructure:"ttl"`
 	MaxSize  int           `mapstructure:"maxSize"` // MB for memory
-	RedisURL string        `mapstructure:"redisUrl"`
+	Path     string        `mapstructure:"path"`    // file for disk
+	RedisURL string        `mapstructure:"redisUrl" redact:"true"`
+
+	// Redis fails open: a command that errors or takes longer than
+	// RedisTimeout is a miss. RedisBreakerThreshold consecutive failures
+	// stop the gateway trying Redis for RedisBreakerCooldown.
+	RedisTimeout          time.Duration `mapstructure:"redisTimeout"`
+	RedisBreakerThreshold int           `mapstructure:"redisBreakerThreshold"`
+	RedisBreakerCooldown  time.Duration `mapstructure:"redisBreakerCooldown"`
+
+	// Coalesce shares one upstream call between concurrent identical
+	// non-streaming requests
+	Coalesce bool `mapstructure:"coalesce"`
+
+	// PerKeyIsolation partitions the cache by API key so clients never
+	// receive responses cached for another key
+	PerKeyIsolation bool `mapstructure:"perKeyIsolation"`
 }
 
 type RateLimitConfig struct {
@@ -69,6 +267,8 @@ type RateLimitConfig struct {
 	PerKey  RateLimit         `mapstructure:"perKey"`
 	PerModel map[string]RateLimit `mapstructure:"perModel"`
 	Queuing QueuingConfig     `mapstructure:"queuing"`
+	// IdleTTL evicts per-key limiters that haven't been used for this long
+	IdleTTL time.Duration `mapstructure:"idleTTL"`
 }
 
 type RateLimit struct {
@@ -77,10 +277,15 @@ type RateLimit struct {
 	Tokens   int           `mapstructure:"tokens"`
 }
 
+// QueuingConfig makes requests over the global rate limit wait for capacity
+// instead of being rejected
 type QueuingConfig struct {
 	Enabled      bool          `mapstructure:"enabled"`
 	MaxQueueSize int           `mapstructure:"maxQueueSize"`
 	MaxWaitTime  time.Duration `mapstructure:"maxWaitTime"`
+	// Fair serves waiting API keys in turn rather than in arrival order, so
+	// one busy key can't starve the others
+	Fair bool `mapstructure:"fair"`
 }
 
 type MetricsConfig struct {
@@ -88,6 +293,18 @@ type MetricsConfig struct {
 	Endpoint  string `mapstructure:"endpoint"`
 	Backend   string `mapstructure:"backend"` // "memory" or "postgres"
 	Retention string `mapstructure:"retention"`
+	// EstimateStreamTokens approximates usage for streams whose upstream
+	// reports none, so they aren't recorded as zero tokens
+	EstimateStreamTokens bool `mapstructure:"estimateStreamTokens"`
+	// UpstreamTiming traces DNS, connect, TLS and time to first byte of
+	// provider requests. Off by default to skip the tracing overhead.
+	UpstreamTiming bool `mapstructure:"upstreamTiming"`
+	// MaxUsers caps the users listed in per-user usage; the rest are
+	// summed under "(other)"
+	MaxUsers int `mapstructure:"maxUsers"`
+	// HashUsers records a hash of the request's user field instead of the
+	// raw id
+	HashUsers bool `mapstructure:"hashUsers"`
 }
 
 type LoggingConfig struct {
@@ -140,22 +357,56 @@ func Load(configPath string) (*Config, error) {
 	return &cfg, nil
 }
 
+// LoadProviders re-reads only the providers section, with the same file
+// lookup, env overrides and API key expansion as Load
+func LoadProviders(configPath string) ([]ProviderConfig, error) {
+	cfg, err := Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Providers, nil
+}
+
 func setDefaults(v *viper.Viper) {
 	// Server defaults
 	v.SetDefault("server.port", 8080)
 	v.SetDefault("server.host", "0.0.0.0")
 	v.SetDefault("server.readTimeout", "30s")
 	v.SetDefault("server.writeTimeout", "120s")
+	v.SetDefault("server.strictDecoding", false)
+	v.SetDefault("server.grpcHealth.enabled", false)
+	v.SetDefault("server.grpcHealth.port", 9090)
+	v.SetDefault("server.warmupProviders", false)
+	v.SetDefault("server.maxStreamDuration", "0s")
+	v.SetDefault("server.streamHeartbeat", "0s")
+	v.SetDefault("server.batch.maxRequests", 100)
+	v.SetDefault("server.batch.concurrency", 8)
 	v.SetDefault("server.cors.enabled", true)
 	v.SetDefault("server.cors.allowedOrigins", []string{"*"})
 	v.SetDefault("server.cors.allowedMethods", []string{"GET", "POST", "OPTIONS"})
 	v.SetDefault("server.cors.allowedHeaders", []string{"*"})
+	v.SetDefault("server.cors.allowCredentials", true)
+
+	// Routing defaults
+	v.SetDefault("routing.healthCheckConcurrency", 0)
+	v.SetDefault("routing.fallbackOn", []string{"429", "5xx", "connection"})
+	v.SetDefault("routing.jsonValidation.enabled", false)
+	v.SetDefault("routing.jsonValidation.maxRetries", 1)
+	v.SetDefault("routing.retryBudget.enabled", false)
+	v.SetDefault("routing.retryBudget.ratio", 0.1)
+	v.SetDefault("routing.retryBudget.maxTokens", 100)
 
 	// Cache defaults
 	v.SetDefault("cache.enabled", true)
 	v.SetDefault("cache.backend", "memory")
 	v.SetDefault("cache.ttl", "1h")
 	v.SetDefault("cache.maxSize", 512)
+	v.SetDefault("cache.path", "llm-gateway-cache.db")
+	v.SetDefault("cache.redisTimeout", "250ms")
+	v.SetDefault("cache.redisBreakerThreshold", 5)
+	v.SetDefault("cache.redisBreakerCooldown", "30s")
+	v.SetDefault("cache.coalesce", false)
+	v.SetDefault("cache.perKeyIsolation", false)
 
 	// Rate limit defaults
 	v.SetDefault("rateLimit.enabled", false)
@@ -163,11 +414,21 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("rateLimit.global.window", "1m")
 	v.SetDefault("rateLimit.perKey.requests", 1000)
 	v.SetDefault("rateLimit.perKey.window", "1m")
+	v.SetDefault("rateLimit.idleTTL", "10m")
+	v.SetDefault("rateLimit.queuing.enabled", false)
+	v.SetDefault("rateLimit.queuing.maxQueueSize", 1000)
+	v.SetDefault("rateLimit.queuing.maxWaitTime", "30s")
+	v.SetDefault("rateLimit.queuing.fair", false)
 
 	// Metrics defaults
 	v.SetDefault("metrics.enabled", true)
 	v.SetDefault("metrics.endpoint", "/metrics")
 	v.SetDefault("metrics.backend", "memory")
+	v.SetDefault("metrics.retention", "1h")
+	v.SetDefault("metrics.estimateStreamTokens", false)
+	v.SetDefault("metrics.upstreamTiming", false)
+	v.SetDefault("metrics.maxUsers", 1000)
+	v.SetDefault("metrics.hashUsers", false)
 
 	// Logging defaults
 	v.SetDefault("logging.level", "info")
@@ -190,11 +451,28 @@ func DefaultConfig() *Config {
 			Host:         "0.0.0.0",
 			ReadTimeout:  30 * time.Second,
 			WriteTimeout: 120 * time.Second,
+			GRPCHealth: GRPCHealthConfig{
+				Port: 9090,
+			},
+			Batch: BatchConfig{
+				MaxRequests: 100,
+				Concurrency: 8,
+			},
 			CORS: CORSConfig{
-				Enabled:        true,
-				AllowedOrigins: []string{"*"},
-				AllowedMethods: []string{"GET", "POST", "OPTIONS"},
-				AllowedHeaders: []string{"*"},
+				Enabled:          true,
+				AllowedOrigins:   []string{"*"},
+				AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
+				AllowedHeaders:   []string{"*"},
+				AllowCredentials: true,
+			},
+		},
+		Routing: RoutingConfig{
+			JSONValidation: JSONValidationConfig{
+				MaxRetries: 1,
+			},
+			RetryBudget: RetryBudgetConfig{
+				Ratio:     0.1,
+				MaxTokens: 100,
 			},
 		},
 		Cache: CacheConfig{
@@ -202,14 +480,25 @@ func DefaultConfig() *Config {
 			Backend: "memory",
 			TTL:     time.Hour,
 			MaxSize: 512,
+
+			RedisTimeout:          250 * time.Millisecond,
+			RedisBreakerThreshold: 5,
+			RedisBreakerCooldown:  30 * time.Second,
 		},
 		RateLimit: RateLimitConfig{
 			Enabled: false,
+			IdleTTL: 10 * time.Minute,
+			Queuing: QueuingConfig{
+				MaxQueueSize: 1000,
+				MaxWaitTime:  30 * time.Second,
+			},
 		},
 		Metrics: MetricsConfig{
 			Enabled:  true,
-			Endpoint: "/metrics",
-			Backend:  "memory",
+			Endpoint:  "/metrics",
+			Backend:   "memory",
+			Retention: "1h",
+			MaxUsers:  1000,
 		},
 		Logging: LoggingConfig{
 			Level:  "info",
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Redacted returns the loaded config keyed as in the config file, with
+// fields tagged `redact:"true"` masked to their last four characters.
+// Durations are rendered as strings ("30s") rather than nanoseconds.
+func (c *Config) Redacted() map[string]interface{} {
+	return redactValue(reflect.ValueOf(*c), false).(map[string]interface{})
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func redactValue(v reflect.Value, secret bool) interface{} {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		out := make(map[string]interface{}, v.NumField())
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+			if name == "" {
+				name = field.Name
+			}
+			out[name] = redactValue(v.Field(i), field.Tag.Get("redact") == "true")
+		}
+		return out
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = redactValue(v.Index(i), secret)
+		}
+		return out
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[fmt.Sprint(iter.Key().Interface())] = redactValue(iter.Value(), secret)
+		}
+		return out
+
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem(), secret)
+
+	case reflect.String:
+		if secret {
+			return maskSecret(v.String())
+		}
+		return v.String()
+	}
+
+	return v.Interface()
+}
+
+// maskSecret keeps the last four characters of a secret so operators can
+// tell which key was loaded. Short secrets are masked entirely; an empty
+// one stays empty, which is how an unset env var shows up.
+func maskSecret(s string) string {
+	switch {
+	case s == "":
+		return ""
+	case len(s) <= 8:
+		return "****"
+	default:
+		return "****" + s[len(s)-4:]
+	}
+}
@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Family is one exported metric with its samples, the shape shared by the
+// Prometheus text output and the JSON export
+type Family struct {
+	Name    string   `json:"name"`
+	Help    string   `json:"help"`
+	Type    string   `json:"type"`
+	Samples []Sample `json:"samples"`
+
+	// precision is the number of decimals in the Prometheus text output
+	precision int
+}
+
+// Sample is a single value of a metric family
+type Sample struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// Families snapshots the collector as exported metric families
+func (c *Collector) Families() []Family {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	providers := sortedKeys(c.byProvider)
+	models := sortedKeys(c.byModel)
+
+	perProvider := func(value func(*ProviderStats) float64) []Sample {
+		samples := make([]Sample, 0, len(providers))
+		for _, name := range providers {
+			samples = append(samples, Sample{Labels: map[string]string{"provider": name}, Value: value(c.byProvider[name])})
+		}
+		return samples
+	}
+	perModel := func(value func(*ModelStats) float64) []Sample {
+		samples := make([]Sample, 0, len(models))
+		for _, name := range models {
+			samples = append(samples, Sample{Labels: map[string]string{"model": name}, Value: value(c.byModel[name])})
+		}
+		return samples
+	}
+
+	inFlightProviders := sortedKeys(c.inFlightByProvider)
+	inFlight := make([]Sample, 0, len(inFlightProviders))
+	for _, name := range inFlightProviders {
+		inFlight = append(inFlight, Sample{Labels: map[string]string{"provider": name}, Value: float64(c.inFlightByProvider[name])})
+	}
+
+	families := []Family{
+		{Name: "llm_gateway_requests_total", Help: "Total number of requests", Type: "counter",
+			Samples: []Sample{{Value: float64(len(c.requests))}}},
+		{Name: "llm_gateway_requests_in_flight", Help: "Number of requests currently being served", Type: "gauge",
+			Samples: []Sample{{Value: float64(c.inFlight)}}},
+		{Name: "llm_gateway_provider_requests_in_flight", Help: "Requests currently in flight per provider", Type: "gauge",
+			Samples: inFlight},
+		{Name: "llm_gateway_tokens_total", Help: "Total number of tokens processed", Type: "counter",
+			Samples: []Sample{{Value: float64(c.totalTokens)}}},
+		{Name: "llm_gateway_cost_total", Help: "Total cost in USD", Type: "counter", precision: 6,
+			Samples: []Sample{{Value: c.totalCost}}},
+		{Name: "llm_gateway_cache_hits_total", Help: "Total cache hits", Type: "counter",
+			Samples: []Sample{{Value: float64(c.cacheHits)}}},
+		{Name: "llm_gateway_cache_misses_total", Help: "Total cache misses", Type: "counter",
+			Samples: []Sample{{Value: float64(c.cacheMisses)}}},
+		{Name: "llm_gateway_provider_requests_total", Help: "Requests per provider", Type: "counter",
+			Samples: perProvider(func(s *ProviderStats) float64 { return float64(s.Requests) })},
+		{Name: "llm_gateway_provider_errors_total", Help: "Failed requests per provider", Type: "counter",
+			Samples: perProvider(func(s *ProviderStats) float64 { return float64(s.Errors) })},
+		{Name: "llm_gateway_provider_invalid_json_total", Help: "JSON-mode responses per provider whose content didn't parse", Type: "counter",
+			Samples: perProvider(func(s *ProviderStats) float64 { return float64(s.InvalidJSON) })},
+		{Name: "llm_gateway_provider_latency_avg_ms", Help: "Average latency per provider", Type: "gauge", precision: 2,
+			Samples: perProvider(func(s *ProviderStats) float64 { return s.AvgLatencyMs })},
+		{Name: "llm_gateway_model_requests_total", Help: "Requests per model", Type: "counter",
+			Samples: perModel(func(s *ModelStats) float64 { return float64(s.Requests) })},
+		{Name: "llm_gateway_model_prompt_cache_write_tokens_total", Help: "Prompt tokens written to the provider's prompt cache per model", Type: "counter",
+			Samples: perModel(func(s *ModelStats) float64 { return float64(s.CacheWriteTokens) })},
+		{Name: "llm_gateway_model_prompt_cache_read_tokens_total", Help: "Prompt tokens read from the provider's prompt cache per model", Type: "counter",
+			Samples: perModel(func(s *ModelStats) float64 { return float64(s.CacheReadTokens) })},
+		{Name: "llm_gateway_model_stripped_reasoning_tokens_total", Help: "Estimated reasoning tokens removed from responses per model", Type: "counter",
+			Samples: perModel(func(s *ModelStats) float64 { return float64(s.StrippedReasoningTokens) })},
+		{Name: "llm_gateway_model_cost_total", Help: "Cost per model", Type: "counter", precision: 6,
+			Samples: perModel(func(s *ModelStats) float64 { return s.Cost })},
+	}
+
+	if c.retryBudget != nil {
+		budget := c.retryBudget.Stats()
+		families = append(families,
+			Family{Name: "llm_gateway_retry_budget_tokens", Help: "Retries the retry budget can currently pay for", Type: "gauge", precision: 2,
+				Samples: []Sample{{Value: budget.Tokens}}},
+			Family{Name: "llm_gateway_retry_budget_max_tokens", Help: "Most retries the retry budget can bank", Type: "gauge",
+				Samples: []Sample{{Value: budget.MaxTokens}}},
+			Family{Name: "llm_gateway_retries_total", Help: "Provider retries allowed by the retry budget", Type: "counter",
+				Samples: []Sample{{Value: float64(budget.Retries)}}},
+			Family{Name: "llm_gateway_retries_denied_total", Help: "Provider retries skipped because the retry budget was empty", Type: "counter",
+				Samples: []Sample{{Value: float64(budget.Denied)}}},
+		)
+	}
+	if c.redisCache != nil {
+		redis := c.redisCache.BackendStats()
+		breakerOpen := 0.0
+		if redis.BreakerOpen {
+			breakerOpen = 1
+		}
+		families = append(families,
+			Family{Name: "llm_gateway_redis_errors_total", Help: "Redis cache commands that failed or timed out", Type: "counter",
+				Samples: []Sample{{Value: float64(redis.Errors)}}},
+			Family{Name: "llm_gateway_redis_skipped_total", Help: "Redis cache operations skipped while the circuit breaker was open", Type: "counter",
+				Samples: []Sample{{Value: float64(redis.Skipped)}}},
+			Family{Name: "llm_gateway_redis_breaker_open", Help: "Whether the Redis cache circuit breaker is open (1) or closed (0)", Type: "gauge",
+				Samples: []Sample{{Value: breakerOpen}}},
+		)
+	}
+	return families
+}
+
+// Prometheus renders the metric families in the Prometheus text format
+func (c *Collector) Prometheus() string {
+	var b strings.Builder
+	for _, f := range c.Families() {
+		b.WriteString("# HELP " + f.Name + " " + f.Help + "\n")
+		b.WriteString("# TYPE " + f.Name + " " + f.Type + "\n")
+		for _, s := range f.Samples {
+			b.WriteString(f.Name)
+			if len(s.Labels) > 0 {
+				b.WriteString("{" + formatLabels(s.Labels) + "}")
+			}
+			b.WriteString(" " + strconv.FormatFloat(s.Value, 'f', f.precision, 64) + "\n")
+		}
+	}
+	return b.String()
+}
+
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for _, name := range sortedKeys(labels) {
+		pairs = append(pairs, name+"="+strconv.Quote(labels[name]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
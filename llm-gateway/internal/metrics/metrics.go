@@ -1,16 +1,18 @@
 package metrics
 
 import (
-	"fmt"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/yourorg/llm-gateway/internal/cache"
 	"github.com/yourorg/llm-gateway/internal/provider"
 )
 
 // Collector collects and aggregates metrics
 type Collector struct {
 	mu           sync.RWMutex
+	retention    time.Duration
 	requests     []provider.ProviderMetrics
 	totalCost    float64
 	totalTokens  int64
@@ -18,22 +20,81 @@ type Collector struct {
 	cacheMisses  int64
 	byProvider   map[string]*ProviderStats
 	byModel      map[string]*ModelStats
+
+	// Live gauges, independent of the retained request history
+	inFlight           int64
+	inFlightByProvider map[string]int64
+
+	// retryBudget is reported when routing.retryBudget is enabled
+	retryBudget *provider.RetryBudget
+
+	// redisCache is reported when the cache backend is redis
+	redisCache *cache.RedisCache
 }
 
 type ProviderStats struct {
-	Requests     int64
-	Tokens       int64
-	Cost         float64
-	AvgLatencyMs float64
-	Errors       int64
+	Requests     int64   `json:"requests"`
+	Tokens       int64   `json:"tokens"`
+	Cost         float64 `json:"cost"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	Errors       int64   `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"`
+	// InvalidJSON counts JSON-mode responses whose content didn't parse
+	InvalidJSON int64 `json:"invalid_json"`
 }
 
 type ModelStats struct {
-	Requests     int64
-	PromptTokens int64
-	CompletionTokens int64
-	Cost         float64
-	AvgLatencyMs float64
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CacheWriteTokens int64   `json:"cache_write_tokens"`
+	CacheReadTokens  int64   `json:"cache_read_tokens"`
+	Cost             float64 `json:"cost"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+	// EstimatedRequests counts requests whose tokens were estimated
+	EstimatedRequests int64 `json:"estimated_requests"`
+	// StrippedReasoningTokens estimates the reasoning tokens removed from
+	// responses; they are included in CompletionTokens and Cost
+	StrippedReasoningTokens int64 `json:"stripped_reasoning_tokens"`
+}
+
+// MetadataStats aggregates usage for one value of a request metadata key
+type MetadataStats struct {
+	Requests int64   `json:"requests"`
+	Tokens   int64   `json:"tokens"`
+	Cost     float64 `json:"cost"`
+}
+
+// ErrorStats counts successful and failed requests for one provider
+type ErrorStats struct {
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// TimingStats averages the upstream connection breakdown for one provider.
+// DNS, connect and TLS are averaged over requests that opened a new
+// connection; first byte over all traced requests.
+type TimingStats struct {
+	Requests       int64   `json:"requests"`
+	NewConnections int64   `json:"new_connections"`
+	AvgDNSMs       float64 `json:"avg_dns_ms"`
+	AvgConnectMs   float64 `json:"avg_connect_ms"`
+	AvgTLSMs       float64 `json:"avg_tls_ms"`
+	AvgFirstByteMs float64 `json:"avg_first_byte_ms"`
+}
+
+// DetailedStats breaks usage down by provider, model and optionally metadata.
+// Provider and model stats are cumulative; error, timing and metadata stats
+// cover the retention window since they are computed from the retained
+// request history.
+type DetailedStats struct {
+	ByProvider     map[string]ProviderStats `json:"by_provider"`
+	ByModel        map[string]ModelStats    `json:"by_model"`
+	ProviderErrors map[string]ErrorStats    `json:"provider_errors"`
+	ProviderTiming map[string]TimingStats   `json:"provider_timing,omitempty"`
+	ByMetadata     map[string]MetadataStats `json:"by_metadata,omitempty"`
+	ByUser         map[string]MetadataStats `json:"by_user,omitempty"`
 }
 
 type AggregatedStats struct {
@@ -46,12 +107,24 @@ type AggregatedStats struct {
 	ByModel       map[string]*ModelStats
 }
 
-func NewCollector() *Collector {
-	return &Collector{
+func NewCollector(retention time.Duration) *Collector {
+	if retention <= 0 {
+		retention = time.Hour
+	}
+
+	c := &Collector{
+		retention:  retention,
 		requests:   make([]provider.ProviderMetrics, 0),
 		byProvider: make(map[string]*ProviderStats),
 		byModel:    make(map[string]*ModelStats),
+
+		inFlightByProvider: make(map[string]int64),
 	}
+
+	// Start cleanup goroutine
+	go c.cleanup()
+
+	return c
 }
 
 func (c *Collector) RecordRequest(m provider.ProviderMetrics) {
@@ -77,6 +150,10 @@ func (c *Collector) RecordRequest(m provider.ProviderMetrics) {
 	if !m.Success {
 		ps.Errors++
 	}
+	ps.ErrorRate = float64(ps.Errors) / float64(ps.Requests)
+	if m.InvalidJSON {
+		ps.InvalidJSON++
+	}
 
 	// Update model stats
 	if _, ok := c.byModel[m.Model]; !ok {
@@ -86,20 +163,92 @@ func (c *Collector) RecordRequest(m provider.ProviderMetrics) {
 	ms.Requests++
 	ms.PromptTokens += int64(m.PromptTokens)
 	ms.CompletionTokens += int64(m.CompletionTokens)
+	ms.CacheWriteTokens += int64(m.CacheWriteTokens)
+	ms.CacheReadTokens += int64(m.CacheReadTokens)
+	if m.Estimated {
+		ms.EstimatedRequests++
+	}
+	ms.StrippedReasoningTokens += int64(m.StrippedReasoningTokens)
 	ms.Cost += m.Cost
 	ms.AvgLatencyMs = (ms.AvgLatencyMs*float64(ms.Requests-1) + float64(m.LatencyMs)) / float64(ms.Requests)
+}
 
-	// Cleanup old metrics (keep last hour)
-	cutoff := time.Now().Add(-time.Hour)
-	newRequests := make([]provider.ProviderMetrics, 0)
-	for _, req := range c.requests {
-		if req.Timestamp.After(cutoff) {
-			newRequests = append(newRequests, req)
-		}
+// cleanup periodically drops raw metrics older than the retention window
+func (c *Collector) cleanup() {
+	interval := time.Minute
+	if c.retention < interval {
+		interval = c.retention
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		c.trim(time.Now().Add(-c.retention))
 	}
+}
+
+func (c *Collector) trim(cutoff time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Requests are appended in time order, so find the first one to keep
+	i := 0
+	for i < len(c.requests) && !c.requests[i].Timestamp.After(cutoff) {
+		i++
+	}
+	if i == 0 {
+		return
+	}
+
+	newRequests := make([]provider.ProviderMetrics, len(c.requests)-i)
+	copy(newRequests, c.requests[i:])
 	c.requests = newRequests
 }
 
+// SetRetryBudget exports the state of the providers' retry budget
+func (c *Collector) SetRetryBudget(b *provider.RetryBudget) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.retryBudget = b
+}
+
+// SetRedisCache exports the Redis cache's error count and breaker state
+func (c *Collector) SetRedisCache(rc *cache.RedisCache) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.redisCache = rc
+}
+
+// RequestStarted marks a request as in flight. Pair with RequestFinished.
+func (c *Collector) RequestStarted() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight++
+}
+
+// RequestFinished marks a request started with RequestStarted as done
+func (c *Collector) RequestFinished() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+}
+
+// ProviderRequestStarted marks a request routed to a provider as in flight.
+// Pair with ProviderRequestFinished.
+func (c *Collector) ProviderRequestStarted(provider string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlightByProvider[provider]++
+}
+
+// ProviderRequestFinished marks a provider request as done
+func (c *Collector) ProviderRequestFinished(provider string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlightByProvider[provider]--
+}
+
 func (c *Collector) RecordCacheHit() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -127,61 +276,115 @@ func (c *Collector) GetStats() AggregatedStats {
 	}
 }
 
-func (c *Collector) Prometheus() string {
+// GetDetailedStats returns a snapshot of per-provider and per-model usage.
+// When metadataKey is set, usage is also grouped by that metadata value.
+func (c *Collector) GetDetailedStats(metadataKey string) DetailedStats {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	var output string
+	stats := DetailedStats{
+		ByProvider:     make(map[string]ProviderStats, len(c.byProvider)),
+		ByModel:        make(map[string]ModelStats, len(c.byModel)),
+		ProviderErrors: make(map[string]ErrorStats, len(c.byProvider)),
+	}
+	for name, ps := range c.byProvider {
+		stats.ByProvider[name] = *ps
+	}
+	for name, ms := range c.byModel {
+		stats.ByModel[name] = *ms
+	}
 
-	// Total requests
-	output += fmt.Sprintf("# HELP llm_gateway_requests_total Total number of requests\n")
-	output += fmt.Sprintf("# TYPE llm_gateway_requests_total counter\n")
-	output += fmt.Sprintf("llm_gateway_requests_total %d\n", len(c.requests))
+	for _, req := range c.requests {
+		es := stats.ProviderErrors[req.Provider]
+		es.Requests++
+		if !req.Success {
+			es.Errors++
+		}
+		es.ErrorRate = float64(es.Errors) / float64(es.Requests)
+		stats.ProviderErrors[req.Provider] = es
+	}
 
-	// Total tokens
-	output += fmt.Sprintf("# HELP llm_gateway_tokens_total Total number of tokens processed\n")
-	output += fmt.Sprintf("# TYPE llm_gateway_tokens_total counter\n")
-	output += fmt.Sprintf("llm_gateway_tokens_total %d\n", c.totalTokens)
+	for _, req := range c.requests {
+		if req.Timing == nil {
+			continue
+		}
+		if stats.ProviderTiming == nil {
+			stats.ProviderTiming = make(map[string]TimingStats)
+		}
 
-	// Total cost
-	output += fmt.Sprintf("# HELP llm_gateway_cost_total Total cost in USD\n")
-	output += fmt.Sprintf("# TYPE llm_gateway_cost_total counter\n")
-	output += fmt.Sprintf("llm_gateway_cost_total %.6f\n", c.totalCost)
+		ts := stats.ProviderTiming[req.Provider]
+		ts.Requests++
+		ts.AvgFirstByteMs += (req.Timing.FirstByteMs - ts.AvgFirstByteMs) / float64(ts.Requests)
+		if !req.Timing.ConnReused {
+			ts.NewConnections++
+			n := float64(ts.NewConnections)
+			ts.AvgDNSMs += (req.Timing.DNSMs - ts.AvgDNSMs) / n
+			ts.AvgConnectMs += (req.Timing.ConnectMs - ts.AvgConnectMs) / n
+			ts.AvgTLSMs += (req.Timing.TLSMs - ts.AvgTLSMs) / n
+		}
+		stats.ProviderTiming[req.Provider] = ts
+	}
 
-	// Cache stats
-	output += fmt.Sprintf("# HELP llm_gateway_cache_hits_total Total cache hits\n")
-	output += fmt.Sprintf("# TYPE llm_gateway_cache_hits_total counter\n")
-	output += fmt.Sprintf("llm_gateway_cache_hits_total %d\n", c.cacheHits)
+	if metadataKey != "" {
+		stats.ByMetadata = make(map[string]MetadataStats)
+		for _, req := range c.requests {
+			value, ok := req.Metadata[metadataKey]
+			if !ok {
+				value = "(unset)"
+			}
+			ms := stats.ByMetadata[value]
+			ms.Requests++
+			ms.Tokens += int64(req.TotalTokens)
+			ms.Cost += req.Cost
+			stats.ByMetadata[value] = ms
+		}
+	}
 
-	output += fmt.Sprintf("# HELP llm_gateway_cache_misses_total Total cache misses\n")
-	output += fmt.Sprintf("# TYPE llm_gateway_cache_misses_total counter\n")
-	output += fmt.Sprintf("llm_gateway_cache_misses_total %d\n", c.cacheMisses)
+	return stats
+}
 
-	// Per-provider metrics
-	output += fmt.Sprintf("# HELP llm_gateway_provider_requests_total Requests per provider\n")
-	output += fmt.Sprintf("# TYPE llm_gateway_provider_requests_total counter\n")
-	for name, stats := range c.byProvider {
-		output += fmt.Sprintf("llm_gateway_provider_requests_total{provider=\"%s\"} %d\n", name, stats.Requests)
+// GetUserStats groups usage in the retention window by the request's user
+// field. Only the limit users with the highest cost are listed; the rest are
+// summed under "(other)". Requests without a user are under "(unset)".
+func (c *Collector) GetUserStats(limit int) map[string]MetadataStats {
+	c.mu.RLock()
+	users := make(map[string]MetadataStats)
+	for _, req := range c.requests {
+		user := req.User
+		if user == "" {
+			user = "(unset)"
+		}
+		us := users[user]
+		us.Requests++
+		us.Tokens += int64(req.TotalTokens)
+		us.Cost += req.Cost
+		users[user] = us
 	}
+	c.mu.RUnlock()
 
-	output += fmt.Sprintf("# HELP llm_gateway_provider_latency_avg_ms Average latency per provider\n")
-	output += fmt.Sprintf("# TYPE llm_gateway_provider_latency_avg_ms gauge\n")
-	for name, stats := range c.byProvider {
-		output += fmt.Sprintf("llm_gateway_provider_latency_avg_ms{provider=\"%s\"} %.2f\n", name, stats.AvgLatencyMs)
+	if limit <= 0 || len(users) <= limit {
+		return users
 	}
 
-	// Per-model metrics
-	output += fmt.Sprintf("# HELP llm_gateway_model_requests_total Requests per model\n")
-	output += fmt.Sprintf("# TYPE llm_gateway_model_requests_total counter\n")
-	for name, stats := range c.byModel {
-		output += fmt.Sprintf("llm_gateway_model_requests_total{model=\"%s\"} %d\n", name, stats.Requests)
+	names := make([]string, 0, len(users))
+	for name := range users {
+		names = append(names, name)
 	}
+	sort.Slice(names, func(i, j int) bool {
+		if users[names[i]].Cost != users[names[j]].Cost {
+			return users[names[i]].Cost > users[names[j]].Cost
+		}
+		return names[i] < names[j]
+	})
 
-	output += fmt.Sprintf("# HELP llm_gateway_model_cost_total Cost per model\n")
-	output += fmt.Sprintf("# TYPE llm_gateway_model_cost_total counter\n")
-	for name, stats := range c.byModel {
-		output += fmt.Sprintf("llm_gateway_model_cost_total{model=\"%s\"} %.6f\n", name, stats.Cost)
+	var other MetadataStats
+	for _, name := range names[limit:] {
+		us := users[name]
+		other.Requests += us.Requests
+		other.Tokens += us.Tokens
+		other.Cost += us.Cost
+		delete(users, name)
 	}
-
-	return output
+	users["(other)"] = other
+	return users
 }
@@ -1,8 +1,10 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
@@ -38,15 +40,21 @@ func Logger(logger zerolog.Logger) func(http.Handler) http.Handler {
 // RateLimiter manages rate limits per key
 type RateLimiter struct {
 	cfg      config.RateLimitConfig
-	limiters map[string]*rate.Limiter
+	limiters map[string]*limiterEntry
 	mu       sync.RWMutex
 	global   *rate.Limiter
+	queue    *fairQueue // nil unless queuing is enabled
+}
+
+type limiterEntry struct {
+	limiter    *rate.Limiter
+	lastAccess int64 // unix nanoseconds, updated atomically under the read lock
 }
 
 func NewRateLimiter(cfg config.RateLimitConfig) *RateLimiter {
 	rl := &RateLimiter{
 		cfg:      cfg,
-		limiters: make(map[string]*rate.Limiter),
+		limiters: make(map[string]*limiterEntry),
 	}
 
 	// Setup global limiter
@@ -55,35 +63,83 @@ func NewRateLimiter(cfg config.RateLimitConfig) *RateLimiter {
 			rate.Limit(float64(cfg.Global.Requests)/cfg.Global.Window.Seconds()),
 			cfg.Global.Requests,
 		)
+
+		if cfg.Queuing.Enabled {
+			rl.queue = newFairQueue(rl.global, cfg.Queuing.MaxQueueSize)
+		}
+	}
+
+	// Start idle limiter sweeper
+	if cfg.IdleTTL > 0 {
+		go rl.cleanup()
 	}
 
 	return rl
 }
 
 func (rl *RateLimiter) getLimiter(key string) *rate.Limiter {
+	now := time.Now().UnixNano()
+
 	rl.mu.RLock()
-	limiter, ok := rl.limiters[key]
+	entry, ok := rl.limiters[key]
+	if ok {
+		atomic.StoreInt64(&entry.lastAccess, now)
+	}
 	rl.mu.RUnlock()
 
 	if ok {
-		return limiter
+		return entry.limiter
 	}
 
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
 	// Double-check after acquiring write lock
-	if limiter, ok := rl.limiters[key]; ok {
-		return limiter
+	if entry, ok := rl.limiters[key]; ok {
+		atomic.StoreInt64(&entry.lastAccess, now)
+		return entry.limiter
+	}
+
+	entry = &limiterEntry{
+		limiter: rate.NewLimiter(
+			rate.Limit(float64(rl.cfg.PerKey.Requests)/rl.cfg.PerKey.Window.Seconds()),
+			rl.cfg.PerKey.Requests,
+		),
+		lastAccess: now,
+	}
+	rl.limiters[key] = entry
+
+	return entry.limiter
+}
+
+func (rl *RateLimiter) cleanup() {
+	interval := rl.cfg.IdleTTL / 2
+	if interval > time.Minute {
+		interval = time.Minute
 	}
 
-	limiter = rate.NewLimiter(
-		rate.Limit(float64(rl.cfg.PerKey.Requests)/rl.cfg.PerKey.Window.Seconds()),
-		rl.cfg.PerKey.Requests,
-	)
-	rl.limiters[key] = limiter
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	return limiter
+	for now := range ticker.C {
+		rl.sweep(now)
+	}
+}
+
+// sweep evicts limiters untouched since now minus IdleTTL. An evicted key
+// that returns starts again with a full bucket, which an idle limiter would
+// usually have refilled to anyway.
+func (rl *RateLimiter) sweep(now time.Time) {
+	cutoff := now.Add(-rl.cfg.IdleTTL).UnixNano()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for key, entry := range rl.limiters {
+		if atomic.LoadInt64(&entry.lastAccess) < cutoff {
+			delete(rl.limiters, key)
+		}
+	}
 }
 
 func (rl *RateLimiter) Allow(key string) bool {
@@ -97,6 +153,83 @@ func (rl *RateLimiter) Allow(key string) bool {
 	return limiter.Allow()
 }
 
+// AllowN is Allow for a request that stands for n, such as a batch. The
+// key's limit must hold all n, so a batch is never half charged to it.
+func (rl *RateLimiter) AllowN(key string, n int) bool {
+	now := time.Now()
+	limiter := rl.getLimiter(key)
+	if limiter.TokensAt(now) < float64(n) {
+		return false
+	}
+
+	if rl.global != nil && !rl.global.AllowN(now, n) {
+		return false
+	}
+	return limiter.AllowN(now, n)
+}
+
+// Wait is Allow with queuing: a request within its per-key limit that finds
+// the global limit exhausted waits for capacity instead of being rejected.
+// With fair queuing, waiting keys take turns at the global capacity. A
+// request turned away by a full queue doesn't count against its key.
+func (rl *RateLimiter) Wait(ctx context.Context, key string) error {
+	return rl.WaitN(ctx, key, 1)
+}
+
+// WaitN is Wait for a request that stands for n. The key's limit must hold
+// all n up front; each then queues for global capacity in turn, within one
+// MaxWaitTime.
+func (rl *RateLimiter) WaitN(ctx context.Context, key string, n int) error {
+	limiter := rl.getLimiter(key)
+	if limiter.Tokens() < float64(n) {
+		return errRateLimited
+	}
+
+	if rl.cfg.Queuing.MaxWaitTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rl.cfg.Queuing.MaxWaitTime)
+		defer cancel()
+	}
+
+	queueKey := ""
+	if rl.cfg.Queuing.Fair {
+		queueKey = key
+	}
+	for i := 0; i < n; i++ {
+		if err := rl.queue.wait(ctx, queueKey, limiter.Allow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allowN applies the rate limit to a request that stands for n
+func (rl *RateLimiter) allowN(ctx context.Context, key string, n int) bool {
+	if rl.queue != nil {
+		return rl.WaitN(ctx, key, n) == nil
+	}
+	return rl.AllowN(key, n)
+}
+
+// rateLimitContextKey holds the limit a request passed
+type rateLimitContextKey struct{}
+
+type appliedRateLimit struct {
+	rl  *RateLimiter
+	key string
+}
+
+// ChargeRateLimit takes n more requests from the rate limit r already
+// passed, for a request that stands for several, such as a batch. It
+// reports whether they fit, and is always true when rate limiting is off.
+func ChargeRateLimit(r *http.Request, n int) bool {
+	applied, ok := r.Context().Value(rateLimitContextKey{}).(appliedRateLimit)
+	if !ok || n <= 0 {
+		return true
+	}
+	return applied.rl.allowN(r.Context(), applied.key, n)
+}
+
 // RateLimit returns a rate limiting middleware
 func RateLimit(cfg config.RateLimitConfig) func(http.Handler) http.Handler {
 	rl := NewRateLimiter(cfg)
@@ -109,7 +242,7 @@ func RateLimit(cfg config.RateLimitConfig) func(http.Handler) http.Handler {
 				key = r.RemoteAddr
 			}
 
-			if !rl.Allow(key) {
+			if !rl.allowN(r.Context(), key, 1) {
 				w.Header().Set("Content-Type", "application/json")
 				w.Header().Set("Retry-After", "60")
 				w.WriteHeader(http.StatusTooManyRequests)
@@ -117,7 +250,8 @@ func RateLimit(cfg config.RateLimitConfig) func(http.Handler) http.Handler {
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			ctx := context.WithValue(r.Context(), rateLimitContextKey{}, appliedRateLimit{rl: rl, key: key})
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yourorg/llm-gateway/internal/config"
+)
+
+func TestRateLimiterEvictsIdleKeys(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{
+		PerKey:  config.RateLimit{Requests: 2, Window: time.Minute},
+		IdleTTL: time.Hour,
+	})
+
+	if !rl.Allow("idle") || !rl.Allow("idle") || rl.Allow("idle") {
+		t.Fatal("per-key limit of 2 not applied")
+	}
+	rl.Allow("busy")
+
+	rl.sweep(time.Now().Add(30 * time.Minute))
+	if len(rl.limiters) != 2 {
+		t.Fatalf("%d limiters after a sweep within the TTL, want 2", len(rl.limiters))
+	}
+
+	// Touch busy, then sweep as if idle has been unused past the TTL
+	rl.limiters["busy"].lastAccess = time.Now().Add(time.Hour).UnixNano()
+	rl.sweep(time.Now().Add(90 * time.Minute))
+	if _, ok := rl.limiters["idle"]; ok {
+		t.Error("idle limiter kept past the TTL")
+	}
+	if _, ok := rl.limiters["busy"]; !ok {
+		t.Error("recently used limiter evicted")
+	}
+
+	// An evicted key starts over with a full bucket
+	if !rl.Allow("idle") {
+		t.Error("evicted key still limited")
+	}
+}
+
+func TestWaitFullQueueKeepsKeyLimit(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{
+		Global: config.RateLimit{Requests: 1, Window: time.Hour},
+		PerKey: config.RateLimit{Requests: 1, Window: time.Hour},
+		Queuing: config.QueuingConfig{
+			Enabled:      true,
+			MaxQueueSize: 1,
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := rl.Wait(ctx, "first"); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+
+	// The global limit is spent, so this one fills the queue
+	queued := make(chan error, 1)
+	go func() { queued <- rl.Wait(ctx, "queued") }()
+	for {
+		rl.queue.mu.Lock()
+		size := rl.queue.size
+		rl.queue.mu.Unlock()
+		if size == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := rl.Wait(ctx, "rejected"); err != errQueueFull {
+		t.Fatalf("err = %v, want errQueueFull", err)
+	}
+	if !rl.getLimiter("rejected").Allow() {
+		t.Error("a request turned away by the full queue used up its key's limit")
+	}
+
+	cancel()
+	if err := <-queued; err == nil {
+		t.Error("queued request went through without global capacity")
+	}
+}
+
+func TestAllowNTakesAllOrNothing(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{
+		Global: config.RateLimit{Requests: 10, Window: time.Hour},
+		PerKey: config.RateLimit{Requests: 3, Window: time.Hour},
+	})
+
+	if !rl.AllowN("k", 2) {
+		t.Fatal("2 of a limit of 3 rejected")
+	}
+	if rl.AllowN("k", 2) {
+		t.Fatal("2 more allowed with 1 left")
+	}
+	if !rl.Allow("k") {
+		t.Error("a rejected AllowN used up the key's last request")
+	}
+	if tokens := rl.global.Tokens(); tokens < 7 || tokens >= 8 {
+		t.Errorf("global has %.1f left, want 7", tokens)
+	}
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	errRateLimited = errors.New("rate limit exceeded")
+	errQueueFull   = errors.New("rate limit queue is full")
+)
+
+// fairQueue hands out global rate-limit capacity to waiting requests. Each
+// key has its own FIFO and keys with waiters take turns, so under contention
+// a busy key gets the same share as a quiet one instead of crowding it out.
+// Requests queued under a single key are simply served in arrival order.
+type fairQueue struct {
+	limiter *rate.Limiter
+	maxSize int
+
+	mu     sync.Mutex
+	queues map[string][]chan struct{}
+	keys   []string // keys with waiters, in turn order
+	size   int
+
+	wake chan struct{}
+}
+
+func newFairQueue(limiter *rate.Limiter, maxSize int) *fairQueue {
+	q := &fairQueue{
+		limiter: limiter,
+		maxSize: maxSize,
+		queues:  make(map[string][]chan struct{}),
+		wake:    make(chan struct{}, 1),
+	}
+	go q.dispatch()
+	return q
+}
+
+// wait blocks until the request may proceed, ctx is done, or the queue is
+// full. admit applies the caller's own limit once the queue has room, so a
+// request turned away as full isn't charged for it. Nothing is queued while
+// capacity is available.
+func (q *fairQueue) wait(ctx context.Context, key string, admit func() bool) error {
+	q.mu.Lock()
+	if q.maxSize > 0 && q.size >= q.maxSize {
+		q.mu.Unlock()
+		return errQueueFull
+	}
+	if !admit() {
+		q.mu.Unlock()
+		return errRateLimited
+	}
+	if q.size == 0 && q.limiter.Allow() {
+		q.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	if len(q.queues[key]) == 0 {
+		q.keys = append(q.keys, key)
+	}
+	q.queues[key] = append(q.queues[key], ready)
+	q.size++
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		q.remove(key, ready)
+		return ctx.Err()
+	}
+}
+
+// dispatch releases one waiter per token, taking keys in turn
+func (q *fairQueue) dispatch() {
+	for range q.wake {
+		for {
+			q.mu.Lock()
+			empty := q.size == 0
+			q.mu.Unlock()
+			if empty {
+				break
+			}
+
+			// Wait only fails for a cancelled context or a burst of zero
+			if err := q.limiter.Wait(context.Background()); err != nil {
+				break
+			}
+
+			q.mu.Lock()
+			ready := q.pop()
+			q.mu.Unlock()
+			if ready != nil {
+				close(ready)
+			}
+		}
+	}
+}
+
+// pop removes the next waiter, moving its key to the back of the turn
+// order. Callers hold q.mu.
+func (q *fairQueue) pop() chan struct{} {
+	if len(q.keys) == 0 {
+		return nil
+	}
+
+	key := q.keys[0]
+	waiters := q.queues[key]
+	ready := waiters[0]
+
+	q.keys = q.keys[1:]
+	if len(waiters) == 1 {
+		delete(q.queues, key)
+	} else {
+		q.queues[key] = waiters[1:]
+		q.keys = append(q.keys, key)
+	}
+	q.size--
+
+	return ready
+}
+
+// remove drops a waiter that gave up. It is a no-op if the waiter was
+// already released.
+func (q *fairQueue) remove(key string, ready chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	waiters := q.queues[key]
+	for i, w := range waiters {
+		if w != ready {
+			continue
+		}
+
+		q.size--
+		if len(waiters) > 1 {
+			q.queues[key] = append(waiters[:i:i], waiters[i+1:]...)
+			return
+		}
+
+		delete(q.queues, key)
+		for j, k := range q.keys {
+			if k == key {
+				q.keys = append(q.keys[:j:j], q.keys[j+1:]...)
+				break
+			}
+		}
+		return
+	}
+}
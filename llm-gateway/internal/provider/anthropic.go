@@ -8,6 +8,10 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/yourorg/llm-gateway/internal/config"
 )
 
 type AnthropicProvider struct {
@@ -18,15 +22,47 @@ type AnthropicProvider struct {
 	timeout    time.Duration
 	maxRetries int
 	client     *http.Client
+	limits     map[string]config.ModelLimit
+	caching    config.PromptCachingConfig
+	chatPath   string // path template, "" for /messages
+	logger     zerolog.Logger
+
+	// retryBudget is shared by all providers; nil retries without limit
+	retryBudget *RetryBudget
+
+	// requestIDHeader forwards the gateway request id; "" doesn't
+	requestIDHeader string
 }
 
 type AnthropicConfig struct {
-	Name       string
-	APIKey     string
-	BaseURL    string
-	Models     []string
-	Timeout    time.Duration
-	MaxRetries int
+	Name            string
+	APIKey          string
+	BaseURL         string
+	Models          []string
+	Timeout         time.Duration
+	MaxRetries      int
+	ModelLimits     map[string]config.ModelLimit
+	DisableHTTP2    bool
+	PromptCaching   config.PromptCachingConfig
+	ChatPath        string
+	Logger          zerolog.Logger
+	RetryBudget     *RetryBudget
+	RequestIDHeader string
+}
+
+// anthropicHealthCheckModel is the model HealthCheck sends a minimal request to
+const anthropicHealthCheckModel = "claude-3-haiku-20240307"
+
+// anthropicDefaultMaxTokens is sent when neither the client nor config
+// sets max_tokens, which the Messages API requires
+const anthropicDefaultMaxTokens = 4096
+
+// anthropicMaxOutputTokens is the largest max_tokens each model accepts
+var anthropicMaxOutputTokens = map[string]int{
+	"claude-3-opus-20240229":     4096,
+	"claude-3-sonnet-20240229":   4096,
+	"claude-3-haiku-20240307":    4096,
+	"claude-3-5-sonnet-20241022": 8192,
 }
 
 // Anthropic API request format
@@ -37,14 +73,32 @@ type anthropicRequest struct {
 	Temperature *float64           `json:"temperature,omitempty"`
 	TopP        *float64           `json:"top_p,omitempty"`
 	Stream      bool               `json:"stream,omitempty"`
-	System      string             `json:"system,omitempty"`
+	// StopSequences is OpenAI's stop under Anthropic's name
+	StopSequences []string `json:"stop_sequences,omitempty"`
+	// System and message Content are plain strings, or content blocks when
+	// marked for prompt caching
+	System interface{} `json:"system,omitempty"`
 }
 
 type anthropicMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+type anthropicTextBlock struct {
+	Type         string                 `json:"type"`
+	Text         string                 `json:"text"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
 }
 
+type anthropicCacheControl struct {
+	Type string `json:"type"`
+}
+
+// anthropicMaxCacheBreakpoints is how many blocks one request may mark with
+// cache_control
+const anthropicMaxCacheBreakpoints = 4
+
 // Anthropic API response format
 type anthropicResponse struct {
 	ID           string                 `json:"id"`
@@ -60,11 +114,16 @@ type anthropicResponse struct {
 type anthropicContent struct {
 	Type string `json:"type"`
 	Text string `json:"text"`
+	// Thinking is set on "thinking" blocks from models with extended
+	// thinking enabled
+	Thinking string `json:"thinking"`
 }
 
 type anthropicUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
 }
 
 func NewAnthropicProvider(cfg AnthropicConfig) *AnthropicProvider {
@@ -95,9 +154,14 @@ func NewAnthropicProvider(cfg AnthropicConfig) *AnthropicProvider {
 		models:     models,
 		timeout:    timeout,
 		maxRetries: cfg.MaxRetries,
-		client: &http.Client{
-			Timeout: timeout,
-		},
+		client:     newHTTPClient(timeout, cfg.DisableHTTP2),
+		limits:     normalizeLimits(cfg.ModelLimits),
+		caching:    cfg.PromptCaching,
+		chatPath:   cfg.ChatPath,
+		logger:     cfg.Logger,
+
+		retryBudget:     cfg.RetryBudget,
+		requestIDHeader: cfg.RequestIDHeader,
 	}
 }
 
@@ -110,10 +174,8 @@ func (p *AnthropicProvider) Models() []string {
 }
 
 func (p *AnthropicProvider) SupportsModel(model string) bool {
-	for _, m := range p.models {
-		if m == model {
-			return true
-		}
+	if _, ok := findModel(p.models, model); ok {
+		return true
 	}
 	// Also check for short names
 	shortNames := map[string]bool{
@@ -122,18 +184,22 @@ func (p *AnthropicProvider) SupportsModel(model string) bool {
 		"claude-3-haiku":    true,
 		"claude-3-5-sonnet": true,
 	}
-	return shortNames[model]
+	return shortNames[NormalizeModel(model)]
 }
 
 func (p *AnthropicProvider) ChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	if err := p.checkSingleChoice(req); err != nil {
+		return nil, err
+	}
+
 	anthropicReq := p.convertRequest(req)
 
-	body, err := json.Marshal(anthropicReq)
+	body, err := marshalWithExtra(anthropicReq, req.ExtraParams)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/messages", bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+expandPath(p.chatPath, "/messages", anthropicReq.Model), bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -149,33 +215,44 @@ func (p *AnthropicProvider) ChatCompletion(ctx context.Context, req *ChatComplet
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
+		message := readErrorBody(resp.Body)
 		return nil, &ProviderError{
 			Provider:   p.name,
 			StatusCode: resp.StatusCode,
-			Message:    string(bodyBytes),
+			Message:    message,
 			Type:       "api_error",
 		}
 	}
 
 	var anthropicResp anthropicResponse
-	if err := json.NewDecoder(resp.Body).Decode(&anthropicResp); err != nil {
+	respBody, err := readResponse(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(respBody, &anthropicResp); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return p.convertResponse(&anthropicResp, req.Model), nil
+	result := p.convertResponse(&anthropicResp, req.Model)
+	result.RateLimits = rateLimitHeaders(resp.Header)
+
+	return result, nil
 }
 
 func (p *AnthropicProvider) ChatCompletionStream(ctx context.Context, req *ChatCompletionRequest) (io.ReadCloser, error) {
+	if err := p.checkSingleChoice(req); err != nil {
+		return nil, err
+	}
+
 	anthropicReq := p.convertRequest(req)
 	anthropicReq.Stream = true
 
-	body, err := json.Marshal(anthropicReq)
+	body, err := marshalWithExtra(anthropicReq, req.ExtraParams)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/messages", bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+expandPath(p.chatPath, "/messages", anthropicReq.Model), bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -184,31 +261,34 @@ func (p *AnthropicProvider) ChatCompletionStream(ctx context.Context, req *ChatC
 	httpReq.Header.Set("x-api-key", p.apiKey)
 	httpReq.Header.Set("anthropic-version", "2023-06-01")
 	httpReq.Header.Set("Accept", "text/event-stream")
+	setRequestIDHeader(httpReq, p.requestIDHeader)
 
 	resp, err := p.client.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
+	recordUpstreamRequestID(ctx, resp.Header)
 
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
+		message := readErrorBody(resp.Body)
 		resp.Body.Close()
 		return nil, &ProviderError{
 			Provider:   p.name,
 			StatusCode: resp.StatusCode,
-			Message:    string(bodyBytes),
+			Message:    message,
 			Type:       "api_error",
 		}
 	}
 
 	// Return a wrapper that converts Anthropic SSE to OpenAI format
-	return &anthropicStreamAdapter{reader: resp.Body, model: req.Model}, nil
+	adapter := newAnthropicStreamAdapter(resp.Body, req.Model)
+	return withRateLimits(adapter, rateLimitHeaders(resp.Header)), nil
 }
 
 func (p *AnthropicProvider) HealthCheck(ctx context.Context) error {
 	// Anthropic doesn't have a models endpoint, so we do a minimal request
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/messages", bytes.NewReader([]byte(`{
-		"model": "claude-3-haiku-20240307",
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+expandPath(p.chatPath, "/messages", anthropicHealthCheckModel), bytes.NewReader([]byte(`{
+		"model": "`+anthropicHealthCheckModel+`",
 		"max_tokens": 1,
 		"messages": [{"role": "user", "content": "hi"}]
 	}`)))
@@ -233,6 +313,26 @@ func (p *AnthropicProvider) HealthCheck(ctx context.Context) error {
 	return nil
 }
 
+// Warmup opens a connection to the provider without the cost of a
+// HealthCheck, which sends a real message
+func (p *AnthropicProvider) Warmup(ctx context.Context) error {
+	return warmupConn(ctx, p.client, p.baseURL)
+}
+
+// checkSingleChoice rejects n > 1, which the Messages API has no equivalent
+// for. Silently returning one choice would break clients indexing choices.
+func (p *AnthropicProvider) checkSingleChoice(req *ChatCompletionRequest) error {
+	if req.N != nil && *req.N > 1 {
+		return &ProviderError{
+			Provider:   p.name,
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("provider %s does not support n > 1", p.name),
+			Type:       "invalid_request_error",
+		}
+	}
+	return nil
+}
+
 func (p *AnthropicProvider) convertRequest(req *ChatCompletionRequest) *anthropicRequest {
 	var systemPrompt string
 	var messages []anthropicMessage
@@ -254,21 +354,104 @@ func (p *AnthropicProvider) convertRequest(req *ChatCompletionRequest) *anthropi
 		}
 	}
 
-	maxTokens := 4096
-	if req.MaxTokens != nil {
-		maxTokens = *req.MaxTokens
-	}
-
 	model := p.mapModel(req.Model)
 
-	return &anthropicRequest{
+	anthropicReq := &anthropicRequest{
 		Model:       model,
 		Messages:    messages,
-		MaxTokens:   maxTokens,
+		MaxTokens:   p.maxTokens(req, model),
 		Temperature: req.Temperature,
 		TopP:        req.TopP,
-		System:      systemPrompt,
+
+		StopSequences: req.Stop,
+	}
+	if systemPrompt != "" {
+		anthropicReq.System = systemPrompt
+	}
+
+	if p.promptCaching(req) {
+		p.markCacheable(anthropicReq, systemPrompt)
 	}
+
+	return anthropicReq
+}
+
+// promptCaching reports whether a request's prompt should be marked for
+// caching: the request's x-gateway.prompt_cache if set, else the config
+func (p *AnthropicProvider) promptCaching(req *ChatCompletionRequest) bool {
+	if req.XGateway != nil && req.XGateway.PromptCache != nil {
+		return *req.XGateway.PromptCache
+	}
+	return p.caching.Enabled
+}
+
+// markCacheable adds cache_control breakpoints to the system prompt and to
+// the latest user messages of at least caching.MinMessageChars, within
+// Anthropic's per-request breakpoint limit
+func (p *AnthropicProvider) markCacheable(req *anthropicRequest, systemPrompt string) {
+	breakpoints := anthropicMaxCacheBreakpoints
+
+	if systemPrompt != "" {
+		req.System = []anthropicTextBlock{cacheableBlock(systemPrompt)}
+		breakpoints--
+	}
+
+	if p.caching.MinMessageChars <= 0 {
+		return
+	}
+	for i := len(req.Messages) - 1; i >= 0 && breakpoints > 0; i-- {
+		msg := &req.Messages[i]
+		text, ok := msg.Content.(string)
+		if msg.Role != "user" || !ok || len(text) < p.caching.MinMessageChars {
+			continue
+		}
+		msg.Content = []anthropicTextBlock{cacheableBlock(text)}
+		breakpoints--
+	}
+}
+
+func cacheableBlock(text string) anthropicTextBlock {
+	return anthropicTextBlock{
+		Type:         "text",
+		Text:         text,
+		CacheControl: &anthropicCacheControl{Type: "ephemeral"},
+	}
+}
+
+// maxTokens resolves max_tokens for a request: the client's value, else the
+// configured per-model default, else anthropicDefaultMaxTokens, clamped to
+// what the model accepts
+func (p *AnthropicProvider) maxTokens(req *ChatCompletionRequest, model string) int {
+	limit, ok := p.limits[NormalizeModel(req.Model)]
+	if !ok {
+		limit = p.limits[NormalizeModel(model)]
+	}
+
+	maxTokens := anthropicDefaultMaxTokens
+	if limit.DefaultMaxTokens > 0 {
+		maxTokens = limit.DefaultMaxTokens
+	}
+	requested := requestedMaxTokens(req)
+	if requested != nil {
+		maxTokens = *requested
+	}
+
+	ceiling := limit.MaxOutputTokens
+	if ceiling == 0 {
+		ceiling = anthropicMaxOutputTokens[model]
+	}
+	if ceiling > 0 && maxTokens > ceiling {
+		if requested != nil {
+			p.logger.Warn().
+				Str("model", model).
+				Int("requested", maxTokens).
+				Int("max", ceiling).
+				Msg("Clamping max_tokens to model limit")
+		}
+		maxTokens = ceiling
+	}
+
+	return maxTokens
 }
 
 func (p *AnthropicProvider) mapModel(model string) string {
@@ -279,17 +462,26 @@ func (p *AnthropicProvider) mapModel(model string) string {
 		"claude-3-5-sonnet": "claude-3-5-sonnet-20241022",
 	}
 
-	if mapped, ok := modelMap[model]; ok {
+	if mapped, ok := modelMap[NormalizeModel(model)]; ok {
 		return mapped
 	}
+	if m, ok := findModel(p.models, model); ok {
+		return m
+	}
 	return model
 }
 
 func (p *AnthropicProvider) convertResponse(resp *anthropicResponse, requestModel string) *ChatCompletionResponse {
-	content := ""
+	// Thinking is surfaced as reasoning_content, where
+	// routing.reasoningTransforms can strip it. Redacted thinking is
+	// encrypted and has nothing to show.
+	content, thinking := "", ""
 	for _, c := range resp.Content {
-		if c.Type == "text" {
+		switch c.Type {
+		case "text":
 			content += c.Text
+		case "thinking":
+			thinking += c.Thinking
 		}
 	}
 
@@ -307,8 +499,9 @@ func (p *AnthropicProvider) convertResponse(resp *anthropicResponse, requestMode
 			{
 				Index: 0,
 				Message: Message{
-					Role:    "assistant",
-					Content: content,
+					Role:             "assistant",
+					Content:          content,
+					ReasoningContent: thinking,
 				},
 				FinishReason: finishReason,
 			},
@@ -317,6 +510,9 @@ func (p *AnthropicProvider) convertResponse(resp *anthropicResponse, requestMode
 			PromptTokens:     resp.Usage.InputTokens,
 			CompletionTokens: resp.Usage.OutputTokens,
 			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+
+			CacheCreationInputTokens: resp.Usage.CacheCreationInputTokens,
+			CacheReadInputTokens:     resp.Usage.CacheReadInputTokens,
 		},
 	}
 }
@@ -328,7 +524,17 @@ func (p *AnthropicProvider) doWithRetry(req *http.Request) (*http.Response, erro
 		maxRetries = 3
 	}
 
+	setRequestIDHeader(req, p.requestIDHeader)
+
+	p.retryBudget.deposit()
 	for attempt := 0; attempt < maxRetries; attempt++ {
+		if attempt > 0 {
+			if !p.retryBudget.withdraw() {
+				return nil, fmt.Errorf("retry budget exhausted: %w", lastErr)
+			}
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+
 		var bodyBytes []byte
 		if req.Body != nil {
 			bodyBytes, _ = io.ReadAll(req.Body)
@@ -338,17 +544,21 @@ func (p *AnthropicProvider) doWithRetry(req *http.Request) (*http.Response, erro
 		resp, err := p.client.Do(req)
 		if err != nil {
 			lastErr = err
-			time.Sleep(time.Duration(attempt+1) * time.Second)
 			if bodyBytes != nil {
 				req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 			}
 			continue
 		}
+		recordUpstreamRequestID(req.Context(), resp.Header)
 
 		if resp.StatusCode == 429 || resp.StatusCode >= 500 {
 			resp.Body.Close()
-			lastErr = fmt.Errorf("request failed with status %d", resp.StatusCode)
-			time.Sleep(time.Duration(attempt+1) * time.Second)
+			lastErr = &ProviderError{
+				Provider:   p.name,
+				StatusCode: resp.StatusCode,
+				Message:    fmt.Sprintf("request failed with status %d", resp.StatusCode),
+				Type:       "api_error",
+			}
 			if bodyBytes != nil {
 				req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 			}
@@ -360,17 +570,3 @@ func (p *AnthropicProvider) doWithRetry(req *http.Request) (*http.Response, erro
 
 	return nil, fmt.Errorf("max retries exceeded: %w", lastErr)
 }
-
-// anthropicStreamAdapter converts Anthropic SSE to OpenAI format
-type anthropicStreamAdapter struct {
-	reader io.ReadCloser
-	model  string
-}
-
-func (a *anthropicStreamAdapter) Read(p []byte) (n int, err error) {
-	return a.reader.Read(p)
-}
-
-func (a *anthropicStreamAdapter) Close() error {
-	return a.reader.Close()
-}
@@ -0,0 +1,121 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnthropicRejectsMultipleChoices(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	p := NewAnthropicProvider(AnthropicConfig{Name: "anthropic", APIKey: "k", BaseURL: srv.URL})
+	n := 2
+	req := &ChatCompletionRequest{
+		Model:    "claude-3-haiku",
+		Messages: []Message{{Role: "user", Content: "hi"}},
+		N:        &n,
+	}
+
+	_, err := p.ChatCompletion(context.Background(), req)
+	checkBadRequest(t, "ChatCompletion", err)
+	_, err = p.ChatCompletionStream(context.Background(), req)
+	checkBadRequest(t, "ChatCompletionStream", err)
+
+	if called {
+		t.Error("n = 2 was sent upstream")
+	}
+}
+
+func checkBadRequest(t *testing.T, call string, err error) {
+	t.Helper()
+	var perr *ProviderError
+	if !errors.As(err, &perr) || perr.StatusCode != http.StatusBadRequest {
+		t.Errorf("%s: err = %v, want a 400 ProviderError", call, err)
+	}
+}
+
+func TestAnthropicConvertResponse(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantContent   string
+		wantReasoning string
+		wantFinish    string
+		wantUsage     Usage
+	}{
+		{
+			name:        "text",
+			body:        `{"id":"msg_1","content":[{"type":"text","text":"Hello"}],"stop_reason":"end_turn","usage":{"input_tokens":10,"output_tokens":2}}`,
+			wantContent: "Hello",
+			wantFinish:  "stop",
+			wantUsage:   Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12},
+		},
+		{
+			name: "thinking then text",
+			body: `{"id":"msg_2","content":[
+				{"type":"thinking","thinking":"Add them.","signature":"sig"},
+				{"type":"text","text":"4"}],
+				"stop_reason":"end_turn","usage":{"input_tokens":8,"output_tokens":20}}`,
+			wantContent:   "4",
+			wantReasoning: "Add them.",
+			wantFinish:    "stop",
+			wantUsage:     Usage{PromptTokens: 8, CompletionTokens: 20, TotalTokens: 28},
+		},
+		{
+			name: "redacted thinking is dropped",
+			body: `{"id":"msg_3","content":[
+				{"type":"redacted_thinking","data":"EmwKAhgB"},
+				{"type":"thinking","thinking":"Visible.","signature":"sig"},
+				{"type":"text","text":"Part one, "},
+				{"type":"text","text":"part two"}],
+				"stop_reason":"max_tokens",
+				"usage":{"input_tokens":5,"output_tokens":50,"cache_creation_input_tokens":40,"cache_read_input_tokens":300}}`,
+			wantContent:   "Part one, part two",
+			wantReasoning: "Visible.",
+			wantFinish:    "length",
+			wantUsage: Usage{
+				PromptTokens: 5, CompletionTokens: 50, TotalTokens: 55,
+				CacheCreationInputTokens: 40, CacheReadInputTokens: 300,
+			},
+		},
+	}
+
+	p := &AnthropicProvider{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp anthropicResponse
+			if err := json.Unmarshal([]byte(tt.body), &resp); err != nil {
+				t.Fatal(err)
+			}
+			got := p.convertResponse(&resp, "claude-3-haiku")
+
+			if got.Model != "claude-3-haiku" {
+				t.Errorf("Model = %q, want the requested model", got.Model)
+			}
+			if len(got.Choices) != 1 {
+				t.Fatalf("got %d choices, want 1", len(got.Choices))
+			}
+			msg := got.Choices[0].Message
+			if msg.Content != tt.wantContent {
+				t.Errorf("Content = %q, want %q", msg.Content, tt.wantContent)
+			}
+			if msg.ReasoningContent != tt.wantReasoning {
+				t.Errorf("ReasoningContent = %q, want %q", msg.ReasoningContent, tt.wantReasoning)
+			}
+			if got.Choices[0].FinishReason != tt.wantFinish {
+				t.Errorf("FinishReason = %q, want %q", got.Choices[0].FinishReason, tt.wantFinish)
+			}
+			if got.Usage != tt.wantUsage {
+				t.Errorf("Usage = %+v, want %+v", got.Usage, tt.wantUsage)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// anthropicMaxEventBytes bounds a single upstream event so a stream that
+// never sends a blank line can't grow the buffer without limit
+const anthropicMaxEventBytes = 1 << 20
+
+var errAnthropicEventTooLarge = errors.New("anthropic stream event exceeds size limit")
+
+// anthropicStreamEvent is the union of the Messages API stream events the
+// adapter reads
+type anthropicStreamEvent struct {
+	Type  string `json:"type"`
+	Index int    `json:"index"`
+
+	// message_start
+	Message struct {
+		ID    string         `json:"id"`
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+
+	// content_block_start
+	ContentBlock struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"content_block"`
+
+	// content_block_delta and message_delta
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		Thinking    string `json:"thinking"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+
+	// message_delta
+	Usage anthropicUsage `json:"usage"`
+
+	// error
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicStreamAdapter converts Anthropic SSE to OpenAI format: text
+// deltas become content, thinking deltas reasoning_content, tool_use blocks
+// indexed tool_calls fragments, and the stop reason the finish_reason. A
+// final chunk always carries the usage, as OpenAI sends for stream_options;
+// the gateway drops it for clients that didn't ask.
+type anthropicStreamAdapter struct {
+	reader io.ReadCloser
+	events *bufio.Reader
+	model  string
+
+	id      string
+	created int64
+	usage   Usage
+
+	// tools maps a tool_use content block's index to its tool_calls index,
+	// which counts tool calls only
+	tools map[int]int
+
+	out  bytes.Buffer
+	done bool
+}
+
+func newAnthropicStreamAdapter(reader io.ReadCloser, model string) *anthropicStreamAdapter {
+	return &anthropicStreamAdapter{
+		reader:  reader,
+		events:  bufio.NewReader(reader),
+		model:   model,
+		created: time.Now().Unix(),
+		tools:   make(map[int]int),
+	}
+}
+
+func (a *anthropicStreamAdapter) Read(p []byte) (n int, err error) {
+	for a.out.Len() == 0 {
+		if a.done {
+			return 0, io.EOF
+		}
+		data, err := a.nextData()
+		if err == io.EOF {
+			a.done = true
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err := a.translate(data); err != nil {
+			return 0, err
+		}
+	}
+	return a.out.Read(p)
+}
+
+func (a *anthropicStreamAdapter) Close() error {
+	return a.reader.Close()
+}
+
+// nextData returns the data of the next event that has any, joining
+// multi-line data fields with "\n"
+func (a *anthropicStreamAdapter) nextData() (string, error) {
+	var parts []string
+	size := 0
+	for {
+		line, err := a.events.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF && parts != nil {
+				return strings.Join(parts, "\n"), nil
+			}
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if parts != nil {
+				return strings.Join(parts, "\n"), nil
+			}
+			continue
+		}
+
+		size += len(line)
+		if size > anthropicMaxEventBytes {
+			return "", errAnthropicEventTooLarge
+		}
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			parts = append(parts, strings.TrimPrefix(value, " "))
+		}
+	}
+}
+
+// translate writes the OpenAI chunks for one Anthropic event
+func (a *anthropicStreamAdapter) translate(data string) error {
+	var ev anthropicStreamEvent
+	if err := json.Unmarshal([]byte(data), &ev); err != nil {
+		return fmt.Errorf("failed to decode stream event: %w", err)
+	}
+
+	switch ev.Type {
+	case "message_start":
+		a.id = ev.Message.ID
+		a.usage.PromptTokens = ev.Message.Usage.InputTokens
+		a.usage.CompletionTokens = ev.Message.Usage.OutputTokens
+		a.usage.CacheCreationInputTokens = ev.Message.Usage.CacheCreationInputTokens
+		a.usage.CacheReadInputTokens = ev.Message.Usage.CacheReadInputTokens
+		return a.writeChunk(ChunkDelta{Role: "assistant"}, nil)
+
+	case "content_block_start":
+		if ev.ContentBlock.Type != "tool_use" {
+			return nil
+		}
+		index := len(a.tools)
+		a.tools[ev.Index] = index
+		return a.writeChunk(ChunkDelta{ToolCalls: []ToolCallDelta{{
+			Index:    index,
+			ID:       ev.ContentBlock.ID,
+			Type:     "function",
+			Function: &FunctionCallDelta{Name: ev.ContentBlock.Name},
+		}}}, nil)
+
+	case "content_block_delta":
+		switch ev.Delta.Type {
+		case "text_delta":
+			return a.writeChunk(ChunkDelta{Content: ev.Delta.Text}, nil)
+		case "thinking_delta":
+			// Redacted thinking and the signature_delta closing a thinking
+			// block have nothing to show
+			return a.writeChunk(ChunkDelta{ReasoningContent: ev.Delta.Thinking}, nil)
+		case "input_json_delta":
+			index, ok := a.tools[ev.Index]
+			if !ok || ev.Delta.PartialJSON == "" {
+				return nil
+			}
+			return a.writeChunk(ChunkDelta{ToolCalls: []ToolCallDelta{{
+				Index:    index,
+				Function: &FunctionCallDelta{Arguments: ev.Delta.PartialJSON},
+			}}}, nil)
+		}
+
+	case "message_delta":
+		// output_tokens is cumulative, so the last one is the total
+		a.usage.CompletionTokens = ev.Usage.OutputTokens
+		if ev.Delta.StopReason == "" {
+			return nil
+		}
+		finishReason := anthropicFinishReason(ev.Delta.StopReason)
+		return a.writeChunk(ChunkDelta{}, &finishReason)
+
+	case "message_stop":
+		usage := a.usage
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		if err := a.writeUsageChunk(&usage); err != nil {
+			return err
+		}
+		a.out.WriteString("data: [DONE]\n\n")
+		a.done = true
+
+	case "error":
+		// Relay the error in the shape the gateway uses for its own stream
+		// errors, and end the stream there
+		payload, err := json.Marshal(map[string]interface{}{
+			"error": map[string]string{
+				"message": ev.Error.Message,
+				"type":    ev.Error.Type,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal stream error: %w", err)
+		}
+		fmt.Fprintf(&a.out, "data: %s\n\n", payload)
+		a.done = true
+	}
+
+	// ping, content_block_stop and anything newer carry nothing to relay
+	return nil
+}
+
+func (a *anthropicStreamAdapter) writeChunk(delta ChunkDelta, finishReason *string) error {
+	return a.write(ChatCompletionChunk{
+		ID:      a.id,
+		Object:  "chat.completion.chunk",
+		Created: a.created,
+		Model:   a.model,
+		Choices: []ChunkChoice{{Index: 0, Delta: delta, FinishReason: finishReason}},
+	})
+}
+
+func (a *anthropicStreamAdapter) writeUsageChunk(usage *Usage) error {
+	return a.write(ChatCompletionChunk{
+		ID:      a.id,
+		Object:  "chat.completion.chunk",
+		Created: a.created,
+		Model:   a.model,
+		Choices: []ChunkChoice{},
+		Usage:   usage,
+	})
+}
+
+func (a *anthropicStreamAdapter) write(chunk ChatCompletionChunk) error {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return fmt.Errorf("failed to marshal chunk: %w", err)
+	}
+	fmt.Fprintf(&a.out, "data: %s\n\n", data)
+	return nil
+}
+
+// anthropicFinishReason maps a Messages API stop_reason to an OpenAI
+// finish_reason
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	}
+	return "stop"
+}
@@ -0,0 +1,204 @@
+package provider
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+// anthropicSSE renders Messages API stream events as the upstream sends them
+func anthropicSSE(events ...string) io.ReadCloser {
+	var b strings.Builder
+	for _, ev := range events {
+		var typed struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal([]byte(ev), &typed)
+		b.WriteString("event: " + typed.Type + "\ndata: " + ev + "\n\n")
+	}
+	return io.NopCloser(strings.NewReader(b.String()))
+}
+
+// readChunks drains an adapter and decodes its chunks, checking the stream
+// ends with [DONE]
+func readChunks(t *testing.T, r io.Reader) []ChatCompletionChunk {
+	t.Helper()
+	body, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var chunks []ChatCompletionChunk
+	done := false
+	for _, event := range strings.Split(strings.TrimSpace(string(body)), "\n\n") {
+		data, ok := strings.CutPrefix(event, "data: ")
+		if !ok {
+			t.Fatalf("event without data: %q", event)
+		}
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("bad chunk %q: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if !done {
+		t.Fatal("stream didn't end with [DONE]")
+	}
+	return chunks
+}
+
+func TestAnthropicStreamToolUse(t *testing.T) {
+	stream := anthropicSSE(
+		`{"type":"message_start","message":{"id":"msg_1","usage":{"input_tokens":12,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Checking."}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_a","name":"get_weather","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":""}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Oslo\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"ping"}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_b","name":"get_time","input":{}}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{}"}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":40}}`,
+		`{"type":"message_stop"}`,
+	)
+	chunks := readChunks(t, newAnthropicStreamAdapter(stream, "claude-3-5-sonnet"))
+
+	var content string
+	calls := map[int]*struct{ id, name, args string }{}
+	var finishReason string
+	for _, chunk := range chunks {
+		if chunk.ID != "msg_1" || chunk.Model != "claude-3-5-sonnet" || chunk.Object != "chat.completion.chunk" {
+			t.Errorf("chunk header = %q %q %q", chunk.ID, chunk.Model, chunk.Object)
+		}
+		if chunk.Usage != nil && len(chunk.Choices) != 0 {
+			t.Error("usage sent on a chunk with choices")
+		}
+		for _, choice := range chunk.Choices {
+			content += choice.Delta.Content
+			for _, call := range choice.Delta.ToolCalls {
+				c := calls[call.Index]
+				if c == nil {
+					if call.ID == "" || call.Type != "function" {
+						t.Errorf("first fragment for tool call %d = %+v", call.Index, call)
+					}
+					c = &struct{ id, name, args string }{id: call.ID}
+					calls[call.Index] = c
+				}
+				c.name += call.Function.Name
+				c.args += call.Function.Arguments
+			}
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+		}
+	}
+
+	if content != "Checking." {
+		t.Errorf("content = %q", content)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("got %d tool calls, want 2", len(calls))
+	}
+	if c := calls[0]; c.id != "toolu_a" || c.name != "get_weather" || c.args != `{"city":"Oslo"}` {
+		t.Errorf("tool call 0 = %+v", *c)
+	}
+	if c := calls[1]; c.id != "toolu_b" || c.name != "get_time" || c.args != `{}` {
+		t.Errorf("tool call 1 = %+v", *c)
+	}
+	if finishReason != "tool_calls" {
+		t.Errorf("finish_reason = %q, want tool_calls", finishReason)
+	}
+}
+
+func TestAnthropicStreamUsage(t *testing.T) {
+	stream := anthropicSSE(
+		`{"type":"message_start","message":{"id":"msg_2","usage":{"input_tokens":10,"output_tokens":1,"cache_read_input_tokens":300,"cache_creation_input_tokens":5}}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":7}}`,
+		`{"type":"message_stop"}`,
+	)
+	chunks := readChunks(t, newAnthropicStreamAdapter(stream, "claude-3-haiku"))
+
+	last := chunks[len(chunks)-1]
+	if last.Usage == nil || len(last.Choices) != 0 {
+		t.Fatalf("last chunk = %+v, want a usage chunk without choices", last)
+	}
+	want := Usage{PromptTokens: 10, CompletionTokens: 7, TotalTokens: 17, CacheReadInputTokens: 300, CacheCreationInputTokens: 5}
+	if *last.Usage != want {
+		t.Errorf("usage = %+v, want %+v", *last.Usage, want)
+	}
+
+	finish := chunks[len(chunks)-2].Choices[0].FinishReason
+	if finish == nil || *finish != "length" {
+		t.Errorf("finish_reason = %v, want length", finish)
+	}
+}
+
+func TestAnthropicStreamError(t *testing.T) {
+	stream := anthropicSSE(
+		`{"type":"message_start","message":{"id":"msg_3","usage":{}}}`,
+		`{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`,
+	)
+	body, err := io.ReadAll(newAnthropicStreamAdapter(stream, "claude-3-haiku"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := strings.Split(strings.TrimSpace(string(body)), "\n\n")
+	last := events[len(events)-1]
+	if last != `data: {"error":{"message":"Overloaded","type":"overloaded_error"}}` {
+		t.Errorf("last event = %q", last)
+	}
+}
+
+func TestAnthropicStreamThinking(t *testing.T) {
+	stream := anthropicSSE(
+		`{"type":"message_start","message":{"id":"msg_4","usage":{"input_tokens":5}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Two plus two "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"is four."}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"c2ln"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"redacted_thinking","data":"ZW5j"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"text_delta","text":"The answer "}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"text_delta","text":"is 4."}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":30}}`,
+		`{"type":"message_stop"}`,
+	)
+	chunks := readChunks(t, newAnthropicStreamAdapter(stream, "claude-3-7-sonnet"))
+
+	var reasoning, content string
+	for _, chunk := range chunks {
+		for _, choice := range chunk.Choices {
+			if choice.Delta.ReasoningContent != "" && content != "" {
+				t.Error("reasoning_content streamed after content")
+			}
+			reasoning += choice.Delta.ReasoningContent
+			content += choice.Delta.Content
+		}
+	}
+	if reasoning != "Two plus two is four." {
+		t.Errorf("reasoning_content = %q", reasoning)
+	}
+	if content != "The answer is 4." {
+		t.Errorf("content = %q", content)
+	}
+
+	// The usage chunk comes after the finish_reason
+	finish := chunks[len(chunks)-2].Choices[0].FinishReason
+	if finish == nil || *finish != "stop" {
+		t.Errorf("finish_reason = %v, want stop", finish)
+	}
+}
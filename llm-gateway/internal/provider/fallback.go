@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FallbackOnConnection in routing.fallbackOn falls back when a provider
+// can't be reached or returns no response at all
+const FallbackOnConnection = "connection"
+
+// DefaultFallbackOn retries rate limits, server errors and unreachable
+// providers; other client errors would fail the same way everywhere
+var DefaultFallbackOn = []string{"429", "5xx", FallbackOnConnection}
+
+// fallbackPolicy decides which provider errors move a request on to the
+// next provider in the fallback chain
+type fallbackPolicy struct {
+	codes      map[int]bool
+	classes    map[int]bool // status / 100, for entries like "5xx"
+	connection bool
+}
+
+// newFallbackPolicy parses routing.fallbackOn: status codes ("429"), status
+// classes ("5xx") and "connection". An empty list uses DefaultFallbackOn.
+func newFallbackPolicy(conditions []string) (fallbackPolicy, error) {
+	if len(conditions) == 0 {
+		conditions = DefaultFallbackOn
+	}
+
+	p := fallbackPolicy{
+		codes:   make(map[int]bool),
+		classes: make(map[int]bool),
+	}
+	for _, cond := range conditions {
+		cond = strings.ToLower(strings.TrimSpace(cond))
+
+		switch {
+		case cond == FallbackOnConnection:
+			p.connection = true
+		case len(cond) == 3 && strings.HasSuffix(cond, "xx") && cond[0] >= '1' && cond[0] <= '5':
+			p.classes[int(cond[0]-'0')] = true
+		default:
+			code, err := strconv.Atoi(cond)
+			if err != nil || code < 100 || code > 599 {
+				return fallbackPolicy{}, fmt.Errorf("invalid fallbackOn entry %q: want a status code, a class like 5xx, or %q", cond, FallbackOnConnection)
+			}
+			p.codes[code] = true
+		}
+	}
+	return p, nil
+}
+
+// decide reports whether err should fall back, with the reason for logs
+func (p fallbackPolicy) decide(err error) (bool, string) {
+	if errors.Is(err, context.Canceled) {
+		return false, "request cancelled"
+	}
+
+	var provErr *ProviderError
+	if !errors.As(err, &provErr) {
+		if p.connection {
+			return true, "connection error"
+		}
+		return false, "connection errors are not a fallback condition"
+	}
+
+	code := provErr.StatusCode
+	switch {
+	case p.codes[code]:
+		return true, fmt.Sprintf("status %d is a fallback condition", code)
+	case p.classes[code/100]:
+		return true, fmt.Sprintf("status %d matches %dxx", code, code/100)
+	default:
+		return false, fmt.Sprintf("status %d is not a fallback condition", code)
+	}
+}
@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Caps on what is read of a non-streaming response. The client has no
+// overall timeout, so nothing else stops an upstream that keeps sending from
+// filling memory.
+const (
+	maxResponseBytes  = 32 << 20
+	maxErrorBodyBytes = 64 << 10
+)
+
+var errResponseTooLarge = fmt.Errorf("provider response exceeds %d bytes", maxResponseBytes)
+
+// readResponse reads a successful non-streaming response body
+func readResponse(body io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(body, maxResponseBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if len(data) > maxResponseBytes {
+		return nil, errResponseTooLarge
+	}
+	return data, nil
+}
+
+// readErrorBody reads the start of an error response for its message
+func readErrorBody(body io.Reader) string {
+	data, _ := io.ReadAll(io.LimitReader(body, maxErrorBodyBytes))
+	return string(data)
+}
+
+// Warmer is implemented by providers that can open a connection ahead of
+// the first request
+type Warmer interface {
+	Warmup(ctx context.Context) error
+}
+
+// newHTTPClient builds the HTTP client used to talk to a provider.
+//
+// The configured timeout bounds how long we wait for the upstream to start
+// responding (ResponseHeaderTimeout). It deliberately does not bound the
+// whole exchange: a streaming response may run far longer than that, and its
+// lifetime is governed by the request context instead (client disconnect or
+// the server's write timeout).
+//
+// HTTP/2 is attempted unless disableHTTP2 is set. A custom transport only
+// negotiates it when ForceAttemptHTTP2 is on, so we set it explicitly rather
+// than rely on what DefaultTransport happens to carry.
+func newHTTPClient(timeout time.Duration, disableHTTP2 bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+
+	if disableHTTP2 {
+		// A non-nil, empty TLSNextProto stops the transport upgrading to h2
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	} else {
+		transport.ForceAttemptHTTP2 = true
+	}
+
+	return &http.Client{
+		Transport: transport,
+	}
+}
+
+// warmupConn sends a HEAD request to baseURL so the client's transport holds
+// an established connection. Any response will do; the body is drained so
+// the connection goes back to the pool.
+func warmupConn(ctx context.Context, client *http.Client, baseURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, baseURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
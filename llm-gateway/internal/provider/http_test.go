@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// endless reads as an upstream that never stops sending
+type endless struct{}
+
+func (endless) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = ' '
+	}
+	return len(p), nil
+}
+
+func TestReadResponseLimit(t *testing.T) {
+	if _, err := readResponse(endless{}); !errors.Is(err, errResponseTooLarge) {
+		t.Errorf("endless body: err = %v, want errResponseTooLarge", err)
+	}
+
+	body := bytes.Repeat([]byte("x"), maxResponseBytes)
+	data, err := readResponse(bytes.NewReader(body))
+	if err != nil || len(data) != maxResponseBytes {
+		t.Errorf("body at the limit: %d bytes, err %v", len(data), err)
+	}
+}
+
+func TestErrorBodyTruncated(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(strings.Repeat("e", 4*maxErrorBodyBytes)))
+	}))
+	defer srv.Close()
+
+	p := NewOpenAIProvider(OpenAIConfig{Name: "openai", APIKey: "k", BaseURL: srv.URL, MaxRetries: 1})
+	_, err := p.ChatCompletion(context.Background(), &ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []Message{{Role: "user", Content: "hi"}},
+	})
+
+	var perr *ProviderError
+	if !errors.As(err, &perr) {
+		t.Fatalf("err = %v, want a ProviderError", err)
+	}
+	if len(perr.Message) != maxErrorBodyBytes {
+		t.Errorf("error message is %d bytes, want it cut at %d", len(perr.Message), maxErrorBodyBytes)
+	}
+}
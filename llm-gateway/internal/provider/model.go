@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"strings"
+
+	"github.com/yourorg/llm-gateway/internal/config"
+)
+
+// NormalizeModel canonicalizes a model name for matching, so that minor
+// differences like "GPT-4o" vs "gpt-4o " still route to the same model
+func NormalizeModel(model string) string {
+	return strings.ToLower(strings.TrimSpace(model))
+}
+
+// findModel returns the entry in models matching model after normalization,
+// preserving the configured spelling for upstream calls
+func findModel(models []string, model string) (string, bool) {
+	normalized := NormalizeModel(model)
+	for _, m := range models {
+		if NormalizeModel(m) == normalized {
+			return m, true
+		}
+	}
+	return "", false
+}
+
+// normalizeLimits keys per-model limits by normalized model, so lookups
+// with NormalizeModel match however the model was spelled in config
+func normalizeLimits(limits map[string]config.ModelLimit) map[string]config.ModelLimit {
+	normalized := make(map[string]config.ModelLimit, len(limits))
+	for model, limit := range limits {
+		normalized[NormalizeModel(model)] = limit
+	}
+	return normalized
+}
+
+// maxCompletionTokensPrefixes are the model families that reject max_tokens
+// in favor of max_completion_tokens
+var maxCompletionTokensPrefixes = []string{"o1", "o3"}
+
+// usesMaxCompletionTokens reports whether a model takes max_completion_tokens
+// rather than max_tokens, from the built-in families or the model's limits,
+// which are keyed by normalized model
+func usesMaxCompletionTokens(model string, limits map[string]config.ModelLimit) bool {
+	normalized := NormalizeModel(model)
+	if limit, ok := limits[normalized]; ok && limit.MaxCompletionTokens {
+		return true
+	}
+
+	for _, prefix := range maxCompletionTokensPrefixes {
+		if normalized == prefix || strings.HasPrefix(normalized, prefix+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// requestedMaxTokens returns the client's output token limit from either
+// max_tokens or max_completion_tokens
+func requestedMaxTokens(req *ChatCompletionRequest) *int {
+	if req.MaxTokens != nil {
+		return req.MaxTokens
+	}
+	return req.MaxCompletionTokens
+}
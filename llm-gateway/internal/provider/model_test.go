@@ -0,0 +1,25 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/yourorg/llm-gateway/internal/config"
+)
+
+func TestModelLimitsMatchAnyCase(t *testing.T) {
+	limits := map[string]config.ModelLimit{
+		"Claude-3-Haiku-20240307": {DefaultMaxTokens: 1000},
+		" My-Reasoner ":           {MaxCompletionTokens: true},
+	}
+
+	anthropic := NewAnthropicProvider(AnthropicConfig{Name: "anthropic", ModelLimits: limits})
+	req := &ChatCompletionRequest{Model: "CLAUDE-3-haiku-20240307"}
+	if got := anthropic.maxTokens(req, anthropic.mapModel(req.Model)); got != 1000 {
+		t.Errorf("anthropic max_tokens = %d, want the configured default 1000", got)
+	}
+
+	openai := NewOpenAIProvider(OpenAIConfig{Name: "openai", ModelLimits: limits})
+	if !usesMaxCompletionTokens("my-reasoner", openai.limits) {
+		t.Error("my-reasoner doesn't use max_completion_tokens")
+	}
+}
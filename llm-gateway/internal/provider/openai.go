@@ -8,6 +8,8 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"github.com/yourorg/llm-gateway/internal/config"
 )
 
 type OpenAIProvider struct {
@@ -18,15 +20,55 @@ type OpenAIProvider struct {
 	timeout    time.Duration
 	maxRetries int
 	client     *http.Client
+	limits     map[string]config.ModelLimit
+	chatPath   string // path template, "" for /chat/completions
+
+	// disableStreaming buffers stream requests through a non-streaming call
+	disableStreaming bool
+
+	// retryBudget is shared by all providers; nil retries without limit
+	retryBudget *RetryBudget
+
+	// requestIDHeader forwards the gateway request id; "" doesn't
+	requestIDHeader string
+
+	// organization and project are sent as OpenAI-Organization and
+	// OpenAI-Project; "" omits the header
+	organization string
+	project      string
+
+	// allowedOrganizations and allowedProjects are the values a request's
+	// metadata may switch to
+	allowedOrganizations map[string]bool
+	allowedProjects      map[string]bool
 }
 
+// Request metadata keys that override the provider's organization and
+// project, so billing can be split per team. Only values in the provider's
+// allowedOrganizations and allowedProjects are accepted.
+const (
+	metadataOpenAIOrganization = "openai_organization"
+	metadataOpenAIProject      = "openai_project"
+)
+
 type OpenAIConfig struct {
-	Name       string
-	APIKey     string
-	BaseURL    string
-	Models     []string
-	Timeout    time.Duration
-	MaxRetries int
+	Name             string
+	APIKey           string
+	BaseURL          string
+	Models           []string
+	Timeout          time.Duration
+	MaxRetries       int
+	DisableStreaming bool
+	DisableHTTP2     bool
+	ModelLimits      map[string]config.ModelLimit
+	ChatPath         string
+	RetryBudget      *RetryBudget
+	RequestIDHeader  string
+	Organization     string
+	Project          string
+
+	AllowedOrganizations []string
+	AllowedProjects      []string
 }
 
 func NewOpenAIProvider(cfg OpenAIConfig) *OpenAIProvider {
@@ -58,9 +100,18 @@ func NewOpenAIProvider(cfg OpenAIConfig) *OpenAIProvider {
 		models:     models,
 		timeout:    timeout,
 		maxRetries: cfg.MaxRetries,
-		client: &http.Client{
-			Timeout: timeout,
-		},
+		client:     newHTTPClient(timeout, cfg.DisableHTTP2),
+		limits:     normalizeLimits(cfg.ModelLimits),
+		chatPath:   cfg.ChatPath,
+
+		disableStreaming: cfg.DisableStreaming,
+		retryBudget:      cfg.RetryBudget,
+		requestIDHeader:  cfg.RequestIDHeader,
+		organization:     cfg.Organization,
+		project:          cfg.Project,
+
+		allowedOrganizations: stringSet(cfg.AllowedOrganizations),
+		allowedProjects:      stringSet(cfg.AllowedProjects),
 	}
 }
 
@@ -73,31 +124,112 @@ func (p *OpenAIProvider) Models() []string {
 }
 
 func (p *OpenAIProvider) SupportsModel(model string) bool {
-	for _, m := range p.models {
-		if m == model {
-			return true
+	_, ok := findModel(p.models, model)
+	return ok
+}
+
+// upstreamModel returns the configured spelling of a model so a mixed-case
+// request still hits the upstream's exact ID. Unknown models pass through
+// unchanged.
+func (p *OpenAIProvider) upstreamModel(model string) string {
+	if m, ok := findModel(p.models, model); ok {
+		return m
+	}
+	return model
+}
+
+// setMaxTokensField moves the client's output token limit into the field the
+// target model accepts: max_completion_tokens for o1-style models, which
+// reject max_tokens, and max_tokens for everything else, since older models
+// and compatible backends may not know max_completion_tokens
+func (p *OpenAIProvider) setMaxTokensField(req *ChatCompletionRequest) {
+	limit := requestedMaxTokens(req)
+	if limit == nil {
+		return
+	}
+
+	if usesMaxCompletionTokens(req.Model, p.limits) {
+		req.MaxTokens, req.MaxCompletionTokens = nil, limit
+	} else {
+		req.MaxTokens, req.MaxCompletionTokens = limit, nil
+	}
+}
+
+// setAuthHeaders sets the API key and, when there is one, the organization
+// and project. A request's x-gateway metadata may name its own organization
+// or project if the provider allows it; any other is rejected rather than
+// billed to whatever the client names.
+func (p *OpenAIProvider) setAuthHeaders(httpReq *http.Request, req *ChatCompletionRequest) error {
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	organization, project := p.organization, p.project
+	if req != nil && req.XGateway != nil {
+		if v := req.XGateway.Metadata[metadataOpenAIOrganization]; v != "" {
+			if !p.allowedOrganizations[v] {
+				return p.billingOverrideError("organization", v)
+			}
+			organization = v
+		}
+		if v := req.XGateway.Metadata[metadataOpenAIProject]; v != "" {
+			if !p.allowedProjects[v] {
+				return p.billingOverrideError("project", v)
+			}
+			project = v
 		}
 	}
-	return false
+	if organization != "" {
+		httpReq.Header.Set("OpenAI-Organization", organization)
+	}
+	if project != "" {
+		httpReq.Header.Set("OpenAI-Project", project)
+	}
+	return nil
+}
+
+func (p *OpenAIProvider) billingOverrideError(field, value string) error {
+	return &ProviderError{
+		Provider:   p.name,
+		StatusCode: http.StatusBadRequest,
+		Message:    fmt.Sprintf("%s %q is not allowed for provider %s", field, value, p.name),
+		Type:       "invalid_request_error",
+	}
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
 }
 
 func (p *OpenAIProvider) ChatCompletion(ctx context.Context, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
 	// Remove gateway extensions before sending
 	cleanReq := *req
 	cleanReq.XGateway = nil
+	cleanReq.ExtraParams = nil
+	cleanReq.Model = p.upstreamModel(req.Model)
+	p.setMaxTokensField(&cleanReq)
+
+	// OpenAI rejects stream_options on non-streaming requests
+	if !cleanReq.Stream {
+		cleanReq.StreamOptions = nil
+	}
 
-	body, err := json.Marshal(cleanReq)
+	body, err := marshalWithExtra(cleanReq, req.ExtraParams)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+expandPath(p.chatPath, "/chat/completions", cleanReq.Model), bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	if err := p.setAuthHeaders(httpReq, req); err != nil {
+		return nil, err
+	}
 
 	resp, err := p.doWithRetry(httpReq)
 	if err != nil {
@@ -106,60 +238,88 @@ func (p *OpenAIProvider) ChatCompletion(ctx context.Context, req *ChatCompletion
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
+		message := readErrorBody(resp.Body)
 		return nil, &ProviderError{
 			Provider:   p.name,
 			StatusCode: resp.StatusCode,
-			Message:    string(bodyBytes),
+			Message:    message,
 			Type:       "api_error",
 		}
 	}
 
 	var result ChatCompletionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	respBody, err := readResponse(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	result.RateLimits = rateLimitHeaders(resp.Header)
 
 	return &result, nil
 }
 
 func (p *OpenAIProvider) ChatCompletionStream(ctx context.Context, req *ChatCompletionRequest) (io.ReadCloser, error) {
+	// Backends without stream support get a regular call, re-emitted as SSE
+	if p.disableStreaming {
+		bufferedReq := *req
+		bufferedReq.Stream = false
+
+		resp, err := p.ChatCompletion(ctx, &bufferedReq)
+		if err != nil {
+			return nil, err
+		}
+		stream, err := bufferedStream(resp)
+		if err != nil {
+			return nil, err
+		}
+		return withRateLimits(stream, resp.RateLimits), nil
+	}
+
 	// Ensure streaming is enabled
 	streamReq := *req
 	streamReq.Stream = true
 	streamReq.XGateway = nil
+	streamReq.ExtraParams = nil
+	streamReq.Model = p.upstreamModel(req.Model)
+	p.setMaxTokensField(&streamReq)
 
-	body, err := json.Marshal(streamReq)
+	body, err := marshalWithExtra(streamReq, req.ExtraParams)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewReader(body))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+expandPath(p.chatPath, "/chat/completions", streamReq.Model), bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	if err := p.setAuthHeaders(httpReq, req); err != nil {
+		return nil, err
+	}
 	httpReq.Header.Set("Accept", "text/event-stream")
+	setRequestIDHeader(httpReq, p.requestIDHeader)
 
 	resp, err := p.client.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
+	recordUpstreamRequestID(ctx, resp.Header)
 
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
+		message := readErrorBody(resp.Body)
 		resp.Body.Close()
 		return nil, &ProviderError{
 			Provider:   p.name,
 			StatusCode: resp.StatusCode,
-			Message:    string(bodyBytes),
+			Message:    message,
 			Type:       "api_error",
 		}
 	}
 
-	return resp.Body, nil
+	return withRateLimits(resp.Body, rateLimitHeaders(resp.Header)), nil
 }
 
 func (p *OpenAIProvider) HealthCheck(ctx context.Context) error {
@@ -168,7 +328,9 @@ func (p *OpenAIProvider) HealthCheck(ctx context.Context) error {
 		return err
 	}
 
-	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	if err := p.setAuthHeaders(httpReq, nil); err != nil {
+		return err
+	}
 
 	resp, err := p.client.Do(httpReq)
 	if err != nil {
@@ -183,6 +345,11 @@ func (p *OpenAIProvider) HealthCheck(ctx context.Context) error {
 	return nil
 }
 
+// Warmup opens a connection to the provider
+func (p *OpenAIProvider) Warmup(ctx context.Context) error {
+	return warmupConn(ctx, p.client, p.baseURL)
+}
+
 func (p *OpenAIProvider) doWithRetry(req *http.Request) (*http.Response, error) {
 	var lastErr error
 	maxRetries := p.maxRetries
@@ -190,7 +357,17 @@ func (p *OpenAIProvider) doWithRetry(req *http.Request) (*http.Response, error)
 		maxRetries = 3
 	}
 
+	setRequestIDHeader(req, p.requestIDHeader)
+
+	p.retryBudget.deposit()
 	for attempt := 0; attempt < maxRetries; attempt++ {
+		if attempt > 0 {
+			if !p.retryBudget.withdraw() {
+				return nil, fmt.Errorf("retry budget exhausted: %w", lastErr)
+			}
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+
 		// Clone request body for retry
 		var bodyBytes []byte
 		if req.Body != nil {
@@ -201,7 +378,6 @@ func (p *OpenAIProvider) doWithRetry(req *http.Request) (*http.Response, error)
 		resp, err := p.client.Do(req)
 		if err != nil {
 			lastErr = err
-			time.Sleep(time.Duration(attempt+1) * time.Second)
 
 			// Reset body for retry
 			if bodyBytes != nil {
@@ -209,12 +385,17 @@ func (p *OpenAIProvider) doWithRetry(req *http.Request) (*http.Response, error)
 			}
 			continue
 		}
+		recordUpstreamRequestID(req.Context(), resp.Header)
 
 		// Retry on rate limit or server errors
 		if resp.StatusCode == 429 || resp.StatusCode >= 500 {
 			resp.Body.Close()
-			lastErr = fmt.Errorf("request failed with status %d", resp.StatusCode)
-			time.Sleep(time.Duration(attempt+1) * time.Second)
+			lastErr = &ProviderError{
+				Provider:   p.name,
+				StatusCode: resp.StatusCode,
+				Message:    fmt.Sprintf("request failed with status %d", resp.StatusCode),
+				Type:       "api_error",
+			}
 
 			// Reset body for retry
 			if bodyBytes != nil {
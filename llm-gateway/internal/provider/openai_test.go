@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIChatPathUsesUpstreamModel(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.Header.Get("Accept") == "text/event-stream" {
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		fmt.Fprint(w, `{"id":"1","choices":[]}`)
+	}))
+	defer srv.Close()
+
+	p := NewOpenAIProvider(OpenAIConfig{
+		Name:     "azure",
+		APIKey:   "k",
+		BaseURL:  srv.URL,
+		Models:   []string{"gpt-4o"},
+		ChatPath: "/deployments/{model}/chat/completions",
+	})
+	req := &ChatCompletionRequest{Model: "GPT-4o", Messages: []Message{{Role: "user", Content: "hi"}}}
+
+	if _, err := p.ChatCompletion(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	stream, err := p.ChatCompletionStream(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, stream)
+	stream.Close()
+
+	for _, path := range paths {
+		if path != "/deployments/gpt-4o/chat/completions" {
+			t.Errorf("requested %s, want the configured model's casing in the path", path)
+		}
+	}
+	if len(paths) != 2 {
+		t.Errorf("got %d requests, want 2", len(paths))
+	}
+}
+
+func TestOpenAIBillingOverrideAllowlist(t *testing.T) {
+	var org, project string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		org, project = r.Header.Get("OpenAI-Organization"), r.Header.Get("OpenAI-Project")
+		fmt.Fprint(w, `{"id":"1","choices":[]}`)
+	}))
+	defer srv.Close()
+
+	p := NewOpenAIProvider(OpenAIConfig{
+		Name:            "openai",
+		APIKey:          "k",
+		BaseURL:         srv.URL,
+		Organization:    "org-main",
+		Project:         "proj_main",
+		AllowedProjects: []string{"proj_search"},
+	})
+	complete := func(metadata map[string]string) error {
+		_, err := p.ChatCompletion(context.Background(), &ChatCompletionRequest{
+			Model:    "gpt-4o",
+			Messages: []Message{{Role: "user", Content: "hi"}},
+			XGateway: &GatewayExtensions{Metadata: metadata},
+		})
+		return err
+	}
+
+	if err := complete(nil); err != nil || org != "org-main" || project != "proj_main" {
+		t.Errorf("no override: err %v, headers %q %q", err, org, project)
+	}
+	if err := complete(map[string]string{"openai_project": "proj_search"}); err != nil || project != "proj_search" {
+		t.Errorf("allowed project: err %v, project %q", err, project)
+	}
+
+	org, project = "", ""
+	checkBadRequest(t, "unlisted project", complete(map[string]string{"openai_project": "proj_other"}))
+	checkBadRequest(t, "unlisted organization", complete(map[string]string{"openai_organization": "org-other"}))
+	if org != "" || project != "" {
+		t.Error("a rejected override reached the upstream")
+	}
+}
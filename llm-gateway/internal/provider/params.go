@@ -0,0 +1,199 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/yourorg/llm-gateway/internal/config"
+)
+
+// marshalWithExtra encodes an upstream request and merges in the client's
+// extra params. Extra params can add provider-specific knobs but never set a
+// field of the request or of ChatCompletionRequest, even one left out of the
+// encoding as empty; such keys are dropped, so extra params can't get around
+// the checks and defaults applied to typed fields.
+func marshalWithExtra(v interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return body, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	typed := jsonFieldNames(reflect.TypeOf(v))
+	for k, raw := range extra {
+		if typed[k] || chatRequestFields[k] {
+			continue
+		}
+		if _, ok := fields[k]; !ok {
+			fields[k] = raw
+		}
+	}
+
+	return json.Marshal(fields)
+}
+
+// chatRequestFields are the JSON names of ChatCompletionRequest's fields
+var chatRequestFields = jsonFieldNames(reflect.TypeOf(ChatCompletionRequest{}))
+
+// CheckExtraParams rejects extra params that name a standard request field,
+// which has to be set as that field instead
+func CheckExtraParams(extra map[string]json.RawMessage) error {
+	var typed []string
+	for k := range extra {
+		if chatRequestFields[k] {
+			typed = append(typed, k)
+		}
+	}
+	if len(typed) == 0 {
+		return nil
+	}
+	sort.Strings(typed)
+	return fmt.Errorf("extra_params can't set standard fields: %s", strings.Join(typed, ", "))
+}
+
+// jsonFieldNames returns the JSON names of a struct type's fields
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	names := make(map[string]bool)
+	if t.Kind() != reflect.Struct {
+		return names
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// Actions for optional params a provider doesn't support
+const (
+	UnsupportedParamsStrip  = "strip"
+	UnsupportedParamsReject = "reject"
+)
+
+// optionalParam is an optional request param that a provider may not accept
+type optionalParam struct {
+	isSet func(*ChatCompletionRequest) bool
+	clear func(*ChatCompletionRequest)
+}
+
+// optionalParams are the request params a provider can declare unsupported,
+// keyed by their JSON name
+var optionalParams = map[string]optionalParam{
+	"temperature": {
+		func(r *ChatCompletionRequest) bool { return r.Temperature != nil },
+		func(r *ChatCompletionRequest) { r.Temperature = nil },
+	},
+	"top_p": {
+		func(r *ChatCompletionRequest) bool { return r.TopP != nil },
+		func(r *ChatCompletionRequest) { r.TopP = nil },
+	},
+	"stop": {
+		func(r *ChatCompletionRequest) bool { return len(r.Stop) > 0 },
+		func(r *ChatCompletionRequest) { r.Stop = nil },
+	},
+	"presence_penalty": {
+		func(r *ChatCompletionRequest) bool { return r.PresencePenalty != nil },
+		func(r *ChatCompletionRequest) { r.PresencePenalty = nil },
+	},
+	"frequency_penalty": {
+		func(r *ChatCompletionRequest) bool { return r.FrequencyPenalty != nil },
+		func(r *ChatCompletionRequest) { r.FrequencyPenalty = nil },
+	},
+	"user": {
+		func(r *ChatCompletionRequest) bool { return r.User != "" },
+		func(r *ChatCompletionRequest) { r.User = "" },
+	},
+	"logprobs": {
+		func(r *ChatCompletionRequest) bool { return r.Logprobs != nil },
+		func(r *ChatCompletionRequest) { r.Logprobs = nil },
+	},
+	"top_logprobs": {
+		func(r *ChatCompletionRequest) bool { return r.TopLogprobs != nil },
+		func(r *ChatCompletionRequest) { r.TopLogprobs = nil },
+	},
+	"response_format": {
+		func(r *ChatCompletionRequest) bool { return r.ResponseFormat != nil },
+		func(r *ChatCompletionRequest) { r.ResponseFormat = nil },
+	},
+}
+
+// defaultUnsupportedParams are the params each built-in provider is known
+// not to support, used when the config doesn't list its own
+var defaultUnsupportedParams = map[string][]string{
+	"anthropic": {"presence_penalty", "frequency_penalty", "user", "logprobs", "top_logprobs", "response_format"},
+}
+
+// paramPolicy is how a provider handles optional params it doesn't support
+type paramPolicy struct {
+	unsupported []string
+	reject      bool
+}
+
+func newParamPolicy(cfg config.ProviderConfig) (paramPolicy, error) {
+	unsupported := cfg.UnsupportedParams
+	if len(unsupported) == 0 {
+		unsupported = defaultUnsupportedParams[cfg.Name]
+	}
+	for _, name := range unsupported {
+		if _, ok := optionalParams[name]; !ok {
+			return paramPolicy{}, fmt.Errorf("unknown param %q in unsupportedParams", name)
+		}
+	}
+
+	switch cfg.UnsupportedParamsAction {
+	case "", UnsupportedParamsStrip:
+		return paramPolicy{unsupported: unsupported}, nil
+	case UnsupportedParamsReject:
+		return paramPolicy{unsupported: unsupported, reject: true}, nil
+	default:
+		return paramPolicy{}, fmt.Errorf("unknown unsupportedParamsAction %q", cfg.UnsupportedParamsAction)
+	}
+}
+
+// apply strips the unsupported params a request sets, or rejects the
+// request with a 400 naming them
+func (p paramPolicy) apply(providerName string, req *ChatCompletionRequest) error {
+	var set []string
+	for _, name := range p.unsupported {
+		if optionalParams[name].isSet(req) {
+			set = append(set, name)
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	if p.reject {
+		return &ProviderError{
+			Provider:   providerName,
+			StatusCode: http.StatusBadRequest,
+			Message:    fmt.Sprintf("provider %s does not support: %s", providerName, strings.Join(set, ", ")),
+			Type:       "invalid_request_error",
+		}
+	}
+
+	for _, name := range set {
+		optionalParams[name].clear(req)
+	}
+	return nil
+}
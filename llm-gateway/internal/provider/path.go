@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// modelPlaceholder in a path template is replaced with the request's model
+const modelPlaceholder = "{model}"
+
+// ValidatePathTemplate checks a provider's chat path template: it must start
+// with "/" and may contain only the {model} placeholder. Query strings are
+// allowed, e.g. "/deployments/{model}/chat/completions?api-version=2024-02-01".
+func ValidatePathTemplate(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+	if !strings.HasPrefix(tmpl, "/") {
+		return fmt.Errorf("chatPath %q must start with /", tmpl)
+	}
+
+	rest := strings.ReplaceAll(tmpl, modelPlaceholder, "")
+	if i := strings.IndexAny(rest, "{}"); i >= 0 {
+		return fmt.Errorf("chatPath %q: unknown placeholder or stray %q (only %s is supported)", tmpl, rest[i], modelPlaceholder)
+	}
+
+	if _, err := url.Parse(strings.ReplaceAll(tmpl, modelPlaceholder, "model")); err != nil {
+		return fmt.Errorf("chatPath %q: %w", tmpl, err)
+	}
+	return nil
+}
+
+// expandPath resolves a validated path template for a model, falling back
+// to def when no template is configured
+func expandPath(tmpl, def, model string) string {
+	if tmpl == "" {
+		return def
+	}
+	return strings.ReplaceAll(tmpl, modelPlaceholder, url.PathEscape(model))
+}
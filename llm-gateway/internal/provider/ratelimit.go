@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"io"
+	"net/http"
+)
+
+// upstreamRateLimitHeaders maps provider rate-limit headers to the names the
+// gateway re-emits, so clients see one scheme regardless of provider
+var upstreamRateLimitHeaders = map[string]string{
+	// OpenAI
+	"x-ratelimit-limit-requests":     "X-Upstream-RateLimit-Limit-Requests",
+	"x-ratelimit-limit-tokens":       "X-Upstream-RateLimit-Limit-Tokens",
+	"x-ratelimit-remaining-requests": "X-Upstream-RateLimit-Remaining-Requests",
+	"x-ratelimit-remaining-tokens":   "X-Upstream-RateLimit-Remaining-Tokens",
+	"x-ratelimit-reset-requests":     "X-Upstream-RateLimit-Reset-Requests",
+	"x-ratelimit-reset-tokens":       "X-Upstream-RateLimit-Reset-Tokens",
+
+	// Anthropic
+	"anthropic-ratelimit-requests-limit":     "X-Upstream-RateLimit-Limit-Requests",
+	"anthropic-ratelimit-tokens-limit":       "X-Upstream-RateLimit-Limit-Tokens",
+	"anthropic-ratelimit-requests-remaining": "X-Upstream-RateLimit-Remaining-Requests",
+	"anthropic-ratelimit-tokens-remaining":   "X-Upstream-RateLimit-Remaining-Tokens",
+	"anthropic-ratelimit-requests-reset":     "X-Upstream-RateLimit-Reset-Requests",
+	"anthropic-ratelimit-tokens-reset":       "X-Upstream-RateLimit-Reset-Tokens",
+}
+
+// rateLimitHeaders picks the known rate-limit headers out of an upstream
+// response, renamed for the gateway response. Returns nil if there are none.
+func rateLimitHeaders(upstream http.Header) http.Header {
+	var out http.Header
+	for name, gatewayName := range upstreamRateLimitHeaders {
+		if v := upstream.Get(name); v != "" {
+			if out == nil {
+				out = make(http.Header)
+			}
+			out.Set(gatewayName, v)
+		}
+	}
+	return out
+}
+
+// RateLimitedStream is implemented by streams that carry upstream
+// rate-limit headers, which must be copied before the first write
+type RateLimitedStream interface {
+	io.ReadCloser
+	RateLimits() http.Header
+}
+
+type rateLimitedStream struct {
+	io.ReadCloser
+	rateLimits http.Header
+}
+
+func (s *rateLimitedStream) RateLimits() http.Header {
+	return s.rateLimits
+}
+
+// withRateLimits attaches upstream rate-limit headers to a stream
+func withRateLimits(stream io.ReadCloser, rateLimits http.Header) io.ReadCloser {
+	if rateLimits == nil {
+		return stream
+	}
+	return &rateLimitedStream{ReadCloser: stream, rateLimits: rateLimits}
+}
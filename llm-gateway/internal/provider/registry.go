@@ -2,9 +2,12 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 
+	"github.com/rs/zerolog"
+
 	"github.com/yourorg/llm-gateway/internal/config"
 )
 
@@ -12,86 +15,326 @@ import (
 type Registry struct {
 	providers     map[string]Provider
 	modelMapping  map[string]string // model -> provider name
+	aliases       map[string]string // routing.modelMappings alias -> provider name
 	fallbackChain []string
 	defaultProvider string
+	costs         map[string]costPolicy // provider name -> cost policy
+	params        map[string]paramPolicy // provider name -> unsupported params
+	owners        map[string]string      // provider name -> owned_by in /v1/models
+	concurrency   int                    // max parallel health checks, 0 = unlimited
+	fallback      fallbackPolicy
+	logger        zerolog.Logger
 	mu            sync.RWMutex
+
+	// disabled marks providers switched off at runtime by name. It is kept
+	// in memory only and survives provider reloads.
+	disabled map[string]bool
+
+	// retryBudget caps retries across all providers; nil when
+	// routing.retryBudget is disabled. Reloaded providers share it.
+	retryBudget *RetryBudget
+}
+
+// ErrProviderDisabled is returned by GetForModel when the only providers
+// that could serve a model are disabled
+var ErrProviderDisabled = errors.New("providers disabled")
+
+// Cost models a provider can declare in config
+const (
+	CostModelToken   = "token"
+	CostModelFree    = "free"
+	CostModelRequest = "request"
+)
+
+type costPolicy struct {
+	model      string
+	perRequest float64
 }
 
-func NewRegistry(cfg *config.Config) (*Registry, error) {
+func NewRegistry(cfg *config.Config, logger zerolog.Logger) (*Registry, error) {
 	r := &Registry{
-		providers:       make(map[string]Provider),
-		modelMapping:    make(map[string]string),
+		logger:          logger,
+		aliases:         make(map[string]string),
+		disabled:        make(map[string]bool),
 		defaultProvider: cfg.Routing.DefaultProvider,
 		fallbackChain:   cfg.Routing.FallbackChain,
+		concurrency:     cfg.Routing.HealthCheckConcurrency,
+	}
+
+	fallback, err := newFallbackPolicy(cfg.Routing.FallbackOn)
+	if err != nil {
+		return nil, fmt.Errorf("routing: %w", err)
+	}
+	r.fallback = fallback
+
+	if budget := cfg.Routing.RetryBudget; budget.Enabled {
+		if budget.Ratio <= 0 || budget.MaxTokens < 1 {
+			return nil, errors.New("routing: retryBudget needs a positive ratio and maxTokens")
+		}
+		r.retryBudget = NewRetryBudget(budget.Ratio, budget.MaxTokens)
+	}
+
+	for alias, mapping := range cfg.Routing.ModelMappings {
+		r.aliases[NormalizeModel(alias)] = mapping.Provider
 	}
 
 	// Initialize providers
-	for _, provCfg := range cfg.Providers {
+	set, err := r.buildProviders(cfg.Providers)
+	if err != nil {
+		return nil, err
+	}
+	r.setProviders(set)
+
+	return r, nil
+}
+
+// providerSet is everything the registry derives from the providers
+// section, built in full so a reload can swap it in at once
+type providerSet struct {
+	providers    map[string]Provider
+	modelMapping map[string]string
+	costs        map[string]costPolicy
+	params       map[string]paramPolicy
+	owners       map[string]string
+}
+
+func (r *Registry) buildProviders(providers []config.ProviderConfig) (*providerSet, error) {
+	set := &providerSet{
+		providers:    make(map[string]Provider),
+		modelMapping: make(map[string]string),
+		costs:        make(map[string]costPolicy),
+		params:       make(map[string]paramPolicy),
+		owners:       make(map[string]string),
+	}
+
+	for _, provCfg := range providers {
 		provider, err := r.createProvider(provCfg)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create provider %s: %w", provCfg.Name, err)
 		}
-		r.providers[provCfg.Name] = provider
+		set.providers[provCfg.Name] = provider
+
+		policy, err := newCostPolicy(provCfg)
+		if err != nil {
+			return nil, fmt.Errorf("provider %s: %w", provCfg.Name, err)
+		}
+		set.costs[provCfg.Name] = policy
+
+		params, err := newParamPolicy(provCfg)
+		if err != nil {
+			return nil, fmt.Errorf("provider %s: %w", provCfg.Name, err)
+		}
+		set.params[provCfg.Name] = params
+
+		if provCfg.OwnedBy != "" {
+			set.owners[provCfg.Name] = provCfg.OwnedBy
+		}
 
 		// Map models to provider
 		for _, model := range provCfg.Models {
-			r.modelMapping[model] = provCfg.Name
+			set.modelMapping[NormalizeModel(model)] = provCfg.Name
 		}
 	}
 
 	// Add model mappings from config
-	for alias, mapping := range cfg.Routing.ModelMappings {
-		r.modelMapping[alias] = mapping.Provider
+	for alias, name := range r.aliases {
+		set.modelMapping[alias] = name
 	}
 
-	return r, nil
+	return set, nil
+}
+
+func (r *Registry) setProviders(set *providerSet) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.providers = set.providers
+	r.modelMapping = set.modelMapping
+	r.costs = set.costs
+	r.params = set.params
+	r.owners = set.owners
+}
+
+// ReloadProviders rebuilds the providers from a new providers section, e.g.
+// to rotate an API key, and swaps them in at once. Requests already in
+// flight finish on the providers they started with. On error the current
+// providers are kept.
+func (r *Registry) ReloadProviders(providers []config.ProviderConfig) error {
+	set, err := r.buildProviders(providers)
+	if err != nil {
+		return err
+	}
+	r.setProviders(set)
+	return nil
 }
 
 func (r *Registry) createProvider(cfg config.ProviderConfig) (Provider, error) {
+	if err := ValidatePathTemplate(cfg.ChatPath); err != nil {
+		return nil, err
+	}
+
 	switch cfg.Name {
 	case "openai":
 		return NewOpenAIProvider(OpenAIConfig{
-			Name:       cfg.Name,
-			APIKey:     cfg.APIKey,
-			BaseURL:    cfg.BaseURL,
-			Models:     cfg.Models,
-			Timeout:    cfg.Timeout,
-			MaxRetries: cfg.MaxRetries,
+			Name:             cfg.Name,
+			APIKey:           cfg.APIKey,
+			BaseURL:          cfg.BaseURL,
+			Models:           cfg.Models,
+			Timeout:          cfg.Timeout,
+			MaxRetries:       cfg.MaxRetries,
+			DisableStreaming: cfg.DisableStreaming,
+			DisableHTTP2:     cfg.DisableHTTP2,
+			ModelLimits:      cfg.ModelLimits,
+			ChatPath:         cfg.ChatPath,
+			RetryBudget:      r.retryBudget,
+			RequestIDHeader:  cfg.RequestIDHeader,
+			Organization:     cfg.Organization,
+			Project:          cfg.Project,
+
+			AllowedOrganizations: cfg.AllowedOrganizations,
+			AllowedProjects:      cfg.AllowedProjects,
 		}), nil
 
 	case "anthropic":
 		return NewAnthropicProvider(AnthropicConfig{
-			Name:       cfg.Name,
-			APIKey:     cfg.APIKey,
-			BaseURL:    cfg.BaseURL,
-			Models:     cfg.Models,
-			Timeout:    cfg.Timeout,
-			MaxRetries: cfg.MaxRetries,
+			Name:            cfg.Name,
+			APIKey:          cfg.APIKey,
+			BaseURL:         cfg.BaseURL,
+			Models:          cfg.Models,
+			Timeout:         cfg.Timeout,
+			MaxRetries:      cfg.MaxRetries,
+			ModelLimits:     cfg.ModelLimits,
+			DisableHTTP2:    cfg.DisableHTTP2,
+			PromptCaching:   cfg.PromptCaching,
+			ChatPath:        cfg.ChatPath,
+			Logger:          r.logger.With().Str("provider", cfg.Name).Logger(),
+			RetryBudget:     r.retryBudget,
+			RequestIDHeader: cfg.RequestIDHeader,
 		}), nil
 
 	case "azure":
 		return NewOpenAIProvider(OpenAIConfig{
-			Name:       cfg.Name,
-			APIKey:     cfg.APIKey,
-			BaseURL:    cfg.BaseURL,
-			Models:     cfg.Models,
-			Timeout:    cfg.Timeout,
-			MaxRetries: cfg.MaxRetries,
+			Name:             cfg.Name,
+			APIKey:           cfg.APIKey,
+			BaseURL:          cfg.BaseURL,
+			Models:           cfg.Models,
+			Timeout:          cfg.Timeout,
+			MaxRetries:       cfg.MaxRetries,
+			DisableStreaming: cfg.DisableStreaming,
+			DisableHTTP2:     cfg.DisableHTTP2,
+			ModelLimits:      cfg.ModelLimits,
+			ChatPath:         cfg.ChatPath,
+			RetryBudget:      r.retryBudget,
+			RequestIDHeader:  cfg.RequestIDHeader,
+			Organization:     cfg.Organization,
+			Project:          cfg.Project,
+
+			AllowedOrganizations: cfg.AllowedOrganizations,
+			AllowedProjects:      cfg.AllowedProjects,
 		}), nil
 
 	default:
 		// Default to OpenAI-compatible
 		return NewOpenAIProvider(OpenAIConfig{
-			Name:       cfg.Name,
-			APIKey:     cfg.APIKey,
-			BaseURL:    cfg.BaseURL,
-			Models:     cfg.Models,
-			Timeout:    cfg.Timeout,
-			MaxRetries: cfg.MaxRetries,
+			Name:             cfg.Name,
+			APIKey:           cfg.APIKey,
+			BaseURL:          cfg.BaseURL,
+			Models:           cfg.Models,
+			Timeout:          cfg.Timeout,
+			MaxRetries:       cfg.MaxRetries,
+			DisableStreaming: cfg.DisableStreaming,
+			DisableHTTP2:     cfg.DisableHTTP2,
+			ModelLimits:      cfg.ModelLimits,
+			ChatPath:         cfg.ChatPath,
+			RetryBudget:      r.retryBudget,
+			RequestIDHeader:  cfg.RequestIDHeader,
+			Organization:     cfg.Organization,
+			Project:          cfg.Project,
+
+			AllowedOrganizations: cfg.AllowedOrganizations,
+			AllowedProjects:      cfg.AllowedProjects,
 		}), nil
 	}
 }
 
+func newCostPolicy(cfg config.ProviderConfig) (costPolicy, error) {
+	switch cfg.CostModel {
+	case "", CostModelToken:
+		return costPolicy{model: CostModelToken}, nil
+	case CostModelFree:
+		return costPolicy{model: CostModelFree}, nil
+	case CostModelRequest:
+		if cfg.CostPerRequest < 0 {
+			return costPolicy{}, fmt.Errorf("costPerRequest must not be negative")
+		}
+		return costPolicy{model: CostModelRequest, perRequest: cfg.CostPerRequest}, nil
+	default:
+		return costPolicy{}, fmt.Errorf("unknown costModel %q", cfg.CostModel)
+	}
+}
+
+// CalculateCost returns the cost of a request served by the named provider,
+// honouring its configured cost model. Providers without one are priced per
+// token via ModelPricing.
+func (r *Registry) CalculateCost(providerName, model string, promptTokens, completionTokens int) float64 {
+	r.mu.RLock()
+	policy, ok := r.costs[providerName]
+	r.mu.RUnlock()
+
+	if !ok {
+		return CalculateCost(model, promptTokens, completionTokens)
+	}
+
+	switch policy.model {
+	case CostModelFree:
+		return 0
+	case CostModelRequest:
+		return policy.perRequest
+	default:
+		return CalculateCost(model, promptTokens, completionTokens)
+	}
+}
+
+// HasPricing reports whether the named provider can price model: always
+// for the free and per-request cost models, otherwise only when the model
+// is in ModelPricing. Unpriced models cost 0 in CalculateCost.
+func (r *Registry) HasPricing(providerName, model string) bool {
+	r.mu.RLock()
+	policy, ok := r.costs[providerName]
+	r.mu.RUnlock()
+
+	if ok && (policy.model == CostModelFree || policy.model == CostModelRequest) {
+		return true
+	}
+	return HasPricing(model)
+}
+
+// CheckParams applies the named provider's policy for optional params it
+// doesn't support: they are stripped from req, or an error is returned for
+// the client when the provider is configured to reject them
+func (r *Registry) CheckParams(providerName string, req *ChatCompletionRequest) error {
+	r.mu.RLock()
+	policy, ok := r.params[providerName]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil
+	}
+	return policy.apply(providerName, req)
+}
+
+// OwnedBy returns the owned_by value listed for the named provider's models:
+// its configured ownedBy, or the provider name
+func (r *Registry) OwnedBy(providerName string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if owner, ok := r.owners[providerName]; ok {
+		return owner
+	}
+	return providerName
+}
+
 // Get returns a provider by name
 func (r *Registry) Get(name string) (Provider, bool) {
 	r.mu.RLock()
@@ -100,21 +343,37 @@ func (r *Registry) Get(name string) (Provider, bool) {
 	return p, ok
 }
 
-// GetForModel returns the provider for a given model
+// GetForModel returns the provider for a given model. Disabled providers
+// are skipped; a model mapped to one is routed along the fallback chain.
 func (r *Registry) GetForModel(model string) (Provider, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
+	skipped := false
+
 	// Check model mapping first
-	if providerName, ok := r.modelMapping[model]; ok {
+	if providerName, ok := r.modelMapping[NormalizeModel(model)]; ok {
 		if provider, ok := r.providers[providerName]; ok {
-			return provider, nil
+			if !r.disabled[providerName] {
+				return provider, nil
+			}
+			skipped = true
+
+			for _, name := range r.fallbackChain {
+				if p, ok := r.providers[name]; ok && !r.disabled[name] && p.SupportsModel(model) {
+					return p, nil
+				}
+			}
 		}
 	}
 
 	// Check if any provider supports this model
-	for _, provider := range r.providers {
+	for name, provider := range r.providers {
 		if provider.SupportsModel(model) {
+			if r.disabled[name] {
+				skipped = true
+				continue
+			}
 			return provider, nil
 		}
 	}
@@ -122,45 +381,72 @@ func (r *Registry) GetForModel(model string) (Provider, error) {
 	// Fall back to default provider
 	if r.defaultProvider != "" {
 		if provider, ok := r.providers[r.defaultProvider]; ok {
-			return provider, nil
+			if !r.disabled[r.defaultProvider] {
+				return provider, nil
+			}
+			skipped = true
 		}
 	}
 
+	if skipped {
+		return nil, fmt.Errorf("%w: no enabled provider serves model %s", ErrProviderDisabled, model)
+	}
 	return nil, fmt.Errorf("no provider found for model: %s", model)
 }
 
-// GetWithFallback attempts providers in fallback order
-func (r *Registry) GetWithFallback(model string) []Provider {
+// SetDisabled switches a provider off or back on at runtime. Disabled
+// providers are skipped when routing and in fallback chains until enabled
+// again.
+func (r *Registry) SetDisabled(name string, disabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.providers[name]; !ok {
+		return fmt.Errorf("unknown provider: %s", name)
+	}
+	if disabled {
+		r.disabled[name] = true
+	} else {
+		delete(r.disabled, name)
+	}
+	return nil
+}
+
+// Disabled reports whether a provider has been disabled at runtime
+func (r *Registry) Disabled(name string) bool {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
+	return r.disabled[name]
+}
 
-	var providers []Provider
+// RetryBudget returns the retry budget shared by the providers, or nil when
+// retries are unlimited
+func (r *Registry) RetryBudget() *RetryBudget {
+	return r.retryBudget
+}
 
-	// First try the mapped provider
-	if providerName, ok := r.modelMapping[model]; ok {
-		if provider, ok := r.providers[providerName]; ok {
-			providers = append(providers, provider)
-		}
-	}
+// FallbackChain returns primary followed by the providers of the fallback
+// chain that can serve model, in order and without duplicates
+func (r *Registry) FallbackChain(primary Provider, model string) []Provider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	// Then add fallback chain
+	chain := []Provider{primary}
+	seen := map[string]bool{primary.Name(): true}
 	for _, name := range r.fallbackChain {
-		if provider, ok := r.providers[name]; ok {
-			// Avoid duplicates
-			duplicate := false
-			for _, p := range providers {
-				if p.Name() == provider.Name() {
-					duplicate = true
-					break
-				}
-			}
-			if !duplicate {
-				providers = append(providers, provider)
-			}
+		if p, ok := r.providers[name]; ok && !seen[name] && !r.disabled[name] && p.SupportsModel(model) {
+			chain = append(chain, p)
+			seen[name] = true
 		}
 	}
+	return chain
+}
 
-	return providers
+// ShouldFallback reports whether a provider error should move the request
+// on to the next provider in its fallback chain, per routing.fallbackOn,
+// and why
+func (r *Registry) ShouldFallback(err error) (bool, string) {
+	return r.fallback.decide(err)
 }
 
 // List returns all registered providers
@@ -178,32 +464,68 @@ func (r *Registry) List() []Provider {
 // HealthCheckAll checks all providers
 func (r *Registry) HealthCheckAll(ctx context.Context) map[string]error {
 	r.mu.RLock()
-	defer r.mu.RUnlock()
+	checks := make(map[string]func() error, len(r.providers))
+	for name, p := range r.providers {
+		p := p
+		checks[name] = func() error { return p.HealthCheck(ctx) }
+	}
+	r.mu.RUnlock()
+
+	return r.fanOut(ctx, checks)
+}
 
-	results := make(map[string]error)
+// fanOut runs each call concurrently, at most r.concurrency at a time when
+// set, and collects their results by name. Calls still waiting for a slot
+// when ctx is done report ctx's error.
+func (r *Registry) fanOut(ctx context.Context, calls map[string]func() error) map[string]error {
+	var sem chan struct{}
+	if r.concurrency > 0 {
+		sem = make(chan struct{}, r.concurrency)
+	}
+
+	results := make(map[string]error, len(calls))
+	var mu sync.Mutex
 	var wg sync.WaitGroup
 
-	for name, provider := range r.providers {
+	for name, call := range calls {
 		wg.Add(1)
-		go func(name string, p Provider) {
+		go func(name string, call func() error) {
 			defer wg.Done()
-			results[name] = p.HealthCheck(ctx)
-		}(name, provider)
+
+			var err error
+			if sem == nil {
+				err = call()
+			} else {
+				select {
+				case sem <- struct{}{}:
+					err = call()
+					<-sem
+				case <-ctx.Done():
+					err = ctx.Err()
+				}
+			}
+
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}(name, call)
 	}
 
 	wg.Wait()
 	return results
 }
 
-// ResolveModel resolves model aliases to actual model names
-func (r *Registry) ResolveModel(model string, cfg *config.Config) (string, string) {
-	if mapping, ok := cfg.Routing.ModelMappings[model]; ok {
-		return mapping.Provider, mapping.Model
-	}
-
-	if providerName, ok := r.modelMapping[model]; ok {
-		return providerName, model
+// WarmupAll opens a connection to every provider that supports it,
+// concurrently. Results are keyed by provider name.
+func (r *Registry) WarmupAll(ctx context.Context) map[string]error {
+	r.mu.RLock()
+	warmups := make(map[string]func() error, len(r.providers))
+	for name, p := range r.providers {
+		if w, ok := p.(Warmer); ok {
+			warmups[name] = func() error { return w.Warmup(ctx) }
+		}
 	}
+	r.mu.RUnlock()
 
-	return r.defaultProvider, model
+	return r.fanOut(ctx, warmups)
 }
@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// upstreamRequestIDHeaders are where providers return their own id for a
+// request: OpenAI and most compatible backends use x-request-id, Anthropic
+// uses request-id
+var upstreamRequestIDHeaders = []string{"X-Request-Id", "Request-Id"}
+
+type requestIDKey struct{}
+
+// requestIDs carries the gateway's request id to the provider and the
+// provider's id for the request back
+type requestIDs struct {
+	id string
+
+	mu       sync.Mutex
+	upstream string
+}
+
+// WithRequestID returns a context whose provider requests forward id in
+// each provider's requestIdHeader and record the id the provider returns.
+// Use a fresh context per provider attempt so a fallback doesn't report
+// the previous provider's id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, &requestIDs{id: id})
+}
+
+// RequestID returns the gateway request id set with WithRequestID
+func RequestID(ctx context.Context) string {
+	if ids, ok := ctx.Value(requestIDKey{}).(*requestIDs); ok {
+		return ids.id
+	}
+	return ""
+}
+
+// UpstreamRequestID returns the provider's id for the last request made
+// with ctx, or "" if it returned none. With retries, the last attempt wins.
+func UpstreamRequestID(ctx context.Context) string {
+	ids, ok := ctx.Value(requestIDKey{}).(*requestIDs)
+	if !ok {
+		return ""
+	}
+	ids.mu.Lock()
+	defer ids.mu.Unlock()
+	return ids.upstream
+}
+
+// setRequestIDHeader forwards the gateway request id under header; an empty
+// header name forwards nothing
+func setRequestIDHeader(req *http.Request, header string) {
+	if header == "" {
+		return
+	}
+	if id := RequestID(req.Context()); id != "" {
+		req.Header.Set(header, id)
+	}
+}
+
+// recordUpstreamRequestID keeps the provider's request id from a response
+func recordUpstreamRequestID(ctx context.Context, header http.Header) {
+	ids, ok := ctx.Value(requestIDKey{}).(*requestIDs)
+	if !ok {
+		return
+	}
+	for _, name := range upstreamRequestIDHeaders {
+		if v := header.Get(name); v != "" {
+			ids.mu.Lock()
+			ids.upstream = v
+			ids.mu.Unlock()
+			return
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStreamsForwardRequestID(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("X-Gateway-Request-Id")
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Request-Id", "upstream-1")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	providers := []Provider{
+		NewOpenAIProvider(OpenAIConfig{Name: "openai", APIKey: "k", BaseURL: srv.URL, RequestIDHeader: "X-Gateway-Request-Id"}),
+		NewAnthropicProvider(AnthropicConfig{Name: "anthropic", APIKey: "k", BaseURL: srv.URL, RequestIDHeader: "X-Gateway-Request-Id"}),
+	}
+	for _, p := range providers {
+		got = ""
+		ctx := WithRequestID(context.Background(), "req-1")
+		stream, err := p.ChatCompletionStream(ctx, &ChatCompletionRequest{
+			Model:    "m",
+			Messages: []Message{{Role: "user", Content: "hi"}},
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", p.Name(), err)
+		}
+		io.Copy(io.Discard, stream)
+		stream.Close()
+
+		if got != "req-1" {
+			t.Errorf("%s: upstream got request id %q, want req-1", p.Name(), got)
+		}
+		if id := UpstreamRequestID(ctx); id != "upstream-1" {
+			t.Errorf("%s: recorded upstream request id %q, want upstream-1", p.Name(), id)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package provider
+
+import "sync"
+
+// RetryBudget is a token bucket shared by every provider that caps retries
+// to a fraction of requests. Each first attempt deposits Ratio tokens, up to
+// MaxTokens, and each retry spends one. When an upstream browns out and
+// every request fails, retries stop once the bucket is empty instead of
+// multiplying the load on it. A nil budget allows every retry.
+type RetryBudget struct {
+	mu        sync.Mutex
+	ratio     float64
+	maxTokens float64
+	tokens    float64
+
+	retries int64 // retries the budget allowed
+	denied  int64 // retries skipped because the budget was empty
+}
+
+// RetryBudgetStats is a snapshot of a retry budget for metrics
+type RetryBudgetStats struct {
+	Tokens    float64
+	MaxTokens float64
+	Retries   int64
+	Denied    int64
+}
+
+// NewRetryBudget creates a full budget that earns ratio retries per request
+// and holds at most maxTokens
+func NewRetryBudget(ratio float64, maxTokens int) *RetryBudget {
+	return &RetryBudget{
+		ratio:     ratio,
+		maxTokens: float64(maxTokens),
+		tokens:    float64(maxTokens),
+	}
+}
+
+// deposit credits the budget for a request's first attempt
+func (b *RetryBudget) deposit() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += b.ratio
+	if b.tokens > b.maxTokens {
+		b.tokens = b.maxTokens
+	}
+}
+
+// withdraw spends one token for a retry, reporting false when the budget
+// has none left
+func (b *RetryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < 1 {
+		b.denied++
+		return false
+	}
+	b.tokens--
+	b.retries++
+	return true
+}
+
+// Stats snapshots the budget
+func (b *RetryBudget) Stats() RetryBudgetStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return RetryBudgetStats{
+		Tokens:    b.tokens,
+		MaxTokens: b.maxTokens,
+		Retries:   b.retries,
+		Denied:    b.denied,
+	}
+}
@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// bufferedStream re-emits a complete response as an OpenAI-style SSE stream.
+// It backs providers that can't stream natively, so clients asking for
+// stream:true still get the chunked format they expect. A final chunk
+// always carries the usage, as OpenAI sends for stream_options; the gateway
+// drops it for clients that didn't ask.
+func bufferedStream(resp *ChatCompletionResponse) (io.ReadCloser, error) {
+	var buf bytes.Buffer
+
+	writeChunk := func(choices []ChunkChoice, usage *Usage) error {
+		data, err := json.Marshal(ChatCompletionChunk{
+			ID:                resp.ID,
+			Object:            "chat.completion.chunk",
+			Created:           resp.Created,
+			Model:             resp.Model,
+			Choices:           choices,
+			SystemFingerprint: resp.SystemFingerprint,
+			Usage:             usage,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal chunk: %w", err)
+		}
+		fmt.Fprintf(&buf, "data: %s\n\n", data)
+		return nil
+	}
+
+	for _, choice := range resp.Choices {
+		if err := writeChunk([]ChunkChoice{{
+			Index: choice.Index,
+			Delta: ChunkDelta{
+				Role:    choice.Message.Role,
+				Content: choice.Message.Content,
+			},
+		}}, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, choice := range resp.Choices {
+		finishReason := choice.FinishReason
+		if err := writeChunk([]ChunkChoice{{
+			Index:        choice.Index,
+			FinishReason: &finishReason,
+		}}, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	usage := resp.Usage
+	if err := writeChunk([]ChunkChoice{}, &usage); err != nil {
+		return nil, err
+	}
+
+	buf.WriteString("data: [DONE]\n\n")
+
+	return io.NopCloser(&buf), nil
+}
@@ -0,0 +1,96 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing is the connection breakdown of an upstream request. Phases that
+// didn't happen, such as DNS and connect on a reused connection, are zero.
+type Timing struct {
+	DNSMs       float64 `json:"dns_ms"`
+	ConnectMs   float64 `json:"connect_ms"`
+	TLSMs       float64 `json:"tls_ms"`
+	FirstByteMs float64 `json:"first_byte_ms"` // from sending the request to the first response byte
+	ConnReused  bool    `json:"conn_reused"`
+}
+
+// TimingTrace records a Timing for the HTTP requests made with its context.
+// With retries, the last attempt wins.
+type TimingTrace struct {
+	mu     sync.Mutex
+	timing Timing
+
+	dnsStart, connectStart, tlsStart, wroteRequest time.Time
+}
+
+// WithTimingTrace returns a context whose provider HTTP calls are traced
+// into the returned TimingTrace
+func WithTimingTrace(ctx context.Context) (context.Context, *TimingTrace) {
+	t := &TimingTrace{}
+	trace := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			t.mu.Lock()
+			t.timing = Timing{}
+			t.dnsStart, t.connectStart, t.tlsStart, t.wroteRequest = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+			t.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.timing.ConnReused = info.Reused
+			t.mu.Unlock()
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.start(&t.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.done(&t.dnsStart, &t.timing.DNSMs)
+		},
+		ConnectStart: func(string, string) {
+			t.start(&t.connectStart)
+		},
+		ConnectDone: func(string, string, error) {
+			t.done(&t.connectStart, &t.timing.ConnectMs)
+		},
+		TLSHandshakeStart: func() {
+			t.start(&t.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.done(&t.tlsStart, &t.timing.TLSMs)
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.start(&t.wroteRequest)
+		},
+		GotFirstResponseByte: func() {
+			t.done(&t.wroteRequest, &t.timing.FirstByteMs)
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), t
+}
+
+// Timing returns the recorded breakdown
+func (t *TimingTrace) Timing() *Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timing := t.timing
+	return &timing
+}
+
+func (t *TimingTrace) start(at *time.Time) {
+	t.mu.Lock()
+	*at = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *TimingTrace) done(start *time.Time, ms *float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !start.IsZero() {
+		*ms = float64(time.Since(*start).Microseconds()) / 1000
+	}
+}
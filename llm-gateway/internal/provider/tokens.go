@@ -0,0 +1,18 @@
+package provider
+
+import "unicode/utf8"
+
+// TokenCounter estimates how many tokens a model would count for text. It
+// is used to approximate usage when a provider doesn't report it.
+type TokenCounter func(model, text string) int
+
+// EstimateTokens is the default TokenCounter. It assumes about four
+// characters per token, which is close for English text on GPT and Claude
+// tokenizers but can be well off for code or other languages.
+func EstimateTokens(model, text string) int {
+	n := utf8.RuneCountInString(text)
+	if n == 0 {
+		return 0
+	}
+	return (n + 3) / 4
+}
@@ -2,7 +2,10 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
+	"net/http"
 	"time"
 )
 
@@ -14,14 +17,66 @@ type ChatCompletionRequest struct {
 	TopP             *float64       `json:"top_p,omitempty"`
 	N                *int           `json:"n,omitempty"`
 	Stream           bool           `json:"stream,omitempty"`
-	Stop             []string       `json:"stop,omitempty"`
+	Stop             StopSequences  `json:"stop,omitempty"`
 	MaxTokens        *int           `json:"max_tokens,omitempty"`
+	// MaxCompletionTokens replaces max_tokens on newer OpenAI models; the
+	// OpenAI provider sends whichever field the target model expects
+	MaxCompletionTokens *int `json:"max_completion_tokens,omitempty"`
 	PresencePenalty  *float64       `json:"presence_penalty,omitempty"`
 	FrequencyPenalty *float64       `json:"frequency_penalty,omitempty"`
 	User             string         `json:"user,omitempty"`
+	Logprobs         *bool          `json:"logprobs,omitempty"`
+	TopLogprobs      *int           `json:"top_logprobs,omitempty"`
+	StreamOptions    *StreamOptions `json:"stream_options,omitempty"`
+	// ResponseFormat requests JSON output (JSON mode)
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+
+	// ExtraParams are provider-specific body params (e.g. top_k,
+	// repetition_penalty) merged into the upstream request as-is
+	ExtraParams map[string]json.RawMessage `json:"extra_params,omitempty"`
 
 	// Gateway extensions
 	XGateway *GatewayExtensions `json:"x-gateway,omitempty"`
+
+	// EndUser keeps the client's user field for usage attribution, since
+	// User itself is stripped for providers that don't accept it
+	EndUser string `json:"-"`
+}
+
+type StreamOptions struct {
+	// IncludeUsage asks for a final chunk carrying token usage
+	IncludeUsage bool `json:"include_usage,omitempty"`
+}
+
+// StopSequences is the stop param, which clients may send as a single
+// string or an array of strings. It always holds a slice and marshals as an
+// array, which every OpenAI-compatible backend accepts.
+type StopSequences []string
+
+func (s *StopSequences) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		if one == "" {
+			*s = nil
+		} else {
+			*s = StopSequences{one}
+		}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return errors.New("stop must be a string or an array of strings")
+	}
+	*s = many
+	return nil
+}
+
+// ResponseFormat asks for JSON output: "json_object", or "json_schema"
+// with the schema in JSONSchema
+type ResponseFormat struct {
+	Type       string          `json:"type"`
+	JSONSchema json.RawMessage `json:"json_schema,omitempty"`
 }
 
 type GatewayExtensions struct {
@@ -29,12 +84,20 @@ type GatewayExtensions struct {
 	Timeout  *int              `json:"timeout,omitempty"`
 	Provider string            `json:"provider,omitempty"`
 	Metadata map[string]string `json:"metadata,omitempty"`
+	// PromptCache overrides the provider's prompt caching setting
+	PromptCache *bool `json:"prompt_cache,omitempty"`
+	// HeartbeatInterval overrides server.streamHeartbeat for this request's
+	// stream, in seconds; 0 turns heartbeats off
+	HeartbeatInterval *int `json:"heartbeat_interval,omitempty"`
 }
 
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
 	Name    string `json:"name,omitempty"`
+	// ReasoningContent is a reasoning model's thinking, kept apart from
+	// the answer in Content
+	ReasoningContent string `json:"reasoning_content,omitempty"`
 }
 
 // ChatCompletionResponse represents the OpenAI-compatible response format
@@ -46,6 +109,9 @@ type ChatCompletionResponse struct {
 	Choices           []Choice `json:"choices"`
 	Usage             Usage    `json:"usage"`
 	SystemFingerprint string   `json:"system_fingerprint,omitempty"`
+
+	// RateLimits holds upstream rate-limit headers for relaying to the client
+	RateLimits http.Header `json:"-"`
 }
 
 type Choice struct {
@@ -60,6 +126,12 @@ type Logprobs struct {
 }
 
 type LogprobContent struct {
+	Token       string       `json:"token"`
+	Logprob     float64      `json:"logprob"`
+	TopLogprobs []TopLogprob `json:"top_logprobs,omitempty"`
+}
+
+type TopLogprob struct {
 	Token   string  `json:"token"`
 	Logprob float64 `json:"logprob"`
 }
@@ -68,6 +140,11 @@ type Usage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+
+	// Prompt cache activity, reported by Anthropic. Cached tokens are not
+	// included in PromptTokens.
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
 }
 
 // ChatCompletionChunk for streaming responses
@@ -78,6 +155,7 @@ type ChatCompletionChunk struct {
 	Model             string        `json:"model"`
 	Choices           []ChunkChoice `json:"choices"`
 	SystemFingerprint string        `json:"system_fingerprint,omitempty"`
+	Usage             *Usage        `json:"usage,omitempty"`
 }
 
 type ChunkChoice struct {
@@ -87,8 +165,36 @@ type ChunkChoice struct {
 }
 
 type ChunkDelta struct {
-	Role    string `json:"role,omitempty"`
-	Content string `json:"content,omitempty"`
+	Role      string          `json:"role,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	ToolCalls []ToolCallDelta `json:"tool_calls,omitempty"`
+	// ReasoningContent is streamed thinking, as in Message
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+}
+
+// ToolCallDelta is a fragment of a streamed tool call. The first fragment
+// for an Index carries its ID, type and function name; later ones append to
+// the function arguments.
+type ToolCallDelta struct {
+	Index    int                `json:"index"`
+	ID       string             `json:"id,omitempty"`
+	Type     string             `json:"type,omitempty"`
+	Function *FunctionCallDelta `json:"function,omitempty"`
+}
+
+type FunctionCallDelta struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// IncludeUsage reports whether a streaming request asked for a usage chunk
+func (r *ChatCompletionRequest) IncludeUsage() bool {
+	return r.StreamOptions != nil && r.StreamOptions.IncludeUsage
+}
+
+// JSONMode reports whether the request asked for JSON output
+func (r *ChatCompletionRequest) JSONMode() bool {
+	return r.ResponseFormat != nil && (r.ResponseFormat.Type == "json_object" || r.ResponseFormat.Type == "json_schema")
 }
 
 // Provider interface that all LLM providers must implement
@@ -119,11 +225,28 @@ type ProviderMetrics struct {
 	PromptTokens     int
 	CompletionTokens int
 	TotalTokens      int
+	CacheWriteTokens int // prompt tokens written to the provider's cache
+	CacheReadTokens  int // prompt tokens served from the provider's cache
 	LatencyMs        int64
 	Cost             float64
 	Cached           bool
 	Success          bool
+	Estimated        bool // token counts are estimates, not provider-reported
+	InvalidJSON      bool // JSON-mode response content didn't parse (a soft failure)
 	Timestamp        time.Time
+	Metadata         map[string]string
+	User             string  // the request's user field, for per-user usage
+	Timing           *Timing // upstream connection breakdown, with metrics.upstreamTiming
+
+	// RequestID is the gateway's request id and UpstreamRequestID the
+	// provider's, for correlating with upstream support
+	RequestID         string
+	UpstreamRequestID string
+
+	// StrippedReasoningTokens estimates the reasoning removed from the
+	// response by routing.reasoningTransforms; it is still billed in
+	// CompletionTokens
+	StrippedReasoningTokens int
 }
 
 // Error types
@@ -155,9 +278,23 @@ var ModelPricing = map[string]struct {
 	"claude-3-5-sonnet": {0.003, 0.015},
 }
 
+// HasPricing reports whether ModelPricing covers model
+func HasPricing(model string) bool {
+	_, ok := lookupPricing(model)
+	return ok
+}
+
+func lookupPricing(model string) (struct{ Input, Output float64 }, bool) {
+	pricing, ok := ModelPricing[model]
+	if !ok {
+		pricing, ok = ModelPricing[NormalizeModel(model)]
+	}
+	return pricing, ok
+}
+
 // CalculateCost calculates the cost for a completion
 func CalculateCost(model string, promptTokens, completionTokens int) float64 {
-	pricing, ok := ModelPricing[model]
+	pricing, ok := lookupPricing(model)
 	if !ok {
 		return 0
 	}
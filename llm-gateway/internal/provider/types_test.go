@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestStopSequencesUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    StopSequences
+		wantErr bool
+	}{
+		{name: "string", json: `"x"`, want: StopSequences{"x"}},
+		{name: "array", json: `["a","b"]`, want: StopSequences{"a", "b"}},
+		{name: "null", json: `null`, want: nil},
+		{name: "empty string", json: `""`, want: nil},
+		{name: "number", json: `123`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got StopSequences
+			err := json.Unmarshal([]byte(tt.json), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnthropicStopSequencesRoundTrip(t *testing.T) {
+	p := NewAnthropicProvider(AnthropicConfig{Name: "anthropic"})
+
+	tests := []struct {
+		stop string
+		want []string
+	}{
+		{stop: `"x"`, want: []string{"x"}},
+		{stop: `["a","b"]`, want: []string{"a", "b"}},
+		{stop: `null`, want: nil},
+		{stop: `""`, want: nil},
+	}
+	for _, tt := range tests {
+		var req ChatCompletionRequest
+		body := `{"model":"claude-3-haiku","messages":[{"role":"user","content":"hi"}],"stop":` + tt.stop + `}`
+		if err := json.Unmarshal([]byte(body), &req); err != nil {
+			t.Fatalf("stop %s: %v", tt.stop, err)
+		}
+
+		data, err := json.Marshal(p.convertRequest(&req))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sent struct {
+			StopSequences []string `json:"stop_sequences"`
+		}
+		json.Unmarshal(data, &sent)
+		if !reflect.DeepEqual(sent.StopSequences, tt.want) {
+			t.Errorf("stop %s: sent stop_sequences %#v, want %#v", tt.stop, sent.StopSequences, tt.want)
+		}
+	}
+}
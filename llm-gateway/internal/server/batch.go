@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/yourorg/llm-gateway/internal/middleware"
+)
+
+// batchRequest is the body of POST /v1/chat/completions/batch
+type batchRequest struct {
+	Requests []json.RawMessage `json:"requests"`
+}
+
+// batchResponse holds one item per request, in request order
+type batchResponse struct {
+	Responses []batchItem `json:"responses"`
+}
+
+// batchItem is one request's outcome: Response on success, Error otherwise
+type batchItem struct {
+	Index    int             `json:"index"`
+	Status   int             `json:"status"`
+	Cached   bool            `json:"cached,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    json.RawMessage `json:"error,omitempty"`
+}
+
+// handleChatCompletionBatch runs several chat completions from one call,
+// at most server.batch.concurrency at a time. Each request is served exactly
+// as if it were sent to /v1/chat/completions on its own, so routing,
+// fallback, caching and metrics all apply, and one failing doesn't fail the
+// others.
+func (s *Server) handleChatCompletionBatch(w http.ResponseWriter, r *http.Request) {
+	var batch batchRequest
+	if err := s.decodeRequest(r, &batch); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	if len(batch.Requests) == 0 {
+		s.writeError(w, http.StatusBadRequest, "invalid_request_error", "field \"requests\" is required and must not be empty")
+		return
+	}
+	if limit := s.cfg.Server.Batch.MaxRequests; limit > 0 && len(batch.Requests) > limit {
+		s.writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("a batch may hold at most %d requests, got %d", limit, len(batch.Requests)))
+		return
+	}
+
+	// The rate limiter let the call through as one request; the rest of
+	// the batch counts too, all or nothing
+	if !middleware.ChargeRateLimit(r, len(batch.Requests)-1) {
+		w.Header().Set("Retry-After", "60")
+		s.writeError(w, http.StatusTooManyRequests, "rate_limit_error", fmt.Sprintf("a batch of %d requests exceeds the rate limit", len(batch.Requests)))
+		return
+	}
+
+	concurrency := s.cfg.Server.Batch.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	items := make([]batchItem, len(batch.Requests))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, body := range batch.Requests {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, body json.RawMessage) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			// The router's panic recovery doesn't reach these goroutines
+			defer func() {
+				if p := recover(); p != nil {
+					s.logger.Error().Interface("panic", p).Int("index", i).Msg("Batch request panicked")
+					rec := newBufferedResponse()
+					s.writeError(rec, http.StatusInternalServerError, "internal_error", "internal error")
+					items[i] = rec.item(i)
+				}
+			}()
+			items[i] = s.serveBatchItem(r, i, body)
+		}(i, body)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batchResponse{Responses: items})
+}
+
+// serveBatchItem runs one batch request through the chat completion handler
+// and captures what it wrote
+func (s *Server) serveBatchItem(r *http.Request, index int, body json.RawMessage) batchItem {
+	var probe struct {
+		Stream bool `json:"stream"`
+	}
+	if json.Unmarshal(body, &probe) == nil && probe.Stream {
+		rec := newBufferedResponse()
+		s.writeError(rec, http.StatusBadRequest, "invalid_request_error", "streaming is not supported in a batch")
+		return rec.item(index)
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		rec := newBufferedResponse()
+		s.writeError(rec, http.StatusInternalServerError, "internal_error", err.Error())
+		return rec.item(index)
+	}
+	req.Header = r.Header.Clone()
+	req.RemoteAddr = r.RemoteAddr
+
+	rec := newBufferedResponse()
+	s.handleChatCompletion(rec, req)
+	return rec.item(index)
+}
+
+// bufferedResponse is an http.ResponseWriter that keeps a response in
+// memory, for batch items and for completions reshaped after the fact
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header)}
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// item converts the captured response into a batch item, unwrapping the
+// error object of a failed request
+func (b *bufferedResponse) item(index int) batchItem {
+	body := bytes.TrimSpace(b.body.Bytes())
+	item := batchItem{Index: index, Status: b.status}
+	if item.Status < http.StatusBadRequest && json.Valid(body) {
+		item.Response = body
+		item.Cached = b.header.Get("X-Cache") == "HIT"
+		return item
+	}
+
+	if item.Status < http.StatusBadRequest {
+		item.Status = http.StatusInternalServerError
+	}
+	var failed struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &failed); err != nil || failed.Error == nil {
+		failed.Error, _ = json.Marshal(map[string]interface{}{
+			"message": string(body),
+			"type":    "provider_error",
+			"code":    item.Status,
+		})
+	}
+	item.Error = failed.Error
+	return item
+}
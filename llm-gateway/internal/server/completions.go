@@ -0,0 +1,156 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/yourorg/llm-gateway/internal/provider"
+)
+
+// completionRequest is the legacy OpenAI /v1/completions request format
+type completionRequest struct {
+	Model            string                 `json:"model"`
+	Prompt           json.RawMessage        `json:"prompt"`
+	MaxTokens        *int                   `json:"max_tokens,omitempty"`
+	Temperature      *float64               `json:"temperature,omitempty"`
+	TopP             *float64               `json:"top_p,omitempty"`
+	N                *int                   `json:"n,omitempty"`
+	Stream           bool                   `json:"stream,omitempty"`
+	Stop             provider.StopSequences `json:"stop,omitempty"`
+	PresencePenalty  *float64               `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64               `json:"frequency_penalty,omitempty"`
+	User             string                 `json:"user,omitempty"`
+
+	// Gateway extensions
+	XGateway *provider.GatewayExtensions `json:"x-gateway,omitempty"`
+}
+
+// completionResponse is the legacy OpenAI /v1/completions response format
+type completionResponse struct {
+	ID      string             `json:"id"`
+	Object  string             `json:"object"`
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []completionChoice `json:"choices"`
+	Usage   provider.Usage     `json:"usage"`
+}
+
+type completionChoice struct {
+	Text         string `json:"text"`
+	Index        int    `json:"index"`
+	FinishReason string `json:"finish_reason"`
+}
+
+// handleCompletion serves a legacy completion as a chat completion of its
+// prompt, so validation, fallback, caching and metrics all apply, then
+// reshapes the answer
+func (s *Server) handleCompletion(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	s.metrics.RequestStarted()
+	defer s.metrics.RequestFinished()
+
+	// Parse request
+	var req completionRequest
+	if err := s.decodeRequest(r, &req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	prompt, err := parsePrompt(req.Prompt)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	if req.Stream {
+		s.writeError(w, http.StatusBadRequest, "invalid_request_error", "streaming is not supported on /v1/completions, use /v1/chat/completions")
+		return
+	}
+
+	chatReq := &provider.ChatCompletionRequest{
+		Model:            req.Model,
+		Messages:         []provider.Message{{Role: "user", Content: prompt}},
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		N:                req.N,
+		Stop:             req.Stop,
+		MaxTokens:        req.MaxTokens,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		User:             req.User,
+		XGateway:         req.XGateway,
+	}
+
+	rec := newBufferedResponse()
+	s.serveChatRequest(rec, r, chatReq, startTime)
+
+	for name, values := range rec.header {
+		w.Header()[name] = values
+	}
+	if rec.status != http.StatusOK {
+		// Errors are already in the shape both endpoints share
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+		return
+	}
+
+	var chatResp provider.ChatCompletionResponse
+	if err := json.Unmarshal(rec.body.Bytes(), &chatResp); err != nil {
+		s.writeError(w, http.StatusInternalServerError, "marshal_error", err.Error())
+		return
+	}
+
+	respBytes, err := json.Marshal(toCompletionResponse(&chatResp))
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "marshal_error", err.Error())
+		return
+	}
+
+	w.Write(respBytes)
+}
+
+// parsePrompt accepts a prompt given either as a string or as an array
+// holding a single string
+func parsePrompt(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", fmt.Errorf("prompt is required")
+	}
+
+	var prompt string
+	if err := json.Unmarshal(raw, &prompt); err == nil {
+		return prompt, nil
+	}
+
+	var prompts []string
+	if err := json.Unmarshal(raw, &prompts); err != nil {
+		return "", fmt.Errorf("prompt must be a string or an array of strings")
+	}
+	if len(prompts) != 1 {
+		return "", fmt.Errorf("exactly one prompt is supported, got %d", len(prompts))
+	}
+
+	return prompts[0], nil
+}
+
+func toCompletionResponse(resp *provider.ChatCompletionResponse) *completionResponse {
+	choices := make([]completionChoice, 0, len(resp.Choices))
+	for _, c := range resp.Choices {
+		choices = append(choices, completionChoice{
+			Text:         c.Message.Content,
+			Index:        c.Index,
+			FinishReason: c.FinishReason,
+		})
+	}
+
+	return &completionResponse{
+		ID:      resp.ID,
+		Object:  "text_completion",
+		Created: resp.Created,
+		Model:   resp.Model,
+		Choices: choices,
+		Usage:   resp.Usage,
+	}
+}
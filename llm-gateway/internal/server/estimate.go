@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/yourorg/llm-gateway/internal/provider"
+)
+
+// estimateResponse is the pre-flight cost estimate for a chat request.
+// Output cost is only projected when the request sets an output limit,
+// and costs are 0 when the model has no known pricing.
+type estimateResponse struct {
+	Model               string   `json:"model"`
+	Provider            string   `json:"provider"`
+	PromptTokens        int      `json:"prompt_tokens"`
+	MaxCompletionTokens *int     `json:"max_completion_tokens,omitempty"`
+	InputCostUSD        float64  `json:"input_cost_usd"`
+	OutputCostUSD       *float64 `json:"output_cost_usd,omitempty"`
+	TotalCostUSD        float64  `json:"total_cost_usd"`
+	PricingKnown        bool     `json:"pricing_known"`
+}
+
+// handleEstimate estimates the tokens and cost of a chat completion request
+// without sending it. Prompt tokens come from the server's token counter,
+// and the provider is picked the same way as for /v1/chat/completions.
+func (s *Server) handleEstimate(w http.ResponseWriter, r *http.Request) {
+	var req provider.ChatCompletionRequest
+	if err := s.decodeRequest(r, &req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid request body", err.Error())
+		return
+	}
+
+	if err := validateChatRequest(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	if !s.modelAllowed(req.Model) {
+		s.writeError(w, http.StatusForbidden, "permission_error", fmt.Sprintf("model %q is not allowed on this gateway", req.Model))
+		return
+	}
+
+	// Count the prompt as it would be sent, system prefix included
+	s.applySystemPrefix(&req)
+
+	prov, err := s.registry.GetForModel(req.Model)
+	if err != nil {
+		s.writeNoProvider(w, err)
+		return
+	}
+
+	resp := estimateResponse{
+		Model:        req.Model,
+		Provider:     prov.Name(),
+		PromptTokens: s.tokenCounter(req.Model, promptText(&req)),
+	}
+	resp.PricingKnown = s.registry.HasPricing(prov.Name(), req.Model)
+
+	// Price the prompt alone first so flat per-request costs aren't counted
+	// twice when the output is projected
+	resp.InputCostUSD = s.registry.CalculateCost(prov.Name(), req.Model, resp.PromptTokens, 0)
+	resp.TotalCostUSD = resp.InputCostUSD
+
+	maxTokens := req.MaxCompletionTokens
+	if maxTokens == nil {
+		maxTokens = req.MaxTokens
+	}
+	if maxTokens != nil {
+		resp.MaxCompletionTokens = maxTokens
+		resp.TotalCostUSD = s.registry.CalculateCost(prov.Name(), req.Model, resp.PromptTokens, *maxTokens)
+		outputCost := resp.TotalCostUSD - resp.InputCostUSD
+		resp.OutputCostUSD = &outputCost
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// startGRPCHealth serves the standard grpc.health.v1 service so Kubernetes
+// gRPC probes can check the gateway. It reports SERVING for the overall
+// server ("") until shutdown begins.
+func (s *Server) startGRPCHealth() error {
+	addr := fmt.Sprintf("%s:%d", s.cfg.Server.Host, s.cfg.Server.GRPCHealth.Port)
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for gRPC health on %s: %w", addr, err)
+	}
+
+	s.health = health.NewServer()
+	s.grpcServer = grpc.NewServer()
+	healthpb.RegisterHealthServer(s.grpcServer, s.health)
+
+	go func() {
+		if err := s.grpcServer.Serve(lis); err != nil {
+			s.logger.Error().Err(err).Msg("gRPC health server failed")
+		}
+	}()
+
+	s.logger.Info().
+		Str("addr", addr).
+		Msg("Serving gRPC health")
+
+	return nil
+}
+
+// stopGRPCHealth flips the health status to NOT_SERVING so probes fail
+// while the HTTP server drains, then stops the gRPC server
+func (s *Server) stopGRPCHealth() {
+	if s.grpcServer == nil {
+		return
+	}
+
+	s.health.Shutdown()
+	s.grpcServer.GracefulStop()
+}
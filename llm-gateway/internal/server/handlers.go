@@ -1,13 +1,22 @@
 package server
 
 import (
-	"bufio"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
 
 	"github.com/yourorg/llm-gateway/internal/provider"
 )
@@ -15,99 +24,354 @@ import (
 func (s *Server) handleChatCompletion(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
 
+	s.metrics.RequestStarted()
+	defer s.metrics.RequestFinished()
+
 	// Parse request
 	var req provider.ChatCompletionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := s.decodeRequest(r, &req); err != nil {
 		s.writeError(w, http.StatusBadRequest, "invalid request body", err.Error())
 		return
 	}
 
+	s.serveChatRequest(w, r, &req, startTime)
+}
+
+// serveChatRequest validates a decoded chat completion request and serves
+// it through the provider's fallback chain. /v1/completions comes through
+// here too, once it has turned its prompt into a message.
+func (s *Server) serveChatRequest(w http.ResponseWriter, r *http.Request, req *provider.ChatCompletionRequest, startTime time.Time) {
+	if err := validateChatRequest(req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	if !s.modelAllowed(req.Model) {
+		s.writeError(w, http.StatusForbidden, "permission_error", fmt.Sprintf("model %q is not allowed on this gateway", req.Model))
+		return
+	}
+
+	s.applySystemPrefix(req)
+	dropRequestReasoning(req)
+	req.EndUser = req.User
+
 	// Get provider for model
 	prov, err := s.registry.GetForModel(req.Model)
 	if err != nil {
-		s.writeError(w, http.StatusBadRequest, "model not found", err.Error())
+		s.writeNoProvider(w, err)
 		return
 	}
 
-	// Check cache (only for non-streaming)
-	if !req.Stream && s.cache != nil && (req.XGateway == nil || req.XGateway.Cache == nil || *req.XGateway.Cache) {
-		cacheKey := s.generateCacheKey(&req)
-		if cached, ok := s.cache.Get(cacheKey); ok {
-			s.metrics.RecordCacheHit()
-			w.Header().Set("Content-Type", "application/json")
-			w.Header().Set("X-Cache", "HIT")
-			w.Write(cached)
+	// Try the fallback chain in order until a provider answers or fails
+	// with an error that isn't a fallback condition
+	chain := s.registry.FallbackChain(prov, req.Model)
+	for i, p := range chain {
+		attempt := *req
+		if err := s.registry.CheckParams(p.Name(), &attempt); err != nil {
+			if i == 0 {
+				s.writeProviderError(w, err)
+				return
+			}
+			s.logger.Debug().Err(err).Str("provider", p.Name()).Msg("Skipping fallback provider")
+			continue
+		}
+
+		ctx := provider.WithRequestID(r.Context(), chimiddleware.GetReqID(r.Context()))
+		err = s.serveChat(w, r.WithContext(ctx), p, &attempt, startTime)
+		if err == nil {
 			return
 		}
-		s.metrics.RecordCacheMiss()
+
+		fallback, reason := s.registry.ShouldFallback(err)
+		last := i == len(chain)-1
+		s.logger.Info().
+			Err(err).
+			Str("provider", p.Name()).
+			Str("model", req.Model).
+			Str("request_id", provider.RequestID(ctx)).
+			Str("upstream_request_id", provider.UpstreamRequestID(ctx)).
+			Bool("fallback", fallback && !last).
+			Str("reason", reason).
+			Msg("Provider request failed")
+		if !fallback || r.Context().Err() != nil {
+			break
+		}
 	}
 
+	s.writeProviderError(w, err)
+}
+
+// serveChat serves a chat completion from one provider. An error is
+// returned, with nothing written, only when the provider failed before any
+// response was sent, so the caller can fall back to another provider.
+func (s *Server) serveChat(w http.ResponseWriter, r *http.Request, prov provider.Provider, req *provider.ChatCompletionRequest, startTime time.Time) error {
+	s.metrics.ProviderRequestStarted(prov.Name())
+	defer s.metrics.ProviderRequestFinished(prov.Name())
+
 	// Handle streaming
 	if req.Stream {
-		s.handleStreamingCompletion(w, r, prov, &req)
-		return
+		return s.handleStreamingCompletion(w, r, prov, req)
 	}
 
-	// Make request
-	resp, err := prov.ChatCompletion(r.Context(), &req)
+	var result *completionResult
+	var err error
+	if s.coalesce(req) {
+		result, err = s.completeChatCoalesced(r.Context(), prov, req, startTime)
+	} else {
+		result, err = s.completeChat(r.Context(), prov, req, startTime)
+	}
 	if err != nil {
-		if provErr, ok := err.(*provider.ProviderError); ok {
-			s.writeError(w, provErr.StatusCode, provErr.Type, provErr.Message)
-		} else {
-			s.writeError(w, http.StatusInternalServerError, "provider_error", err.Error())
+		return err
+	}
+
+	s.writeCompletionHeaders(w, result)
+	w.Write(result.body)
+	return nil
+}
+
+// completionResult is the outcome of a non-streaming chat completion
+type completionResult struct {
+	body      []byte
+	cached    bool
+	coalesced bool   // shared with a concurrent identical request
+	cacheKey  string // set when the cache was consulted
+	latencyMs int64
+	cost      float64
+	usage     *provider.Usage // nil when a cached body has none
+
+	// invalidJSON is set when a JSON-mode response still didn't parse after
+	// any retries
+	invalidJSON bool
+
+	// rateLimits are upstream rate-limit headers; cache hits have none
+	rateLimits http.Header
+}
+
+// completeChat serves a non-streaming chat completion from the cache or the
+// provider, recording metrics and caching fresh responses.
+func (s *Server) completeChat(ctx context.Context, prov provider.Provider, req *provider.ChatCompletionRequest, startTime time.Time) (*completionResult, error) {
+	useCache := s.cache != nil && (req.XGateway == nil || req.XGateway.Cache == nil || *req.XGateway.Cache)
+
+	// Check cache
+	var cacheKey string
+	if useCache {
+		cacheKey = s.generateCacheKey(ctx, req)
+		lookupStart := time.Now()
+		if cached, ok := s.cache.Get(cacheKey); ok {
+			s.metrics.RecordCacheHit()
+			s.recordCacheHit(ctx, req, time.Since(lookupStart).Milliseconds())
+			return &completionResult{body: cached, cached: true, cacheKey: cacheKey, usage: cachedUsage(cached)}, nil
 		}
-		return
+		s.metrics.RecordCacheMiss()
+	}
+
+	// Make request
+	var trace *provider.TimingTrace
+	if s.cfg.Metrics.UpstreamTiming {
+		ctx, trace = provider.WithTimingTrace(ctx)
 	}
 
-	// Calculate metrics
-	latency := time.Since(startTime).Milliseconds()
-	cost := provider.CalculateCost(req.Model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+	// JSON-mode responses that don't parse are soft failures, retried up to
+	// jsonValidation.maxRetries times before being returned as they are
+	validateJSON := s.cfg.Routing.JSONValidation.Enabled && req.JSONMode()
 
-	s.metrics.RecordRequest(provider.ProviderMetrics{
-		Provider:         prov.Name(),
-		Model:            req.Model,
-		PromptTokens:     resp.Usage.PromptTokens,
-		CompletionTokens: resp.Usage.CompletionTokens,
-		TotalTokens:      resp.Usage.TotalTokens,
-		LatencyMs:        latency,
-		Cost:             cost,
-		Cached:           false,
-		Success:          true,
-		Timestamp:        time.Now(),
-	})
+	var (
+		resp        *provider.ChatCompletionResponse
+		cost        float64
+		invalidJSON bool
+	)
+	attemptStart := startTime
+	for attempt := 0; ; attempt++ {
+		var err error
+		resp, err = prov.ChatCompletion(ctx, req)
+		if err != nil {
+			if ctx.Err() == nil && providerFailure(err) {
+				s.recordFailure(ctx, prov, req, time.Since(attemptStart).Milliseconds())
+			}
+			return nil, err
+		}
+
+		// Transform reasoning before validating, so a <think> block isn't
+		// mistaken for invalid JSON
+		var strippedTokens int
+		if mode := s.reasoningMode(req.Model); mode != "" {
+			reasoning := transformReasoning(resp, mode)
+			if mode == reasoningStrip {
+				strippedTokens = s.tokenCounter(req.Model, reasoning)
+			}
+		}
+		invalidJSON = validateJSON && !validJSONContent(resp)
+
+		// Calculate metrics
+		attemptCost := s.registry.CalculateCost(prov.Name(), req.Model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+		cost += attemptCost
+
+		m := provider.ProviderMetrics{
+			Provider:         prov.Name(),
+			Model:            req.Model,
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+			CacheWriteTokens: resp.Usage.CacheCreationInputTokens,
+			CacheReadTokens:  resp.Usage.CacheReadInputTokens,
+			LatencyMs:        time.Since(attemptStart).Milliseconds(),
+			Cost:             attemptCost,
+			Cached:           false,
+			Success:          true,
+			InvalidJSON:      invalidJSON,
+			Timestamp:        time.Now(),
+			Metadata:         requestMetadata(req),
+			User:             s.requestUser(req),
+
+			StrippedReasoningTokens: strippedTokens,
+			RequestID:               provider.RequestID(ctx),
+			UpstreamRequestID:       provider.UpstreamRequestID(ctx),
+		}
+		if trace != nil {
+			m.Timing = trace.Timing()
+		}
+		s.metrics.RecordRequest(m)
+
+		if !invalidJSON || attempt >= s.cfg.Routing.JSONValidation.MaxRetries {
+			break
+		}
+		s.logger.Warn().
+			Str("provider", prov.Name()).
+			Str("model", req.Model).
+			Int("attempt", attempt+1).
+			Msg("JSON-mode response is not valid JSON, retrying")
+		attemptStart = time.Now()
+	}
 
-	// Write response
 	respBytes, err := json.Marshal(resp)
 	if err != nil {
-		s.writeError(w, http.StatusInternalServerError, "marshal_error", err.Error())
-		return
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
 	}
 
 	// Cache response
-	if s.cache != nil && (req.XGateway == nil || req.XGateway.Cache == nil || *req.XGateway.Cache) {
-		cacheKey := s.generateCacheKey(&req)
-		s.cache.Set(cacheKey, respBytes)
+	if useCache && !invalidJSON {
+		s.cache.Set(cacheKey, provider.NormalizeModel(req.Model), respBytes)
+	}
+
+	return &completionResult{
+		body:        respBytes,
+		rateLimits:  resp.RateLimits,
+		cacheKey:    cacheKey,
+		latencyMs:   time.Since(startTime).Milliseconds(),
+		cost:        cost,
+		usage:       &resp.Usage,
+		invalidJSON: invalidJSON,
+	}, nil
+}
+
+// validJSONContent reports whether every choice's content parses as JSON.
+// Tool-call turns carry their output in the tool calls, not the content.
+func validJSONContent(resp *provider.ChatCompletionResponse) bool {
+	for _, choice := range resp.Choices {
+		if choice.FinishReason == "tool_calls" {
+			continue
+		}
+		if !json.Valid([]byte(choice.Message.Content)) {
+			return false
+		}
+	}
+	return true
+}
+
+// cachedUsage reads the token usage back out of a cached response body so
+// cache hits report the same counts as the response they replay.
+func cachedUsage(body []byte) *provider.Usage {
+	var resp struct {
+		Usage *provider.Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil
+	}
+	return resp.Usage
+}
+
+// coalesce reports whether a request may share an upstream call with
+// identical in-flight requests. Requests that opt out of caching want a
+// fresh response, so they are never coalesced either.
+func (s *Server) coalesce(req *provider.ChatCompletionRequest) bool {
+	if !s.cfg.Cache.Coalesce {
+		return false
+	}
+	return req.XGateway == nil || req.XGateway.Cache == nil || *req.XGateway.Cache
+}
+
+// completeChatCoalesced runs completeChat once per provider and cache key
+// for all concurrent callers. The shared call is detached from the first
+// caller's context so one client disconnecting doesn't fail the others.
+func (s *Server) completeChatCoalesced(ctx context.Context, prov provider.Provider, req *provider.ChatCompletionRequest, startTime time.Time) (*completionResult, error) {
+	key := prov.Name() + ":" + s.generateCacheKey(ctx, req)
+
+	ch := s.inflight.DoChan(key, func() (interface{}, error) {
+		return s.completeChat(context.WithoutCancel(ctx), prov, req, startTime)
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		result := *res.Val.(*completionResult)
+		result.coalesced = res.Shared
+		return &result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
+}
 
+func (s *Server) writeCompletionHeaders(w http.ResponseWriter, result *completionResult) {
 	w.Header().Set("Content-Type", "application/json")
+	if result.cacheKey != "" {
+		w.Header().Set("X-Cache-Key", result.cacheKey)
+	}
+	copyHeaders(w.Header(), result.rateLimits)
+	if result.coalesced {
+		w.Header().Set("X-Coalesced", "true")
+	}
+	if result.invalidJSON {
+		w.Header().Set("X-JSON-Invalid", "true")
+	}
+	if result.usage != nil {
+		w.Header().Set("X-Prompt-Tokens", strconv.Itoa(result.usage.PromptTokens))
+		w.Header().Set("X-Completion-Tokens", strconv.Itoa(result.usage.CompletionTokens))
+		w.Header().Set("X-Total-Tokens", strconv.Itoa(result.usage.TotalTokens))
+	}
+	if result.cached {
+		w.Header().Set("X-Cache", "HIT")
+		return
+	}
+
 	w.Header().Set("X-Cache", "MISS")
-	w.Header().Set("X-Latency-Ms", fmt.Sprintf("%d", latency))
-	w.Header().Set("X-Cost-USD", fmt.Sprintf("%.6f", cost))
-	w.Write(respBytes)
+	w.Header().Set("X-Latency-Ms", fmt.Sprintf("%d", result.latencyMs))
+	w.Header().Set("X-Cost-USD", fmt.Sprintf("%.6f", result.cost))
 }
 
-func (s *Server) handleStreamingCompletion(w http.ResponseWriter, r *http.Request, prov provider.Provider, req *provider.ChatCompletionRequest) {
-	stream, err := prov.ChatCompletionStream(r.Context(), req)
+// handleStreamingCompletion relays a provider stream. Failing to open the
+// stream is returned to the caller; anything later is handled here.
+func (s *Server) handleStreamingCompletion(w http.ResponseWriter, r *http.Request, prov provider.Provider, req *provider.ChatCompletionRequest) error {
+	ctx := r.Context()
+	var trace *provider.TimingTrace
+	if s.cfg.Metrics.UpstreamTiming {
+		ctx, trace = provider.WithTimingTrace(ctx)
+	}
+
+	stream, err := prov.ChatCompletionStream(ctx, req)
 	if err != nil {
-		if provErr, ok := err.(*provider.ProviderError); ok {
-			s.writeError(w, provErr.StatusCode, provErr.Type, provErr.Message)
-		} else {
-			s.writeError(w, http.StatusInternalServerError, "provider_error", err.Error())
+		if r.Context().Err() == nil && providerFailure(err) {
+			s.recordFailure(ctx, prov, req, 0)
 		}
-		return
+		return err
 	}
 	defer stream.Close()
 
+	if rl, ok := stream.(provider.RateLimitedStream); ok {
+		copyHeaders(w.Header(), rl.RateLimits())
+	}
+
 	// Set SSE headers
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -117,26 +381,324 @@ func (s *Server) handleStreamingCompletion(w http.ResponseWriter, r *http.Reques
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		s.writeError(w, http.StatusInternalServerError, "streaming_not_supported", "streaming not supported")
-		return
+		return nil
 	}
 
-	// Copy stream to response
-	scanner := bufio.NewScanner(stream)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line != "" {
-			fmt.Fprintf(w, "%s\n", line)
-			flusher.Flush()
+	// Close the provider stream as soon as the client goes away, or once it
+	// has run for server.maxStreamDuration, so a blocked read returns instead
+	// of holding the upstream connection open
+	var expired <-chan time.Time
+	if maxDuration := s.cfg.Server.MaxStreamDuration; maxDuration > 0 {
+		timer := time.NewTimer(maxDuration)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	var timedOut atomic.Bool
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-r.Context().Done():
+			stream.Close()
+		case <-expired:
+			timedOut.Store(true)
+			stream.Close()
+		case <-done:
+		}
+	}()
+
+	// Relay the stream event by event, so multi-line data fields are never
+	// split across writes
+	var usage *provider.Usage
+	var tracker streamTracker
+	var reasoning *reasoningStream
+	if mode := s.reasoningMode(req.Model); mode != "" {
+		reasoning = newReasoningStream(mode)
+	}
+	var readErr error
+	var finished bool
+	heartbeat := startHeartbeat(w, flusher, s.heartbeatInterval(req))
+	events := newSSEReader(stream)
+	for {
+		ev, err := events.next()
+		if err != nil {
+			if err != io.EOF {
+				readErr = err
+			}
+			break
 		}
+		if r.Context().Err() != nil {
+			break
+		}
+
+		data, _ := ev.data()
+		if reasoning != nil {
+			if transformed := reasoning.transform(data); transformed != data {
+				data = transformed
+				ev = ev.withData(data)
+			}
+		}
+		tracker.observe(data)
+
+		// Usage comes last, in a chunk of its own. Streams the gateway
+		// adapts always send it, so it's recorded even when the client
+		// didn't ask for it with stream_options, but relayed only if it did.
+		u, usageOnly := chunkUsage(data)
+		if u != nil {
+			usage = u
+		}
+		if usageOnly && !req.IncludeUsage() {
+			continue
+		}
+
+		// Some upstreams end the stream without a finish_reason, which
+		// leaves SDKs waiting for one
+		var final []byte
+		if data == "[DONE]" {
+			finished = true
+			if chunk := tracker.final(); chunk != nil {
+				if payload, err := json.Marshal(chunk); err == nil {
+					final = payload
+				}
+			}
+		}
+
+		heartbeat.write(func() {
+			if final != nil {
+				fmt.Fprintf(w, "data: %s\n\n", final)
+			}
+			w.Write(ev.bytes())
+			flusher.Flush()
+		})
 	}
+	heartbeat.Stop()
 
-	// Record metrics (approximate for streaming)
-	s.metrics.RecordRequest(provider.ProviderMetrics{
+	// Tell the client why the stream stopped short rather than leaving it
+	// to guess from a closed connection
+	if timedOut.Load() && !finished && r.Context().Err() == nil {
+		s.logger.Warn().
+			Str("provider", prov.Name()).
+			Str("model", req.Model).
+			Dur("max_stream_duration", s.cfg.Server.MaxStreamDuration).
+			Msg("Stream exceeded the maximum duration, closing it")
+		writeStreamError(w, "stream_timeout", fmt.Sprintf("stream exceeded the maximum duration of %s", s.cfg.Server.MaxStreamDuration))
+		flusher.Flush()
+		s.recordFailure(ctx, prov, req, s.cfg.Server.MaxStreamDuration.Milliseconds())
+		return nil
+	}
+
+	// A read error, or an end without [DONE], while the client is still
+	// connected means the upstream broke off the stream or ended it with an
+	// error event
+	if (readErr != nil || !finished) && r.Context().Err() == nil {
+		s.recordFailure(ctx, prov, req, 0)
+		return nil
+	}
+
+	// Record metrics (approximate for streaming unless usage was reported)
+	m := provider.ProviderMetrics{
 		Provider:  prov.Name(),
 		Model:     req.Model,
 		Success:   true,
 		Timestamp: time.Now(),
-	})
+		Metadata:  requestMetadata(req),
+		User:      s.requestUser(req),
+
+		RequestID:         provider.RequestID(ctx),
+		UpstreamRequestID: provider.UpstreamRequestID(ctx),
+	}
+	if trace != nil {
+		m.Timing = trace.Timing()
+	}
+	var reasoningTokens int
+	if reasoning != nil {
+		reasoningTokens = s.tokenCounter(req.Model, reasoning.reasoning.String())
+		if reasoning.mode == reasoningStrip {
+			m.StrippedReasoningTokens = reasoningTokens
+		}
+	}
+	if usage != nil {
+		m.PromptTokens = usage.PromptTokens
+		m.CompletionTokens = usage.CompletionTokens
+		m.TotalTokens = usage.TotalTokens
+		m.CacheWriteTokens = usage.CacheCreationInputTokens
+		m.CacheReadTokens = usage.CacheReadInputTokens
+	} else if s.cfg.Metrics.EstimateStreamTokens {
+		// The tracker only sees the transformed answer, so add back the
+		// reasoning the upstream generated
+		m.PromptTokens = s.tokenCounter(req.Model, promptText(req))
+		m.CompletionTokens = s.tokenCounter(req.Model, tracker.text.String()) + reasoningTokens
+		m.TotalTokens = m.PromptTokens + m.CompletionTokens
+		m.Estimated = true
+	}
+	// Flat per-request pricing applies even when the stream reported no usage
+	m.Cost = s.registry.CalculateCost(prov.Name(), req.Model, m.PromptTokens, m.CompletionTokens)
+	s.metrics.RecordRequest(m)
+	return nil
+}
+
+// Limits on client-supplied metadata kept with each recorded request
+const (
+	maxMetadataEntries     = 16
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 256
+)
+
+// requestMetadata returns the request's x-gateway metadata, capped in entry
+// count and key/value length so clients can't bloat the metrics history
+func requestMetadata(req *provider.ChatCompletionRequest) map[string]string {
+	if req.XGateway == nil || len(req.XGateway.Metadata) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(req.XGateway.Metadata))
+	for k := range req.XGateway.Metadata {
+		if len(k) <= maxMetadataKeyLength {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > maxMetadataEntries {
+		keys = keys[:maxMetadataEntries]
+	}
+
+	metadata := make(map[string]string, len(keys))
+	for _, k := range keys {
+		v := req.XGateway.Metadata[k]
+		metadata[k] = truncateUTF8(v, maxMetadataValueLength)
+	}
+	return metadata
+}
+
+// requestUser returns the end-user id a request reports in the OpenAI user
+// field, capped in length and hashed when metrics.hashUsers is set so raw
+// ids aren't kept in the metrics history
+func (s *Server) requestUser(req *provider.ChatCompletionRequest) string {
+	user := req.EndUser
+	if user == "" {
+		return ""
+	}
+	if s.cfg.Metrics.HashUsers {
+		hash := sha256.Sum256([]byte(user))
+		return hex.EncodeToString(hash[:8])
+	}
+	return truncateUTF8(user, maxMetadataValueLength)
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// chunkUsage extracts the usage block from an SSE event's data, if present,
+// and reports whether the chunk carries nothing else
+func chunkUsage(payload string) (*provider.Usage, bool) {
+	if payload == "" || payload == "[DONE]" || !strings.Contains(payload, `"usage"`) {
+		return nil, false
+	}
+
+	var chunk provider.ChatCompletionChunk
+	if err := json.Unmarshal([]byte(payload), &chunk); err != nil || chunk.Usage == nil {
+		return nil, false
+	}
+	return chunk.Usage, len(chunk.Choices) == 0
+}
+
+// promptText joins a request's message contents for token estimation
+func promptText(req *provider.ChatCompletionRequest) string {
+	var b strings.Builder
+	for _, msg := range req.Messages {
+		b.WriteString(msg.Content)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// streamTracker follows the choices of a stream so a final chunk can be
+// synthesized for any that never reported a finish_reason. It also collects
+// the streamed text, tool call arguments included, for token estimation.
+type streamTracker struct {
+	id      string
+	model   string
+	created int64
+	open    map[int]bool
+	tools   map[int]bool // choices that streamed tool calls
+	text    strings.Builder
+}
+
+// observe records the choices of an SSE event's data
+func (t *streamTracker) observe(payload string) {
+	if payload == "" || payload == "[DONE]" || !strings.Contains(payload, `"choices"`) {
+		return
+	}
+
+	var chunk provider.ChatCompletionChunk
+	if err := json.Unmarshal([]byte(payload), &chunk); err != nil || len(chunk.Choices) == 0 {
+		return
+	}
+
+	if t.open == nil {
+		t.open = make(map[int]bool)
+	}
+	t.id, t.model, t.created = chunk.ID, chunk.Model, chunk.Created
+	for _, choice := range chunk.Choices {
+		t.text.WriteString(choice.Delta.Content)
+		for _, call := range choice.Delta.ToolCalls {
+			if call.Function != nil {
+				t.text.WriteString(call.Function.Name)
+				t.text.WriteString(call.Function.Arguments)
+			}
+			if t.tools == nil {
+				t.tools = make(map[int]bool)
+			}
+			t.tools[choice.Index] = true
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			t.open[choice.Index] = false
+		} else if _, seen := t.open[choice.Index]; !seen {
+			t.open[choice.Index] = true
+		}
+	}
+}
+
+// final returns a chunk finishing every choice still open, with
+// "tool_calls" for choices that streamed tool calls and "stop" otherwise, or
+// nil when the upstream already finished them all
+func (t *streamTracker) final() *provider.ChatCompletionChunk {
+	var indexes []int
+	for index, open := range t.open {
+		if open {
+			indexes = append(indexes, index)
+		}
+	}
+	if len(indexes) == 0 {
+		return nil
+	}
+	sort.Ints(indexes)
+
+	chunk := &provider.ChatCompletionChunk{
+		ID:      t.id,
+		Object:  "chat.completion.chunk",
+		Created: t.created,
+		Model:   t.model,
+	}
+	for _, index := range indexes {
+		reason := "stop"
+		if t.tools[index] {
+			reason = "tool_calls"
+		}
+		chunk.Choices = append(chunk.Choices, provider.ChunkChoice{
+			Index:        index,
+			FinishReason: &reason,
+		})
+	}
+	return chunk
 }
 
 func (s *Server) handleListModels(w http.ResponseWriter, r *http.Request) {
@@ -150,17 +712,38 @@ func (s *Server) handleListModels(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var models []modelData
+	seen := make(map[string]bool)
 	for _, p := range providers {
 		for _, model := range p.Models() {
+			seen[model] = true
 			models = append(models, modelData{
 				ID:      model,
 				Object:  "model",
 				Created: time.Now().Unix(),
-				OwnedBy: p.Name(),
+				OwnedBy: s.registry.OwnedBy(p.Name()),
 			})
 		}
 	}
 
+	// Include configured aliases so clients validating against this list accept them
+	aliases := make([]string, 0, len(s.cfg.Routing.ModelMappings))
+	for alias := range s.cfg.Routing.ModelMappings {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+
+	for _, alias := range aliases {
+		if seen[alias] {
+			continue
+		}
+		models = append(models, modelData{
+			ID:      alias,
+			Object:  "model",
+			Created: time.Now().Unix(),
+			OwnedBy: s.registry.OwnedBy(s.cfg.Routing.ModelMappings[alias].Provider),
+		})
+	}
+
 	response := struct {
 		Object string      `json:"object"`
 		Data   []modelData `json:"data"`
@@ -173,6 +756,18 @@ func (s *Server) handleListModels(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// writeStreamError ends an SSE stream with an error event in the shape
+// OpenAI uses for errors mid-stream
+func writeStreamError(w io.Writer, errType, message string) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]string{
+			"message": message,
+			"type":    errType,
+		},
+	})
+	fmt.Fprintf(w, "data: %s\n\n", payload)
+}
+
 func (s *Server) writeError(w http.ResponseWriter, status int, errType, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -192,18 +787,231 @@ func (s *Server) writeError(w http.ResponseWriter, status int, errType, message
 	json.NewEncoder(w).Encode(response)
 }
 
-func (s *Server) generateCacheKey(req *provider.ChatCompletionRequest) string {
+// decodeRequest decodes a JSON request body, turning decoder failures into
+// errors that point at the offending field or position
+func (s *Server) decodeRequest(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	if s.cfg.Server.StrictDecoding {
+		dec.DisallowUnknownFields()
+	}
+
+	err := dec.Decode(v)
+	if err == nil {
+		return nil
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return fmt.Errorf("request body is empty")
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("malformed JSON at offset %d: %s", syntaxErr.Offset, syntaxErr.Error())
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("malformed JSON: unexpected end of body")
+	case errors.As(err, &typeErr):
+		if typeErr.Field != "" {
+			return fmt.Errorf("field %q must be of type %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		}
+		return fmt.Errorf("request body must be a JSON object, got %s", typeErr.Value)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return fmt.Errorf("unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+	default:
+		return err
+	}
+}
+
+func validateChatRequest(req *provider.ChatCompletionRequest) error {
+	if req.Model == "" {
+		return fmt.Errorf("field \"model\" is required")
+	}
+	if len(req.Messages) == 0 {
+		return fmt.Errorf("field \"messages\" is required and must not be empty")
+	}
+	for i, msg := range req.Messages {
+		if msg.Role == "" {
+			return fmt.Errorf("field \"messages[%d].role\" is required", i)
+		}
+	}
+	if req.N != nil && *req.N < 1 {
+		return fmt.Errorf("field \"n\" must be at least 1")
+	}
+	if err := provider.CheckExtraParams(req.ExtraParams); err != nil {
+		return err
+	}
+	if req.XGateway != nil && req.XGateway.HeartbeatInterval != nil && *req.XGateway.HeartbeatInterval < 0 {
+		return fmt.Errorf("field \"x-gateway.heartbeat_interval\" must not be negative")
+	}
+	return nil
+}
+
+func copyHeaders(dst, src http.Header) {
+	for name, values := range src {
+		for _, v := range values {
+			dst.Add(name, v)
+		}
+	}
+}
+
+// modelAllowed applies the routing allow and deny lists. The deny list wins;
+// an empty allow list permits every model not denied.
+func (s *Server) modelAllowed(model string) bool {
+	normalized := provider.NormalizeModel(model)
+
+	for _, m := range s.cfg.Routing.DeniedModels {
+		if provider.NormalizeModel(m) == normalized {
+			return false
+		}
+	}
+
+	if len(s.cfg.Routing.AllowedModels) == 0 {
+		return true
+	}
+	for _, m := range s.cfg.Routing.AllowedModels {
+		if provider.NormalizeModel(m) == normalized {
+			return true
+		}
+	}
+	return false
+}
+
+// applySystemPrefix injects the configured system prefix for the request's
+// model. A leading client system message is kept after the prefix, so the
+// prefix always comes first; otherwise a new system message is prepended.
+func (s *Server) applySystemPrefix(req *provider.ChatCompletionRequest) {
+	prefix, ok := s.systemPrefixes[provider.NormalizeModel(req.Model)]
+	if !ok || prefix == "" {
+		return
+	}
+
+	if len(req.Messages) > 0 && req.Messages[0].Role == "system" {
+		req.Messages[0].Content = prefix + "\n\n" + req.Messages[0].Content
+		return
+	}
+
+	req.Messages = append([]provider.Message{{Role: "system", Content: prefix}}, req.Messages...)
+}
+
+// systemPrefixesByModel keys routing.systemPrefixes by normalized model
+func systemPrefixesByModel(prefixes map[string]string) map[string]string {
+	byModel := make(map[string]string, len(prefixes))
+	for model, prefix := range prefixes {
+		byModel[provider.NormalizeModel(model)] = prefix
+	}
+	return byModel
+}
+
+// writeNoProvider answers a request whose model no provider can serve. A
+// model whose providers are all disabled is unavailable rather than unknown.
+func (s *Server) writeNoProvider(w http.ResponseWriter, err error) {
+	if errors.Is(err, provider.ErrProviderDisabled) {
+		s.writeError(w, http.StatusServiceUnavailable, "provider_disabled", err.Error())
+		return
+	}
+	s.writeError(w, http.StatusBadRequest, "model not found", err.Error())
+}
+
+// recordFailure records a failed provider call against the provider's
+// error count
+func (s *Server) recordFailure(ctx context.Context, prov provider.Provider, req *provider.ChatCompletionRequest, latencyMs int64) {
+	s.metrics.RecordRequest(provider.ProviderMetrics{
+		Provider:  prov.Name(),
+		Model:     req.Model,
+		LatencyMs: latencyMs,
+		Success:   false,
+		Timestamp: time.Now(),
+		Metadata:  requestMetadata(req),
+		User:      s.requestUser(req),
+
+		RequestID:         provider.RequestID(ctx),
+		UpstreamRequestID: provider.UpstreamRequestID(ctx),
+	})
+}
+
+// cacheProvider is the provider name cache hits are recorded under
+const cacheProvider = "cache"
+
+// recordCacheHit records a request served from the response cache under
+// the "cache" provider, so request counts reflect client traffic. Hits cost
+// nothing and carry no tokens, since no provider processed any.
+func (s *Server) recordCacheHit(ctx context.Context, req *provider.ChatCompletionRequest, latencyMs int64) {
+	s.metrics.RecordRequest(provider.ProviderMetrics{
+		Provider:  cacheProvider,
+		Model:     req.Model,
+		LatencyMs: latencyMs,
+		Cached:    true,
+		Success:   true,
+		Timestamp: time.Now(),
+		Metadata:  requestMetadata(req),
+		User:      s.requestUser(req),
+
+		RequestID: provider.RequestID(ctx),
+	})
+}
+
+// providerFailure reports whether an error counts against the provider.
+// Rejections of the request itself (4xx other than 429) are the client's
+// fault and would skew the provider's error rate.
+func providerFailure(err error) bool {
+	var provErr *provider.ProviderError
+	if errors.As(err, &provErr) {
+		code := provErr.StatusCode
+		return code == http.StatusTooManyRequests || code < 400 || code >= 500
+	}
+	return true
+}
+
+func (s *Server) writeProviderError(w http.ResponseWriter, err error) {
+	if provErr, ok := err.(*provider.ProviderError); ok {
+		s.writeError(w, provErr.StatusCode, provErr.Type, provErr.Message)
+		return
+	}
+	s.writeError(w, http.StatusInternalServerError, "provider_error", err.Error())
+}
+
+type cacheScopeKey struct{}
+
+// withCacheScope tags the request context with a hash of the caller's API
+// key, which generateCacheKey mixes in to partition the cache per key
+func withCacheScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		hash := sha256.Sum256([]byte(key))
+		ctx := context.WithValue(r.Context(), cacheScopeKey{}, hex.EncodeToString(hash[:]))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (s *Server) generateCacheKey(ctx context.Context, req *provider.ChatCompletionRequest) string {
+	// Shared cache keys leave Scope out so they match those from before
+	// per-key isolation existed
+	scope, _ := ctx.Value(cacheScopeKey{}).(string)
+
 	// Create a hash from the request
 	data, _ := json.Marshal(struct {
-		Model       string
-		Messages    []provider.Message
-		Temperature *float64
-		MaxTokens   *int
+		Scope               string `json:",omitempty"`
+		Model               string
+		Messages            []provider.Message
+		Temperature         *float64
+		MaxTokens           *int
+		MaxCompletionTokens *int
+		N                   *int
+		Logprobs            *bool
+		TopLogprobs         *int
+		ExtraParams         map[string]json.RawMessage
+		ResponseFormat      *provider.ResponseFormat `json:",omitempty"`
 	}{
-		Model:       req.Model,
-		Messages:    req.Messages,
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
+		Model:               req.Model,
+		Messages:            req.Messages,
+		Temperature:         req.Temperature,
+		MaxTokens:           req.MaxTokens,
+		MaxCompletionTokens: req.MaxCompletionTokens,
+		N:                   req.N,
+		Logprobs:            req.Logprobs,
+		TopLogprobs:         req.TopLogprobs,
+		ExtraParams:         req.ExtraParams,
+		ResponseFormat:      req.ResponseFormat,
+		Scope:               scope,
 	})
 
 	hash := sha256.Sum256(data)
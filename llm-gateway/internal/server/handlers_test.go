@@ -0,0 +1,530 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog"
+
+	"github.com/yourorg/llm-gateway/internal/config"
+	"github.com/yourorg/llm-gateway/internal/provider"
+)
+
+// testConfig is the default config with the response cache off, so every
+// request reaches a provider
+func testConfig(providers ...config.ProviderConfig) *config.Config {
+	cfg := config.DefaultConfig()
+	cfg.Cache.Enabled = false
+	cfg.Providers = providers
+	return cfg
+}
+
+func newTestServer(t *testing.T, cfg *config.Config) *Server {
+	t.Helper()
+	s, err := New(cfg, BuildInfo{}, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func chatRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestApplySystemPrefixMatchesAnyCase(t *testing.T) {
+	s := &Server{systemPrefixes: systemPrefixesByModel(map[string]string{"GPT-4o": "Be brief."})}
+
+	req := &provider.ChatCompletionRequest{
+		Model:    "gpt-4O ",
+		Messages: []provider.Message{{Role: "user", Content: "hi"}},
+	}
+	s.applySystemPrefix(req)
+
+	if len(req.Messages) != 2 || req.Messages[0].Role != "system" || req.Messages[0].Content != "Be brief." {
+		t.Errorf("messages = %+v, want the prefix prepended as a system message", req.Messages)
+	}
+}
+
+func TestChatFallbackSkipsProviderWithoutModel(t *testing.T) {
+	var primaryCalls, otherCalls, backupCalls int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryCalls, 1)
+		http.Error(w, `{"error":{"message":"down"}}`, http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&otherCalls, 1)
+		http.Error(w, `{"error":{"message":"model not found"}}`, http.StatusNotFound)
+	}))
+	defer other.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backupCalls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"c1","object":"chat.completion","model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`)
+	}))
+	defer backup.Close()
+
+	cfg := testConfig(
+		config.ProviderConfig{Name: "primary", APIKey: "k", BaseURL: primary.URL, Models: []string{"m"}, MaxRetries: 1},
+		config.ProviderConfig{Name: "other", APIKey: "k", BaseURL: other.URL, Models: []string{"other-model"}, MaxRetries: 1},
+		config.ProviderConfig{Name: "backup", APIKey: "k", BaseURL: backup.URL, Models: []string{"m"}, MaxRetries: 1},
+	)
+	cfg.Routing.ModelMappings = map[string]config.ModelMapping{"m": {Provider: "primary", Model: "m"}}
+	cfg.Routing.FallbackChain = []string{"other", "backup"}
+	s := newTestServer(t, cfg)
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, chatRequest(`{"model":"m","messages":[{"role":"user","content":"hi"}]}`))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Body.String(), `"content":"ok"`) {
+		t.Errorf("body = %s, want the backup's completion", rec.Body)
+	}
+	if primaryCalls != 1 || otherCalls != 0 || backupCalls != 1 {
+		t.Errorf("calls: primary %d, other %d, backup %d; want 1, 0, 1", primaryCalls, otherCalls, backupCalls)
+	}
+}
+
+func TestStreamClientCancelClosesUpstream(t *testing.T) {
+	sent := make(chan struct{})
+	upstreamGone := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"c1\",\"object\":\"chat.completion.chunk\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		close(sent)
+
+		// Never finish; only the gateway dropping the connection ends this
+		<-r.Context().Done()
+		close(upstreamGone)
+	}))
+	defer upstream.Close()
+
+	s := newTestServer(t, testConfig(
+		config.ProviderConfig{Name: "up", APIKey: "k", BaseURL: upstream.URL, Models: []string{"m"}, MaxRetries: 1},
+	))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := chatRequest(`{"model":"m","stream":true,"messages":[{"role":"user","content":"hi"}]}`).WithContext(ctx)
+	handled := make(chan struct{})
+	go func() {
+		s.router.ServeHTTP(httptest.NewRecorder(), req)
+		close(handled)
+	}()
+
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream never sent its first chunk")
+	}
+	cancel()
+
+	for name, ch := range map[string]chan struct{}{"handler": handled, "upstream connection": upstreamGone} {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s still open 5s after the client went away", name)
+		}
+	}
+
+	if ps := s.metrics.GetStats().ByProvider["up"]; ps != nil && ps.Errors != 0 {
+		t.Errorf("client cancel recorded %d provider errors, want 0", ps.Errors)
+	}
+}
+
+func TestMultipleChoicesRequest(t *testing.T) {
+	n := func(v int) *int { return &v }
+	req := func(choices *int) *provider.ChatCompletionRequest {
+		return &provider.ChatCompletionRequest{
+			Model:    "m",
+			Messages: []provider.Message{{Role: "user", Content: "hi"}},
+			N:        choices,
+		}
+	}
+
+	if err := validateChatRequest(req(n(0))); err == nil {
+		t.Error("n = 0 accepted")
+	}
+	if err := validateChatRequest(req(n(3))); err != nil {
+		t.Errorf("n = 3 rejected: %v", err)
+	}
+
+	s := &Server{}
+	ctx := context.Background()
+	if s.generateCacheKey(ctx, req(n(1))) == s.generateCacheKey(ctx, req(n(3))) {
+		t.Error("n = 1 and n = 3 share a cache key, so one would be served the other's choices")
+	}
+}
+
+func TestStreamRecordsCacheTokens(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"id\":\"c1\",\"object\":\"chat.completion.chunk\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"hi\"},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: {\"id\":\"c1\",\"object\":\"chat.completion.chunk\",\"model\":\"m\",\"choices\":[],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":2,\"total_tokens\":12,\"cache_creation_input_tokens\":40,\"cache_read_input_tokens\":300}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	s := newTestServer(t, testConfig(
+		config.ProviderConfig{Name: "up", APIKey: "k", BaseURL: upstream.URL, Models: []string{"m"}, MaxRetries: 1},
+	))
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, chatRequest(`{"model":"m","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	ms := s.metrics.GetStats().ByModel["m"]
+	if ms == nil {
+		t.Fatal("stream not recorded")
+	}
+	if ms.PromptTokens != 10 || ms.CacheWriteTokens != 40 || ms.CacheReadTokens != 300 {
+		t.Errorf("recorded prompt %d, cache write %d, cache read %d; want 10, 40, 300", ms.PromptTokens, ms.CacheWriteTokens, ms.CacheReadTokens)
+	}
+}
+
+func TestRequestUserTruncatesOnRuneBoundary(t *testing.T) {
+	s := &Server{cfg: config.DefaultConfig()}
+
+	// 255 ASCII bytes leave one byte of the limit, less than "é" needs
+	user := strings.Repeat("a", maxMetadataValueLength-1) + "éé"
+	got := s.requestUser(&provider.ChatCompletionRequest{EndUser: user})
+	if !utf8.ValidString(got) {
+		t.Fatalf("truncated user %q is not valid UTF-8", got[len(got)-4:])
+	}
+	if want := strings.Repeat("a", maxMetadataValueLength-1); got != want {
+		t.Errorf("truncated user is %d bytes, want %d", len(got), len(want))
+	}
+
+	metadata := requestMetadata(&provider.ChatCompletionRequest{
+		XGateway: &provider.GatewayExtensions{Metadata: map[string]string{"team": user}},
+	})
+	if !utf8.ValidString(metadata["team"]) {
+		t.Error("truncated metadata value is not valid UTF-8")
+	}
+}
+
+func TestExtraParamsCantSetStandardFields(t *testing.T) {
+	called := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer upstream.Close()
+
+	s := newTestServer(t, testConfig(
+		config.ProviderConfig{Name: "up", APIKey: "k", BaseURL: upstream.URL, Models: []string{"m"}, MaxRetries: 1},
+	))
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, chatRequest(`{"model":"m","messages":[{"role":"user","content":"hi"}],"extra_params":{"stream":true}}`))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400; body %s", rec.Code, rec.Body)
+	}
+	if called {
+		t.Error("request reached the upstream")
+	}
+}
+
+func TestBatchCountsEachRequestAgainstRateLimit(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"c1","object":"chat.completion","model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}`)
+	}))
+	defer upstream.Close()
+
+	cfg := testConfig(
+		config.ProviderConfig{Name: "up", APIKey: "k", BaseURL: upstream.URL, Models: []string{"m"}, MaxRetries: 1},
+	)
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.PerKey = config.RateLimit{Requests: 3, Window: time.Hour}
+	s := newTestServer(t, cfg)
+
+	item := `{"model":"m","messages":[{"role":"user","content":"hi"}]}`
+	batch := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions/batch", strings.NewReader(`{"requests":[`+item+`,`+item+`]}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := batch(); rec.Code != http.StatusOK {
+		t.Fatalf("first batch status = %d, body %s", rec.Code, rec.Body)
+	}
+	// Two of the three requests are spent, so the second batch doesn't fit
+	if rec := batch(); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second batch status = %d, want 429", rec.Code)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("upstream called %d times, want 2", n)
+	}
+}
+
+func TestStreamErrorEventRecordedAsFailure(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"usage\":{\"input_tokens\":5}}}\n\n")
+		fmt.Fprint(w, "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n")
+	}))
+	defer upstream.Close()
+
+	s := newTestServer(t, testConfig(
+		config.ProviderConfig{Name: "anthropic", APIKey: "k", BaseURL: upstream.URL, Models: []string{"m"}, MaxRetries: 1},
+	))
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, chatRequest(`{"model":"m","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+
+	if !strings.Contains(rec.Body.String(), `"overloaded_error"`) {
+		t.Errorf("error event not relayed: %s", rec.Body)
+	}
+	ps := s.metrics.GetStats().ByProvider["anthropic"]
+	if ps == nil || ps.Errors != 1 {
+		t.Fatalf("provider stats = %+v, want one error", ps)
+	}
+	if ps.Requests != 1 {
+		t.Errorf("requests = %d, want the failure alone", ps.Requests)
+	}
+}
+
+func TestMultipleChoicesResponse(t *testing.T) {
+	var sentN int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			N int `json:"n"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		sentN = body.N
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"c1","object":"chat.completion","model":"gpt-4","choices":[
+			{"index":0,"message":{"role":"assistant","content":"one"},"finish_reason":"stop"},
+			{"index":1,"message":{"role":"assistant","content":"two"},"finish_reason":"stop"},
+			{"index":2,"message":{"role":"assistant","content":"three"},"finish_reason":"length"}],
+			"usage":{"prompt_tokens":10,"completion_tokens":30,"total_tokens":40}}`)
+	}))
+	defer upstream.Close()
+
+	s := newTestServer(t, testConfig(
+		config.ProviderConfig{Name: "up", APIKey: "k", BaseURL: upstream.URL, Models: []string{"gpt-4"}, MaxRetries: 1},
+	))
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, chatRequest(`{"model":"gpt-4","n":3,"messages":[{"role":"user","content":"hi"}]}`))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if sentN != 3 {
+		t.Errorf("upstream got n = %d, want 3", sentN)
+	}
+
+	var resp provider.ChatCompletionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"one", "two", "three"}
+	if len(resp.Choices) != len(want) {
+		t.Fatalf("got %d choices, want %d", len(resp.Choices), len(want))
+	}
+	for i, choice := range resp.Choices {
+		if choice.Index != i || choice.Message.Content != want[i] {
+			t.Errorf("choice %d = index %d, content %v; want %q", i, choice.Index, choice.Message.Content, want[i])
+		}
+	}
+
+	ms := s.metrics.GetStats().ByModel["gpt-4"]
+	if ms == nil {
+		t.Fatal("request not recorded")
+	}
+	if ms.PromptTokens != 10 || ms.CompletionTokens != 30 {
+		t.Errorf("recorded %d prompt and %d completion tokens, want 10 and 30", ms.PromptTokens, ms.CompletionTokens)
+	}
+	wantCost := provider.CalculateCost("gpt-4", 10, 30)
+	if wantCost == 0 || ms.Cost != wantCost {
+		t.Errorf("recorded cost = %v, want %v", ms.Cost, wantCost)
+	}
+}
+
+func TestStreamToolCallsWithoutFinishReason(t *testing.T) {
+	deltas := []string{
+		`{"id":"c1","object":"chat.completion.chunk","model":"m","choices":[{"index":0,"delta":{"role":"assistant","tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`,
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, d := range deltas {
+			fmt.Fprintf(w, "data: %s\n\n", d)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	s := newTestServer(t, testConfig(
+		config.ProviderConfig{Name: "up", APIKey: "k", BaseURL: upstream.URL, Models: []string{"m"}, MaxRetries: 1},
+	))
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, chatRequest(`{"model":"m","stream":true,"messages":[{"role":"user","content":"weather?"}]}`))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	var events []string
+	for _, event := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n\n") {
+		if data, ok := strings.CutPrefix(event, "data: "); ok {
+			events = append(events, data)
+		}
+	}
+	if len(events) != len(deltas)+2 {
+		t.Fatalf("got %d events, want the %d deltas, a final chunk and [DONE]: %q", len(events), len(deltas), events)
+	}
+	for i, d := range deltas {
+		if events[i] != d {
+			t.Errorf("event %d = %s, want it relayed as sent: %s", i, events[i], d)
+		}
+	}
+
+	var final provider.ChatCompletionChunk
+	if err := json.Unmarshal([]byte(events[len(deltas)]), &final); err != nil {
+		t.Fatal(err)
+	}
+	if len(final.Choices) != 1 || final.Choices[0].FinishReason == nil || *final.Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("final chunk = %s, want finish_reason tool_calls", events[len(deltas)])
+	}
+	if final.ID != "c1" {
+		t.Errorf("final chunk id = %q, want the stream's", final.ID)
+	}
+	if events[len(events)-1] != "[DONE]" {
+		t.Errorf("last event = %s, want [DONE]", events[len(events)-1])
+	}
+}
+
+func TestCompletionFallsBackLikeChat(t *testing.T) {
+	var primaryCalls int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryCalls, 1)
+		http.Error(w, `{"error":{"message":"down"}}`, http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+	var prompt string
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body provider.ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		if len(body.Messages) == 1 {
+			prompt = body.Messages[0].Content
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"c1","object":"chat.completion","model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`)
+	}))
+	defer backup.Close()
+
+	cfg := testConfig(
+		config.ProviderConfig{Name: "primary", APIKey: "k", BaseURL: primary.URL, Models: []string{"m"}, MaxRetries: 1},
+		config.ProviderConfig{Name: "backup", APIKey: "k", BaseURL: backup.URL, Models: []string{"m"}, MaxRetries: 1},
+	)
+	cfg.Routing.ModelMappings = map[string]config.ModelMapping{"m": {Provider: "primary", Model: "m"}}
+	cfg.Routing.FallbackChain = []string{"backup"}
+	s := newTestServer(t, cfg)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(`{"model":"m","prompt":"Say ok"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if primaryCalls != 1 || prompt != "Say ok" {
+		t.Errorf("primary calls %d, backup prompt %q; want 1 and the prompt as a message", primaryCalls, prompt)
+	}
+	var resp completionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Object != "text_completion" || len(resp.Choices) != 1 || resp.Choices[0].Text != "ok" {
+		t.Errorf("response = %+v, want the backup's answer as a text completion", resp)
+	}
+	if rec.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("X-Cache = %q, want the chat path's headers", rec.Header().Get("X-Cache"))
+	}
+
+	// Errors keep the chat endpoint's shape and status
+	req = httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(`{"prompt":"hi"}`))
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"model`) {
+		t.Errorf("missing model: status %d, body %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCacheClearNeedsAdminKey(t *testing.T) {
+	clearCache := func(s *Server, key string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/cache/clear", nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	cfg := testConfig()
+	cfg.Cache.Enabled = true
+	if code := clearCache(newTestServer(t, cfg), ""); code != http.StatusForbidden {
+		t.Errorf("without admin keys: status = %d, want 403", code)
+	}
+
+	cfg = testConfig()
+	cfg.Cache.Enabled = true
+	cfg.Server.AdminKeys = []string{"admin"}
+	s := newTestServer(t, cfg)
+	if code := clearCache(s, ""); code != http.StatusUnauthorized {
+		t.Errorf("without a key: status = %d, want 401", code)
+	}
+	if code := clearCache(s, "admin"); code != http.StatusOK {
+		t.Errorf("with the admin key: status = %d, want 200", code)
+	}
+}
+
+func TestAnthropicStreamUsageRecordedWithoutIncludeUsage(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"usage\":{\"input_tokens\":12,\"output_tokens\":1}}}\n\n")
+		fmt.Fprint(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hi\"}}\n\n")
+		fmt.Fprint(w, "event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":3}}\n\n")
+		fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+	}))
+	defer upstream.Close()
+
+	for _, includeUsage := range []bool{false, true} {
+		s := newTestServer(t, testConfig(
+			config.ProviderConfig{Name: "anthropic", APIKey: "k", BaseURL: upstream.URL, Models: []string{"m"}, MaxRetries: 1},
+		))
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, chatRequest(fmt.Sprintf(`{"model":"m","stream":true,"stream_options":{"include_usage":%t},"messages":[{"role":"user","content":"hi"}]}`, includeUsage)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+		}
+
+		if relayed := strings.Contains(rec.Body.String(), `"usage"`); relayed != includeUsage {
+			t.Errorf("include_usage %t: usage chunk relayed = %t", includeUsage, relayed)
+		}
+		ms := s.metrics.GetStats().ByModel["m"]
+		if ms == nil || ms.PromptTokens != 12 || ms.CompletionTokens != 3 {
+			t.Errorf("include_usage %t: recorded %+v, want 12 prompt and 3 completion tokens", includeUsage, ms)
+		}
+	}
+}
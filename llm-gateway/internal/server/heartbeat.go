@@ -0,0 +1,115 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/yourorg/llm-gateway/internal/provider"
+)
+
+// maxHeartbeatInterval caps a request's x-gateway.heartbeat_interval
+const maxHeartbeatInterval = 5 * time.Minute
+
+// heartbeatInterval returns how often an idle stream gets a heartbeat:
+// x-gateway.heartbeat_interval capped at maxHeartbeatInterval, or
+// server.streamHeartbeat when the request doesn't set one. Zero disables
+// heartbeats.
+func (s *Server) heartbeatInterval(req *provider.ChatCompletionRequest) time.Duration {
+	if req.XGateway == nil || req.XGateway.HeartbeatInterval == nil {
+		return s.cfg.Server.StreamHeartbeat
+	}
+
+	interval := time.Duration(*req.XGateway.HeartbeatInterval) * time.Second
+	switch {
+	case interval <= 0:
+		return 0
+	case interval > maxHeartbeatInterval:
+		return maxHeartbeatInterval
+	}
+	return interval
+}
+
+// streamHeartbeat writes an SSE comment to a stream that has been idle for
+// its interval, so proxies that drop idle connections keep it open while
+// the upstream is thinking. Clients ignore comment lines. Every other write
+// to the stream goes through write so the two never interleave. A nil
+// heartbeat just runs the writes.
+type streamHeartbeat struct {
+	mu       sync.Mutex
+	w        io.Writer
+	flusher  http.Flusher
+	interval time.Duration
+	last     time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startHeartbeat starts heartbeats on a stream, or returns nil when
+// interval is zero
+func startHeartbeat(w io.Writer, flusher http.Flusher, interval time.Duration) *streamHeartbeat {
+	if interval <= 0 {
+		return nil
+	}
+
+	h := &streamHeartbeat{
+		w:        w,
+		flusher:  flusher,
+		interval: interval,
+		last:     time.Now(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+func (h *streamHeartbeat) run() {
+	defer close(h.done)
+
+	timer := time.NewTimer(h.interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-timer.C:
+		}
+
+		h.mu.Lock()
+		wait := h.interval - time.Since(h.last)
+		if wait <= 0 {
+			io.WriteString(h.w, ": heartbeat\n\n")
+			h.flusher.Flush()
+			h.last = time.Now()
+			wait = h.interval
+		}
+		h.mu.Unlock()
+		timer.Reset(wait)
+	}
+}
+
+// write runs fn, which writes to the stream, without a heartbeat in between
+func (h *streamHeartbeat) write(fn func()) {
+	if h == nil {
+		fn()
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fn()
+	h.last = time.Now()
+}
+
+// Stop ends the heartbeats and waits for any in progress, so the stream can
+// be written to directly again
+func (h *streamHeartbeat) Stop() {
+	if h == nil {
+		return
+	}
+	close(h.stop)
+	<-h.done
+}
@@ -0,0 +1,277 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/yourorg/llm-gateway/internal/provider"
+)
+
+// Modes for routing.reasoningTransforms
+const (
+	// reasoningStrip removes reasoning_content and leading <think> blocks
+	reasoningStrip = "strip"
+	// reasoningSeparate moves leading <think> blocks into reasoning_content
+	reasoningSeparate = "separate"
+)
+
+const (
+	thinkOpen  = "<think>"
+	thinkClose = "</think>"
+)
+
+// parseReasoningTransforms validates routing.reasoningTransforms and keys it
+// by normalized model
+func parseReasoningTransforms(transforms map[string]string) (map[string]string, error) {
+	parsed := make(map[string]string, len(transforms))
+	for model, mode := range transforms {
+		mode = strings.ToLower(strings.TrimSpace(mode))
+		if mode != reasoningStrip && mode != reasoningSeparate {
+			return nil, fmt.Errorf("invalid reasoning transform %q for model %s: want %q or %q", mode, model, reasoningStrip, reasoningSeparate)
+		}
+		parsed[provider.NormalizeModel(model)] = mode
+	}
+	return parsed, nil
+}
+
+// reasoningMode returns the transform configured for a model, or "" for none
+func (s *Server) reasoningMode(model string) string {
+	return s.reasoning[provider.NormalizeModel(model)]
+}
+
+// dropRequestReasoning clears reasoning_content from the client's messages.
+// Reasoning from earlier turns isn't part of the conversation, and some
+// upstreams reject requests that include it.
+func dropRequestReasoning(req *provider.ChatCompletionRequest) {
+	for i := range req.Messages {
+		req.Messages[i].ReasoningContent = ""
+	}
+}
+
+// transformReasoning applies a reasoning transform to every choice of a
+// response and returns the reasoning text it removed or moved
+func transformReasoning(resp *provider.ChatCompletionResponse, mode string) string {
+	var reasoning strings.Builder
+	for i := range resp.Choices {
+		msg := &resp.Choices[i].Message
+
+		var split thinkSplitter
+		thought, answer := split.next(msg.Content)
+		moreThought, moreAnswer := split.flush()
+		thought += moreThought
+		answer += moreAnswer
+
+		reasoning.WriteString(msg.ReasoningContent)
+		reasoning.WriteString(thought)
+
+		msg.Content = answer
+		switch mode {
+		case reasoningStrip:
+			msg.ReasoningContent = ""
+		case reasoningSeparate:
+			msg.ReasoningContent += thought
+		}
+	}
+	return reasoning.String()
+}
+
+// reasoningStream applies a reasoning transform to a stream chunk by chunk,
+// following each choice's <think> block across chunk boundaries
+type reasoningStream struct {
+	mode      string
+	splitters map[int]*thinkSplitter
+
+	// reasoning is the text removed or moved so far, for token counts
+	reasoning strings.Builder
+}
+
+func newReasoningStream(mode string) *reasoningStream {
+	return &reasoningStream{mode: mode, splitters: make(map[int]*thinkSplitter)}
+}
+
+// transform rewrites one SSE data payload. Payloads that aren't chunks, or
+// that the transform leaves alone, are returned unchanged.
+func (rs *reasoningStream) transform(data string) string {
+	if data == "" || data == "[DONE]" || !strings.Contains(data, `"choices"`) {
+		return data
+	}
+
+	var chunk map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return data
+	}
+	var choices []map[string]json.RawMessage
+	if err := json.Unmarshal(chunk["choices"], &choices); err != nil {
+		return data
+	}
+
+	changed := false
+	for _, choice := range choices {
+		if rs.transformChoice(choice) {
+			changed = true
+		}
+	}
+	if !changed {
+		return data
+	}
+
+	encoded, err := json.Marshal(choices)
+	if err != nil {
+		return data
+	}
+	chunk["choices"] = encoded
+	out, err := json.Marshal(chunk)
+	if err != nil {
+		return data
+	}
+	return string(out)
+}
+
+// transformChoice rewrites one choice's delta in place, reporting whether
+// anything changed
+func (rs *reasoningStream) transformChoice(choice map[string]json.RawMessage) bool {
+	var delta map[string]json.RawMessage
+	if err := json.Unmarshal(choice["delta"], &delta); err != nil || delta == nil {
+		return false
+	}
+
+	var index int
+	json.Unmarshal(choice["index"], &index)
+	split, ok := rs.splitters[index]
+	if !ok {
+		split = &thinkSplitter{}
+		rs.splitters[index] = split
+	}
+
+	var content, fieldReasoning string
+	_, hasContent := delta["content"]
+	json.Unmarshal(delta["content"], &content)
+	json.Unmarshal(delta["reasoning_content"], &fieldReasoning)
+
+	thought, answer := split.next(content)
+	// Release anything held back once the choice is finished
+	if reason, ok := choice["finish_reason"]; ok && string(reason) != "null" {
+		moreThought, moreAnswer := split.flush()
+		thought += moreThought
+		answer += moreAnswer
+	}
+
+	rs.reasoning.WriteString(fieldReasoning)
+	rs.reasoning.WriteString(thought)
+
+	if thought == "" && answer == content && (rs.mode != reasoningStrip || fieldReasoning == "") {
+		return false
+	}
+
+	if hasContent || answer != "" {
+		delta["content"], _ = json.Marshal(answer)
+	}
+	switch rs.mode {
+	case reasoningStrip:
+		delete(delta, "reasoning_content")
+	case reasoningSeparate:
+		if fieldReasoning+thought != "" {
+			delta["reasoning_content"], _ = json.Marshal(fieldReasoning + thought)
+		}
+	}
+
+	encoded, err := json.Marshal(delta)
+	if err != nil {
+		return false
+	}
+	choice["delta"] = encoded
+	return true
+}
+
+// Where a thinkSplitter is in a choice's content
+const (
+	thinkStart  = iota // before any non-space text; a <think> tag may open
+	thinkInside        // inside the <think> block
+	thinkAfter         // after </think>, dropping the whitespace before the answer
+	thinkDone          // in the answer, passed through as is
+)
+
+// thinkSplitter separates a leading <think>...</think> block from content
+// that arrives in pieces. Text that might be part of a tag is held back
+// until the next piece shows what it is.
+type thinkSplitter struct {
+	state   int
+	pending string
+}
+
+// next consumes a piece of content and returns the reasoning and answer
+// text that can be released so far
+func (t *thinkSplitter) next(content string) (reasoning, answer string) {
+	t.pending += content
+	for {
+		switch t.state {
+		case thinkStart:
+			trimmed := strings.TrimLeft(t.pending, " \t\r\n")
+			if strings.HasPrefix(trimmed, thinkOpen) {
+				t.state = thinkInside
+				t.pending = trimmed[len(thinkOpen):]
+				continue
+			}
+			if strings.HasPrefix(thinkOpen, trimmed) {
+				return reasoning, answer
+			}
+			t.state = thinkDone
+			answer, t.pending = t.pending, ""
+			return reasoning, answer
+
+		case thinkInside:
+			if i := strings.Index(t.pending, thinkClose); i >= 0 {
+				reasoning += t.pending[:i]
+				t.pending = t.pending[i+len(thinkClose):]
+				t.state = thinkAfter
+				continue
+			}
+			keep := partialSuffix(t.pending, thinkClose)
+			reasoning += t.pending[:len(t.pending)-keep]
+			t.pending = t.pending[len(t.pending)-keep:]
+			return reasoning, answer
+
+		case thinkAfter:
+			t.pending = strings.TrimLeft(t.pending, " \t\r\n")
+			if t.pending != "" {
+				t.state = thinkDone
+				answer, t.pending = t.pending, ""
+			}
+			return reasoning, answer
+
+		default:
+			answer, t.pending = t.pending, ""
+			return reasoning, answer
+		}
+	}
+}
+
+// flush releases whatever was held back, at the end of the content. An
+// unclosed <think> block is all reasoning.
+func (t *thinkSplitter) flush() (reasoning, answer string) {
+	pending := t.pending
+	t.pending = ""
+
+	switch t.state {
+	case thinkStart:
+		t.state = thinkDone
+		return "", pending
+	case thinkInside:
+		return pending, ""
+	default:
+		return "", pending
+	}
+}
+
+// partialSuffix returns the length of the longest suffix of s that is a
+// proper prefix of tag, i.e. the start of a tag that may finish in the next
+// piece
+func partialSuffix(s, tag string) int {
+	for n := len(tag) - 1; n > 0; n-- {
+		if strings.HasSuffix(s, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
@@ -2,14 +2,20 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/rs/zerolog"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
 
 	"github.com/yourorg/llm-gateway/internal/cache"
 	"github.com/yourorg/llm-gateway/internal/config"
@@ -18,19 +24,50 @@ import (
 	"github.com/yourorg/llm-gateway/internal/provider"
 )
 
+// BuildInfo identifies the running gateway build
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+}
+
 type Server struct {
 	cfg      *config.Config
+	build    BuildInfo
 	router   chi.Router
 	registry *provider.Registry
 	cache    cache.Cache
 	metrics  *metrics.Collector
 	logger   zerolog.Logger
 	server   *http.Server
+
+	// inflight coalesces identical non-streaming requests when
+	// cache.coalesce is set
+	inflight singleflight.Group
+
+	// tokenCounter estimates prompt tokens for /api/v1/estimate, and stream
+	// usage when metrics.estimateStreamTokens is set and the upstream
+	// reports none
+	tokenCounter provider.TokenCounter
+
+	// reasoning is routing.reasoningTransforms keyed by normalized model
+	reasoning map[string]string
+
+	// systemPrefixes is routing.systemPrefixes keyed by normalized model
+	systemPrefixes map[string]string
+
+	// configPath is re-read by the providers reload endpoint; empty uses
+	// the default config search paths
+	configPath string
+
+	// Optional gRPC health service, see grpc_health.go
+	grpcServer *grpc.Server
+	health     *health.Server
 }
 
-func New(cfg *config.Config, logger zerolog.Logger) (*Server, error) {
+func New(cfg *config.Config, build BuildInfo, logger zerolog.Logger) (*Server, error) {
 	// Initialize provider registry
-	registry, err := provider.NewRegistry(cfg)
+	registry, err := provider.NewRegistry(cfg, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create provider registry: %w", err)
 	}
@@ -38,18 +75,57 @@ func New(cfg *config.Config, logger zerolog.Logger) (*Server, error) {
 	// Initialize cache
 	var c cache.Cache
 	if cfg.Cache.Enabled {
-		c = cache.NewMemoryCache(cfg.Cache.MaxSize, cfg.Cache.TTL)
+		switch cfg.Cache.Backend {
+		case "disk":
+			dc, err := cache.NewDiskCache(cfg.Cache.Path, cfg.Cache.TTL)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create disk cache: %w", err)
+			}
+			c = dc
+		case "redis":
+			rc, err := cache.NewRedisCache(cfg.Cache.RedisURL, cfg.Cache.TTL, cache.RedisOptions{
+				Timeout:          cfg.Cache.RedisTimeout,
+				BreakerThreshold: cfg.Cache.RedisBreakerThreshold,
+				BreakerCooldown:  cfg.Cache.RedisBreakerCooldown,
+			}, logger.With().Str("component", "cache").Logger())
+			if err != nil {
+				return nil, fmt.Errorf("failed to create redis cache: %w", err)
+			}
+			c = rc
+		default:
+			c = cache.NewMemoryCache(cfg.Cache.MaxSize, cfg.Cache.TTL)
+		}
 	}
 
 	// Initialize metrics
-	mc := metrics.NewCollector()
+	retention, err := time.ParseDuration(cfg.Metrics.Retention)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metrics retention %q: %w", cfg.Metrics.Retention, err)
+	}
+	mc := metrics.NewCollector(retention)
+	if budget := registry.RetryBudget(); budget != nil {
+		mc.SetRetryBudget(budget)
+	}
+	if rc, ok := c.(*cache.RedisCache); ok {
+		mc.SetRedisCache(rc)
+	}
+
+	reasoning, err := parseReasoningTransforms(cfg.Routing.ReasoningTransforms)
+	if err != nil {
+		return nil, err
+	}
 
 	s := &Server{
 		cfg:      cfg,
+		build:    build,
 		registry: registry,
 		cache:    c,
 		metrics:  mc,
 		logger:   logger,
+
+		reasoning:      reasoning,
+		systemPrefixes: systemPrefixesByModel(cfg.Routing.SystemPrefixes),
+		tokenCounter:   provider.EstimateTokens,
 	}
 
 	s.setupRouter()
@@ -57,6 +133,20 @@ func New(cfg *config.Config, logger zerolog.Logger) (*Server, error) {
 	return s, nil
 }
 
+// SetTokenCounter replaces the token estimator, e.g. with a real
+// tokenizer. It is used by /api/v1/estimate and, when
+// metrics.estimateStreamTokens is set, for streams without reported usage.
+// Call it before Start.
+func (s *Server) SetTokenCounter(counter provider.TokenCounter) {
+	s.tokenCounter = counter
+}
+
+// SetConfigPath sets the config file the providers reload endpoint reads,
+// normally the one the server was loaded from. Call it before Start.
+func (s *Server) SetConfigPath(path string) {
+	s.configPath = path
+}
+
 func (s *Server) setupRouter() {
 	r := chi.NewRouter()
 
@@ -67,48 +157,94 @@ func (s *Server) setupRouter() {
 	r.Use(chimiddleware.Recoverer)
 	r.Use(chimiddleware.Timeout(s.cfg.Server.WriteTimeout))
 
-	// CORS
-	if s.cfg.Server.CORS.Enabled {
-		r.Use(cors.Handler(cors.Options{
-			AllowedOrigins:   s.cfg.Server.CORS.AllowedOrigins,
-			AllowedMethods:   s.cfg.Server.CORS.AllowedMethods,
-			AllowedHeaders:   s.cfg.Server.CORS.AllowedHeaders,
-			AllowCredentials: true,
-			MaxAge:           300,
-		}))
-	}
-
-	// Rate limiting
+	// Each route group gets its own CORS policy, ahead of one rate limiter
+	// shared by all of them so preflights aren't rate limited
+	var rateLimit func(http.Handler) http.Handler
 	if s.cfg.RateLimit.Enabled {
-		r.Use(middleware.RateLimit(s.cfg.RateLimit))
+		rateLimit = middleware.RateLimit(s.cfg.RateLimit)
+	}
+	withPolicy := func(r chi.Router, policy config.CORSPolicy) {
+		if policy.Enabled {
+			r.Use(corsHandler(policy))
+		}
+		if rateLimit != nil {
+			r.Use(rateLimit)
+		}
 	}
 
-	// Health endpoints
-	r.Get("/health", s.handleHealth)
-	r.Get("/ready", s.handleReady)
+	r.Group(func(r chi.Router) {
+		withPolicy(r, s.cfg.Server.CORS.DefaultPolicy())
 
-	// Metrics endpoint
-	if s.cfg.Metrics.Enabled {
-		r.Get(s.cfg.Metrics.Endpoint, s.handleMetrics)
-	}
+		// Health endpoints
+		r.Get("/health", s.handleHealth)
+		r.Get("/ready", s.handleReady)
+
+		// Metrics endpoint
+		if s.cfg.Metrics.Enabled {
+			r.Get(s.cfg.Metrics.Endpoint, s.handleMetrics)
+		}
+	})
 
 	// API routes
 	r.Route("/v1", func(r chi.Router) {
+		withPolicy(r, s.cfg.Server.CORS.PublicPolicy())
+
 		// OpenAI-compatible endpoints
+		if s.cfg.Cache.PerKeyIsolation {
+			r.Use(withCacheScope)
+		}
+
 		r.Post("/chat/completions", s.handleChatCompletion)
+		r.Post("/chat/completions/batch", s.handleChatCompletionBatch)
+		r.Post("/completions", s.handleCompletion)
 		r.Get("/models", s.handleListModels)
 	})
 
 	// Gateway-specific API
 	r.Route("/api/v1", func(r chi.Router) {
+		withPolicy(r, s.cfg.Server.CORS.AdminPolicy())
+
+		r.Get("/version", s.handleVersion)
 		r.Get("/usage", s.handleUsage)
+		r.Get("/usage/detailed", s.handleUsageDetailed)
 		r.Get("/providers/status", s.handleProvidersStatus)
-		r.Post("/cache/clear", s.handleCacheClear)
+		r.Post("/estimate", s.handleEstimate)
+
+		if len(s.cfg.Server.AdminKeys) > 0 {
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.Auth(adminKeys(s.cfg.Server.AdminKeys)))
+				r.Get("/config", s.handleConfig)
+				r.Post("/providers/reload", s.handleProvidersReload)
+				r.Post("/providers/{name}/disable", s.handleProviderDisable)
+				r.Post("/providers/{name}/enable", s.handleProviderEnable)
+			})
+		}
+
+		// Cache administration is always routed, so without admin keys it
+		// answers 403 rather than looking like it doesn't exist
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireAdmin)
+			r.Post("/cache/clear", s.handleCacheClear)
+			r.Get("/cache/peek", s.handleCachePeek)
+			r.Delete("/cache", s.handleCacheInvalidate)
+			r.Delete("/cache/{key}", s.handleCacheDelete)
+		})
 	})
 
 	s.router = r
 }
 
+// corsHandler builds the CORS middleware for a policy
+func corsHandler(policy config.CORSPolicy) func(http.Handler) http.Handler {
+	return cors.Handler(cors.Options{
+		AllowedOrigins:   policy.AllowedOrigins,
+		AllowedMethods:   policy.AllowedMethods,
+		AllowedHeaders:   policy.AllowedHeaders,
+		AllowCredentials: policy.AllowCredentials,
+		MaxAge:           300,
+	})
+}
+
 func (s *Server) Start() error {
 	addr := fmt.Sprintf("%s:%d", s.cfg.Server.Host, s.cfg.Server.Port)
 
@@ -119,6 +255,16 @@ func (s *Server) Start() error {
 		WriteTimeout: s.cfg.Server.WriteTimeout,
 	}
 
+	if s.cfg.Server.GRPCHealth.Enabled {
+		if err := s.startGRPCHealth(); err != nil {
+			return err
+		}
+	}
+
+	if s.cfg.Server.WarmupProviders {
+		s.warmupProviders()
+	}
+
 	s.logger.Info().
 		Str("addr", addr).
 		Msg("Starting LLM Gateway")
@@ -126,14 +272,148 @@ func (s *Server) Start() error {
 	return s.server.ListenAndServe()
 }
 
+// warmupTimeout bounds the startup connection warmup
+const warmupTimeout = 10 * time.Second
+
+// warmupProviders pre-dials every provider so connections are already in
+// the transport pools when traffic arrives. Failures are logged and ignored;
+// the provider will simply connect on first use.
+func (s *Server) warmupProviders() {
+	ctx, cancel := context.WithTimeout(context.Background(), warmupTimeout)
+	defer cancel()
+
+	for name, err := range s.registry.WarmupAll(ctx) {
+		if err != nil {
+			s.logger.Warn().Err(err).Str("provider", name).Msg("Provider warmup failed")
+			continue
+		}
+		s.logger.Debug().Str("provider", name).Msg("Provider connection warmed up")
+	}
+}
+
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.server.Shutdown(ctx)
+	s.stopGRPCHealth()
+
+	err := s.server.Shutdown(ctx)
+
+	// Release persistent cache backends once in-flight requests are done
+	if closer, ok := s.cache.(io.Closer); ok {
+		if cerr := closer.Close(); cerr != nil {
+			s.logger.Error().Err(cerr).Msg("Failed to close cache")
+		}
+	}
+
+	return err
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	response := struct {
+		Status string `json:"status"`
+		BuildInfo
+	}{
+		Status:    "ok",
+		BuildInfo: s.build,
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status":"ok"}`))
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.build)
+}
+
+// handleConfig returns the effective config, after defaults, env overrides
+// and expansion, with API keys masked
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.cfg.Redacted())
+}
+
+// handleProvidersReload rebuilds the providers from the config file's
+// providers section, leaving the rest of the running config as it is
+func (s *Server) handleProvidersReload(w http.ResponseWriter, r *http.Request) {
+	providers, err := config.LoadProviders(s.configPath)
+	if err == nil {
+		err = s.registry.ReloadProviders(providers)
+	}
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to reload providers")
+		s.writeError(w, http.StatusUnprocessableEntity, "invalid_config", err.Error())
+		return
+	}
+
+	type providerInfo struct {
+		Name   string   `json:"name"`
+		Models []string `json:"models"`
+	}
+	list := make([]providerInfo, 0, len(providers))
+	names := make([]string, 0, len(providers))
+	for _, p := range providers {
+		list = append(list, providerInfo{Name: p.Name, Models: p.Models})
+		names = append(names, p.Name)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	s.logger.Info().Strs("providers", names).Msg("Providers reloaded")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"providers": list,
+	})
+}
+
+// handleProviderDisable routes around a provider until it is enabled again,
+// e.g. during an outage. The state is kept in memory only.
+func (s *Server) handleProviderDisable(w http.ResponseWriter, r *http.Request) {
+	s.setProviderDisabled(w, r, true)
+}
+
+// handleProviderEnable puts a disabled provider back into rotation
+func (s *Server) handleProviderEnable(w http.ResponseWriter, r *http.Request) {
+	s.setProviderDisabled(w, r, false)
+}
+
+func (s *Server) setProviderDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	name := chi.URLParam(r, "name")
+	if err := s.registry.SetDisabled(name, disabled); err != nil {
+		s.writeError(w, http.StatusNotFound, "not_found", err.Error())
+		return
+	}
+
+	if disabled {
+		s.logger.Warn().Str("provider", name).Msg("Provider disabled")
+	} else {
+		s.logger.Info().Str("provider", name).Msg("Provider enabled")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"provider": name,
+		"disabled": disabled,
+	})
+}
+
+// adminKeys builds the key set middleware.Auth expects
+// requireAdmin lets through requests carrying one of server.adminKeys, and
+// refuses everything when none are configured
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	if len(s.cfg.Server.AdminKeys) == 0 {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.writeError(w, http.StatusForbidden, "permission_error", "no admin keys are configured; set server.adminKeys to use this endpoint")
+		})
+	}
+	return middleware.Auth(adminKeys(s.cfg.Server.AdminKeys))(next)
+}
+
+func adminKeys(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
 }
 
 func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
@@ -142,9 +422,11 @@ func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 
 	results := s.registry.HealthCheckAll(ctx)
 
+	// Disabled providers are already routed around, so they don't hold up
+	// readiness
 	healthy := true
-	for _, err := range results {
-		if err != nil {
+	for name, err := range results {
+		if err != nil && !s.registry.Disabled(name) {
 			healthy = false
 			break
 		}
@@ -161,8 +443,18 @@ func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain")
-	w.Write([]byte(s.metrics.Prometheus()))
+	switch r.URL.Query().Get("format") {
+	case "", "prometheus":
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(s.metrics.Prometheus()))
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"metrics": s.metrics.Families(),
+		})
+	default:
+		s.writeError(w, http.StatusBadRequest, "invalid_request_error", "format must be prometheus or json")
+	}
 }
 
 func (s *Server) handleProvidersStatus(w http.ResponseWriter, r *http.Request) {
@@ -184,7 +476,7 @@ func (s *Server) handleProvidersStatus(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			status = "unhealthy"
 		}
-		response += fmt.Sprintf(`"%s":{"status":"%s"}`, name, status)
+		response += fmt.Sprintf(`"%s":{"status":"%s","disabled":%t}`, name, status, s.registry.Disabled(name))
 		first = false
 	}
 	response += "}"
@@ -202,6 +494,87 @@ func (s *Server) handleCacheClear(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{"status":"cleared"}`))
 }
 
+// handleCacheInvalidate drops every cache entry for ?model=, e.g. after a
+// provider starts serving a new version of it
+func (s *Server) handleCacheInvalidate(w http.ResponseWriter, r *http.Request) {
+	model := r.URL.Query().Get("model")
+	if model == "" {
+		s.writeError(w, http.StatusBadRequest, "invalid_request_error", "query parameter \"model\" is required; use POST /api/v1/cache/clear to clear everything")
+		return
+	}
+
+	var deleted int
+	if s.cache != nil {
+		deleted = s.cache.DeleteByModel(provider.NormalizeModel(model))
+	}
+
+	s.logger.Info().Str("model", model).Int("deleted", deleted).Msg("Cache invalidated for model")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"model":   model,
+		"deleted": deleted,
+	})
+}
+
+// handleCacheDelete drops a single cache entry by key (from the X-Cache-Key
+// response header)
+func (s *Server) handleCacheDelete(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+
+	if s.cache == nil || !s.cache.Delete(key) {
+		s.writeError(w, http.StatusNotFound, "not_found", "no cache entry for key")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"key":     key,
+		"deleted": 1,
+	})
+}
+
+// handleCachePeek shows a cache entry and its metadata without serving it,
+// for investigating stale responses. Keys are the request hashes used by
+// the chat completion cache.
+func (s *Server) handleCachePeek(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		s.writeError(w, http.StatusBadRequest, "invalid_request_error", "query parameter \"key\" is required")
+		return
+	}
+
+	if s.cache == nil {
+		s.writeError(w, http.StatusNotFound, "not_found", "cache is disabled")
+		return
+	}
+
+	entry, ok := s.cache.Peek(key)
+	if !ok {
+		s.writeError(w, http.StatusNotFound, "not_found", "no cache entry for key")
+		return
+	}
+
+	response := struct {
+		Key       string          `json:"key"`
+		Model     string          `json:"model,omitempty"`
+		Size      int             `json:"size"`
+		ExpiresAt time.Time       `json:"expires_at"`
+		Expired   bool            `json:"expired"`
+		Value     json.RawMessage `json:"value"`
+	}{
+		Key:       key,
+		Model:     entry.Model,
+		Size:      entry.Size,
+		ExpiresAt: entry.ExpiresAt,
+		Expired:   time.Now().After(entry.ExpiresAt),
+		Value:     entry.Value,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
 	stats := s.metrics.GetStats()
 
@@ -218,3 +591,15 @@ func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
 
 	w.Write([]byte(response))
 }
+
+// handleUsageDetailed breaks usage down by provider and model, and by the
+// value of a request metadata key when ?metadata_key= is given
+func (s *Server) handleUsageDetailed(w http.ResponseWriter, r *http.Request) {
+	stats := s.metrics.GetDetailedStats(r.URL.Query().Get("metadata_key"))
+	if r.URL.Query().Get("by_user") == "true" {
+		stats.ByUser = s.metrics.GetUserStats(s.cfg.Metrics.MaxUsers)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+// maxSSEEventBytes bounds a single upstream event so a stream that never
+// sends a blank line can't grow the buffer without limit
+const maxSSEEventBytes = 1 << 20
+
+var errSSEEventTooLarge = errors.New("sse event exceeds size limit")
+
+// sseEvent is one server-sent event: the field lines received before the
+// blank line that ends it
+type sseEvent struct {
+	lines []string
+}
+
+// data returns the event's data, joining multi-line data fields with "\n"
+// as the SSE spec does. ok is false when the event has no data field.
+func (e sseEvent) data() (data string, ok bool) {
+	var parts []string
+	for _, line := range e.lines {
+		value, found := strings.CutPrefix(line, "data:")
+		if !found {
+			continue
+		}
+		parts = append(parts, strings.TrimPrefix(value, " "))
+	}
+	if parts == nil {
+		return "", false
+	}
+	return strings.Join(parts, "\n"), true
+}
+
+// withData returns a copy of the event with its data replaced by a single
+// data line, keeping its other fields
+func (e sseEvent) withData(data string) sseEvent {
+	lines := make([]string, 0, len(e.lines))
+	replaced := false
+	for _, line := range e.lines {
+		if strings.HasPrefix(line, "data:") {
+			if !replaced {
+				lines = append(lines, "data: "+data)
+				replaced = true
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return sseEvent{lines: lines}
+}
+
+// bytes renders the event for relaying, terminated by a blank line
+func (e sseEvent) bytes() []byte {
+	return []byte(strings.Join(e.lines, "\n") + "\n\n")
+}
+
+// sseReader splits an upstream stream into events on blank lines, so an
+// event is only relayed once it is complete. LF, CRLF and CR line endings
+// are accepted.
+type sseReader struct {
+	r *bufio.Reader
+
+	// skipLF drops a '\n' completing a CRLF whose '\r' ended the last line,
+	// so a CR is acted on without waiting for the next byte to arrive
+	skipLF bool
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	return &sseReader{r: bufio.NewReader(r)}
+}
+
+// next returns the next event. A final event not followed by a blank line
+// is still returned; io.EOF is reported once the stream is exhausted.
+func (s *sseReader) next() (sseEvent, error) {
+	var ev sseEvent
+	size := 0
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			if err == io.EOF && len(ev.lines) > 0 {
+				return ev, nil
+			}
+			return sseEvent{}, err
+		}
+
+		if line == "" {
+			if len(ev.lines) > 0 {
+				return ev, nil
+			}
+			continue // blank lines between events
+		}
+
+		size += len(line)
+		if size > maxSSEEventBytes {
+			return sseEvent{}, errSSEEventTooLarge
+		}
+		ev.lines = append(ev.lines, line)
+	}
+}
+
+// readLine reads one line without its terminator
+func (s *sseReader) readLine() (string, error) {
+	var b strings.Builder
+	for {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && b.Len() > 0 {
+				return b.String(), nil
+			}
+			return "", err
+		}
+
+		skipLF := s.skipLF
+		s.skipLF = false
+
+		switch c {
+		case '\n':
+			if skipLF {
+				continue
+			}
+			return b.String(), nil
+		case '\r':
+			s.skipLF = true
+			return b.String(), nil
+		}
+
+		if b.Len() >= maxSSEEventBytes {
+			return "", errSSEEventTooLarge
+		}
+		b.WriteByte(c)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSSEReaderJoinsMultiLineData(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []string
+	}{
+		{
+			name:   "LF",
+			stream: "event: message\ndata: {\"a\":\ndata: 1}\n\ndata: [DONE]\n\n",
+			want:   []string{"{\"a\":\n1}", "[DONE]"},
+		},
+		{
+			name:   "CRLF",
+			stream: "data: first\r\ndata: second\r\n\r\ndata: [DONE]\r\n\r\n",
+			want:   []string{"first\nsecond", "[DONE]"},
+		},
+		{
+			name:   "CR",
+			stream: "data: first\rdata:second\r\rdata: [DONE]\r\r",
+			want:   []string{"first\nsecond", "[DONE]"},
+		},
+		{
+			name:   "empty data line",
+			stream: "data: a\ndata:\ndata: b\n\n",
+			want:   []string{"a\n\nb"},
+		},
+		{
+			name:   "no trailing blank line",
+			stream: "data: x\ndata: y",
+			want:   []string{"x\ny"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newSSEReader(strings.NewReader(tt.stream))
+			var got []string
+			for {
+				ev, err := r.next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, ok := ev.data()
+				if !ok {
+					t.Fatalf("event %q has no data", ev.lines)
+				}
+				got = append(got, data)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSEEventWithDataKeepsOtherFields(t *testing.T) {
+	ev := sseEvent{lines: []string{"event: message", "data: a", "id: 7", "data: b"}}
+	got := string(ev.withData("c").bytes())
+	if want := "event: message\ndata: c\nid: 7\n\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}